@@ -0,0 +1,82 @@
+package betteralign
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// typeAliases maps types declared in the analyzed package to the aliases referring to them.
+type typeAliases map[*types.TypeName][]*types.TypeName
+
+// findAliases collects all type aliases of the package, e.g. type B = A, by the type name whose declaration defines
+// their struct. Aliases have no fields of their own, so only the defining declaration is ever reported and fixed.
+func findAliases(pass *analysis.Pass) typeAliases {
+	aliases := make(typeAliases)
+
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			spec, ok := n.(*ast.TypeSpec)
+			if !ok || !spec.Assign.IsValid() {
+				return true
+			}
+
+			obj, ok := pass.TypesInfo.Defs[spec.Name].(*types.TypeName)
+			if !ok {
+				return true
+			}
+
+			// an alias of a struct literal, e.g. type A = struct{...}, is the defining declaration itself
+			if def := aliasDefinition(obj); def != nil && def != obj && def.Pkg() == pass.Pkg {
+				aliases[def] = append(aliases[def], obj)
+			}
+
+			return true
+		})
+	}
+
+	return aliases
+}
+
+// aliasDefinition follows a chain of aliases starting at obj and returns the type name declaring the aliased type,
+// or nil if it is neither a named type nor a struct literal.
+func aliasDefinition(obj *types.TypeName) *types.TypeName {
+	switch t := obj.Type().(type) {
+	case *types.Alias:
+		for {
+			switch rhs := t.Rhs().(type) {
+			case *types.Alias:
+				t = rhs
+			case *types.Named:
+				return rhs.Origin().Obj()
+			case *types.Struct:
+				return t.Obj()
+			default:
+				return nil
+			}
+		}
+	case *types.Named:
+		// materialized aliases are disabled with GODEBUG=gotypesalias=0
+		return t.Origin().Obj()
+	}
+
+	return nil
+}
+
+// aliasRelated returns the locations of aliases of struct name, attached to its diagnostic.
+func aliasRelated(name string, aliases []*types.TypeName) []analysis.RelatedInformation {
+	var related []analysis.RelatedInformation
+
+	for _, alias := range aliases {
+		related = append(related, analysis.RelatedInformation{
+			Pos:     alias.Pos(),
+			End:     alias.Pos() + token.Pos(len(alias.Name())),
+			Message: fmt.Sprintf("alias %s of %s, fixed through its definition", alias.Name(), name),
+		})
+	}
+
+	return related
+}
@@ -0,0 +1,180 @@
+package betteralign
+
+import (
+	"go/ast"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// alignDirectives are the prefixes of alignment pragmas: the forward-compatible go:align and its project-specific
+// betteralign:align equivalent.
+var alignDirectives = []string{"//go:align ", "//betteralign:align "}
+
+// findAlignDirectives returns the minimum alignment of type names and struct fields declared in files with an
+// alignment pragma such as //go:align 16, given in their doc comment or in a comment on the same line. Alignments
+// must be positive powers of two. They are hard constraints of the sizes model: aligned types have at least the
+// given alignment and a size rounded up to it, aligned fields are placed at offsets which are multiples of it.
+func findAlignDirectives(files []*ast.File, info *types.Info) map[types.Object]int64 {
+	var aligns map[types.Object]int64
+
+	record := func(obj types.Object, groups ...*ast.CommentGroup) {
+		if obj == nil {
+			return
+		}
+
+		if a := alignOf(groups...); a > 0 {
+			if aligns == nil {
+				aligns = make(map[types.Object]int64)
+			}
+
+			aligns[obj] = a
+		}
+	}
+
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.GenDecl:
+				for _, spec := range n.Specs {
+					ts, ok := spec.(*ast.TypeSpec)
+					if !ok {
+						continue
+					}
+
+					groups := []*ast.CommentGroup{ts.Doc, ts.Comment}
+					if len(n.Specs) == 1 {
+						groups = append(groups, n.Doc)
+					}
+
+					record(info.Defs[ts.Name], groups...)
+				}
+			case *ast.StructType:
+				for _, field := range n.Fields.List {
+					for _, name := range field.Names {
+						record(info.Defs[name], field.Doc, field.Comment)
+					}
+
+					if len(field.Names) == 0 {
+						record(embeddedField(info, field), field.Doc, field.Comment)
+					}
+				}
+			}
+
+			return true
+		})
+	}
+
+	return aligns
+}
+
+// embeddedField returns the variable of embedded struct field f, defined by the identifier of its type name.
+func embeddedField(info *types.Info, f *ast.Field) types.Object {
+	t := f.Type
+	if star, ok := t.(*ast.StarExpr); ok {
+		t = star.X
+	}
+
+	switch t := t.(type) {
+	case *ast.Ident:
+		return info.Defs[t]
+	case *ast.SelectorExpr:
+		return info.Defs[t.Sel]
+	case *ast.IndexExpr:
+		return embeddedField(info, &ast.Field{Type: t.X})
+	case *ast.IndexListExpr:
+		return embeddedField(info, &ast.Field{Type: t.X})
+	}
+
+	return nil
+}
+
+// alignOf returns the alignment given by the last alignment pragma of groups, or 0 if there is none.
+func alignOf(groups ...*ast.CommentGroup) int64 {
+	var a int64
+
+	for _, cg := range groups {
+		if cg == nil {
+			continue
+		}
+
+		for _, c := range cg.List {
+			for _, prefix := range alignDirectives {
+				arg, ok := strings.CutPrefix(c.Text, prefix)
+				if !ok {
+					continue
+				}
+
+				if n, err := strconv.ParseInt(strings.TrimSpace(arg), 10, 64); err == nil && n > 0 && n&(n-1) == 0 {
+					a = n
+				}
+			}
+		}
+	}
+
+	return a
+}
+
+// setAligns sets alignment pragmas of s, found by findAlignDirectives. Pragmas of named struct types also apply to
+// their underlying struct, which is what the optimizer works with.
+func (s *gcSizes) setAligns(aligns map[types.Object]int64) {
+	s.aligns = aligns
+
+	for obj, a := range aligns {
+		if tn, ok := obj.(*types.TypeName); ok {
+			if str, ok := tn.Type().Underlying().(*types.Struct); ok {
+				s.alignStruct(str, a)
+			}
+		}
+	}
+}
+
+// alignStruct records minimum alignment a of struct str.
+func (s *gcSizes) alignStruct(str *types.Struct, a int64) {
+	if s.structAligns == nil {
+		s.structAligns = make(map[*types.Struct]int64)
+	}
+
+	s.structAligns[str] = a
+}
+
+// alignLike gives reordered struct dst the alignment pragma of struct src, if any, and returns it.
+func (s *gcSizes) alignLike(dst, src *types.Struct) *types.Struct {
+	if a := s.structAligns[src]; a > 0 {
+		s.alignStruct(dst, a)
+	}
+
+	return dst
+}
+
+// isAlign64 reports whether T is the align64 marker type of sync/atomic or internal/runtime/atomic, which the gc
+// compiler aligns to 8 bytes, so that 64-bit atomic types are 8-byte aligned on 32-bit platforms too.
+func isAlign64(T types.Type) bool {
+	named, ok := T.(*types.Named)
+	if !ok || named.Obj().Name() != "align64" || named.Obj().Pkg() == nil {
+		return false
+	}
+
+	path := named.Obj().Pkg().Path()
+
+	return path == "sync/atomic" || path == "internal/runtime/atomic"
+}
+
+// fieldAlign returns the alignment of struct field f, raised to its alignment pragma, if any.
+func (s *gcSizes) fieldAlign(f *types.Var) int64 {
+	a := s.Alignof(f.Type())
+	if n := s.aligns[f]; n > a {
+		return n
+	}
+
+	return a
+}
+
+// typeAlign returns the alignment pragma of T, if T is a named type declared with one, or 0.
+func (s *gcSizes) typeAlign(T types.Type) int64 {
+	if n, ok := T.(*types.Named); ok && s.aligns != nil {
+		return s.aligns[n.Origin().Obj()]
+	}
+
+	return 0
+}
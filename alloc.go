@@ -0,0 +1,153 @@
+package betteralign
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// findAllocSites collects static allocation sites of local named types: composite literals, new(T),
+// make([]T, ...) and struct fields embedding the type by value, which all grow with the size of the type.
+func findAllocSites(pass *analysis.Pass) map[*types.TypeName][]token.Pos {
+	sites := make(map[*types.TypeName][]token.Pos)
+
+	var pos token.Pos
+
+	count := func(t types.Type) {
+		if obj := namedTypeName(t); obj != nil && obj.Pkg() == pass.Pkg {
+			sites[obj] = append(sites[obj], pos)
+		}
+	}
+
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			if n != nil {
+				pos = n.Pos()
+			}
+
+			if t := allocType(pass.TypesInfo, n); t != nil {
+				count(t)
+
+				return true
+			}
+
+			if n, ok := n.(*ast.StructType); ok {
+				for _, field := range n.Fields.List {
+					t := pass.TypesInfo.TypeOf(field.Type)
+					if _, ok := types.Unalias(t).(*types.Pointer); ok {
+						continue
+					}
+
+					for range max(len(field.Names), 1) {
+						count(t)
+					}
+				}
+			}
+
+			return true
+		})
+	}
+
+	return sites
+}
+
+// allocType returns the type of values allocated by node n, a composite literal, new(T) or make([]T, ...), or nil
+// if n allocates nothing or only pointers.
+func allocType(info *types.Info, n ast.Node) types.Type {
+	var t types.Type
+
+	switch n := n.(type) {
+	case *ast.CompositeLit:
+		t = info.TypeOf(n)
+	case *ast.CallExpr:
+		if len(n.Args) == 0 {
+			return nil
+		}
+
+		switch {
+		case isBuiltin(info, n, "new"):
+			t = info.TypeOf(n.Args[0])
+		case isBuiltin(info, n, "make"):
+			if s, ok := types.Unalias(info.TypeOf(n.Args[0])).(*types.Slice); ok {
+				t = s.Elem()
+			}
+		}
+	}
+
+	if t == nil {
+		return nil
+	}
+
+	if _, ok := types.Unalias(t).(*types.Pointer); ok {
+		return nil
+	}
+
+	return t
+}
+
+// findArrayLengths returns the largest known element count of arrays of local named types ([N]T) and of slices
+// created with make([]T, N) where N is a constant.
+func findArrayLengths(pass *analysis.Pass) map[*types.TypeName]int64 {
+	lengths := make(map[*types.TypeName]int64)
+
+	record := func(elem types.Type, n int64) {
+		if obj := namedTypeName(elem); obj != nil && obj.Pkg() == pass.Pkg {
+			if _, ok := types.Unalias(elem).(*types.Pointer); !ok && n > lengths[obj] {
+				lengths[obj] = n
+			}
+		}
+	}
+
+	for expr, tv := range pass.TypesInfo.Types {
+		if a, ok := types.Unalias(tv.Type).(*types.Array); ok {
+			record(a.Elem(), a.Len())
+		}
+
+		call, ok := expr.(*ast.CallExpr)
+		if !ok || len(call.Args) < 2 || !isBuiltin(pass.TypesInfo, call, "make") {
+			continue
+		}
+
+		s, ok := types.Unalias(pass.TypesInfo.TypeOf(call.Args[0])).(*types.Slice)
+		if !ok {
+			continue
+		}
+
+		for _, arg := range call.Args[1:] {
+			if v := pass.TypesInfo.Types[arg].Value; v != nil && v.Kind() == constant.Int {
+				if n, ok := constant.Int64Val(v); ok {
+					record(s.Elem(), n)
+				}
+			}
+		}
+	}
+
+	return lengths
+}
+
+// formatBytes returns n in human readable binary units, e.g. 8KiB or 1.5MiB.
+func formatBytes(n int64) string {
+	return formatBytesSep(n, "")
+}
+
+// formatBytesSep is formatBytes with sep between the number and the unit.
+func formatBytesSep(n int64, sep string) string {
+	const unit = 1024
+
+	if n < unit {
+		return fmt.Sprintf("%d%sB", n, sep)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(n)/float64(div)), ".0") + sep + string("KMGTPE"[exp]) + "iB"
+}
@@ -0,0 +1,144 @@
+package betteralign
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/types"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/renameio/v2/maybe"
+	"golang.org/x/tools/go/analysis"
+)
+
+const (
+	assertDirective = "//betteralign:assert"
+	assertFileName  = "betteralign_assert.go"
+)
+
+// sizeAssertion is a size=N or maxsize=N argument of a betteralign:assert directive.
+type sizeAssertion struct {
+	name string
+	key  string
+	size int64
+}
+
+// checkAssertions reports type declarations of g in file f whose size differs from a size=N or exceeds a maxsize=N
+// assertion given in a betteralign:assert directive, so that hard-won layouts don't silently regress. Directives
+// are read from doc comments and from comments on the line of the type name. It returns all well-formed assertions.
+func checkAssertions(pass *analysis.Pass, f *ast.File, g *ast.GenDecl) []sizeAssertion {
+	var asserts []sizeAssertion
+
+	for _, spec := range g.Specs {
+		ts, ok := spec.(*ast.TypeSpec)
+		if !ok || ts.TypeParams != nil {
+			continue
+		}
+
+		groups := []*ast.CommentGroup{ts.Doc}
+		if len(g.Specs) == 1 {
+			groups = append(groups, g.Doc)
+		}
+
+		line := pass.Fset.Position(ts.Name.Pos()).Line
+		for _, cg := range f.Comments {
+			if cg != ts.Doc && cg != g.Doc && pass.Fset.Position(cg.Pos()).Line == line {
+				groups = append(groups, cg)
+			}
+		}
+
+		for _, cg := range groups {
+			if cg == nil {
+				continue
+			}
+
+			for _, c := range cg.List {
+				if strings.HasPrefix(c.Text, assertDirective) {
+					asserts = append(asserts, checkAssertion(pass, c, ts)...)
+				}
+			}
+		}
+	}
+
+	return asserts
+}
+
+// checkAssertion checks a single betteralign:assert directive c against the size of type ts.
+func checkAssertion(pass *analysis.Pass, c *ast.Comment, ts *ast.TypeSpec) []sizeAssertion {
+	obj := pass.TypesInfo.Defs[ts.Name]
+	if obj == nil || unresolvedLayout(obj.Type(), make(map[types.Type]bool)) {
+		return nil
+	}
+
+	s := newGCSizes(pass)
+	sz := s.Sizeof(obj.Type().Underlying())
+
+	directive, _, _ := strings.Cut(strings.TrimPrefix(c.Text, assertDirective), "//")
+
+	args := strings.Fields(directive)
+	if len(args) == 0 {
+		reportf(pass, CodeDirective, c.Pos(), "malformed %s directive: expected size=N or maxsize=N", assertDirective[2:])
+
+		return nil
+	}
+
+	var asserts []sizeAssertion
+
+	for _, arg := range args {
+		key, value, _ := strings.Cut(arg, "=")
+
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 || (key != "size" && key != "maxsize") {
+			reportf(pass, CodeDirective, c.Pos(), "malformed %s directive: invalid argument %q", assertDirective[2:], arg)
+
+			continue
+		}
+
+		asserts = append(asserts, sizeAssertion{name: obj.Name(), key: key, size: n})
+
+		switch {
+		case key == "size" && sz != n:
+			reportf(pass, CodeAssert, ts.Pos(), "%s has size %d, asserted size %d", obj.Name(), sz, n)
+		case key == "maxsize" && sz > n:
+			reportf(pass, CodeAssert, ts.Pos(), "%s has size %d, exceeding asserted maximum size %d", obj.Name(), sz, n)
+		}
+	}
+
+	return asserts
+}
+
+// writeAssertFile writes compile-time checks of asserts into the assertion file of package pkgName in dir, so that
+// layout regressions fail the build even when betteralign isn't run.
+func writeAssertFile(dir, pkgName string, asserts []sizeAssertion) error {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "// Code generated by betteralign. DO NOT EDIT.\n\npackage %s\n\nimport \"unsafe\"\n\n", pkgName)
+	fmt.Fprintf(&buf, "// Compile-time checks of betteralign:assert directives: a layout change breaks the build.\n")
+	fmt.Fprintf(&buf, "var (\n")
+
+	for _, a := range asserts {
+		sizeof := fmt.Sprintf("unsafe.Sizeof(*(*%s)(nil))", a.name)
+
+		if a.key == "size" {
+			fmt.Fprintf(&buf, "_ [%s - %d]byte\n", sizeof, a.size)
+		}
+
+		fmt.Fprintf(&buf, "_ [%d - %s]byte\n", a.size, sizeof)
+	}
+
+	fmt.Fprintf(&buf, ")\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if err := maybe.WriteFile(longPath(filepath.Join(dir, assertFileName)), src, 0o644); err != nil {
+		return fmt.Errorf("%v: %w", ErrWriteFile, err)
+	}
+
+	return nil
+}
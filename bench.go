@@ -0,0 +1,101 @@
+package betteralign
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/types"
+	"path/filepath"
+
+	"github.com/google/renameio/v2/maybe"
+	"golang.org/x/tools/go/analysis"
+)
+
+const (
+	benchFileName = "betteralign_bench_test.go"
+	benchElems    = 1024
+)
+
+// writeBenches writes a benchmark into benchFileName of the package for every struct type matching name, given
+// either as a bare type name or qualified with the package path (example.com/pkg.Type). The benchmark allocates
+// slices of the struct in its current and optimal field order, so that their B/op show the memory effect of a fix.
+func writeBenches(pass *analysis.Pass, name string) {
+	scope := pass.Pkg.Scope()
+	for _, n := range scope.Names() {
+		obj, ok := scope.Lookup(n).(*types.TypeName)
+		if !ok || (n != name && pass.Pkg.Path()+"."+n != name) || variantFiles[pass.Fset.File(obj.Pos()).Name()] && isTestVariant(pass) {
+			continue
+		}
+
+		named, ok := obj.Type().(*types.Named)
+		if !ok {
+			continue
+		}
+
+		typ, ok := named.Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+
+		fn := filepath.Join(filepath.Dir(pass.Fset.PositionFor(obj.Pos(), false).Filename), benchFileName)
+
+		if named.TypeParams().Len() > 0 {
+			ReportError(StageBench, pass.Fset.Position(obj.Pos()).String(), fmt.Errorf("%v", ErrGenericBench))
+
+			continue
+		}
+
+		_, indexes := optimalOrder(typ, newGCSizes(pass))
+
+		if err := writeBench(fn, pass.Pkg, n, typ, indexes); err != nil {
+			ReportError(StageBench, fn, err)
+
+			continue
+		}
+
+		layoutMu.Lock()
+		fmt.Printf("%s: wrote benchmark, run with: go test -run='^$' -bench=Betteralign%s\n", fn, n)
+		layoutMu.Unlock()
+	}
+}
+
+// writeBench writes the benchmark of struct type name of package pkg with fields of typ in optimal order given by
+// indexes to fn.
+func writeBench(fn string, pkg *types.Package, name string, typ *types.Struct, indexes []int) error {
+	imports := map[string]string{"testing": "testing"}
+	fields := fieldDecls(typ, indexes, pkg, imports)
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "// Code generated by betteralign bench. DO NOT EDIT.\n\npackage %s\n\n", pkg.Name())
+	writeImports(&buf, imports)
+	fmt.Fprintf(&buf, "// betteralignOptimal%s is %s with fields in optimal order.\n", name, name)
+	fmt.Fprintf(&buf, "type betteralignOptimal%s struct {\n%s}\n\n", name, fields)
+	fmt.Fprintf(&buf, "var (\n\tbetteralignSink%s []%s\n\tbetteralignSinkOptimal%s []betteralignOptimal%s\n)\n\n",
+		name, name, name, name)
+	fmt.Fprintf(&buf, "// BenchmarkBetteralign%s allocates slices of %d %s in current and optimal field order, "+
+		"compare their B/op.\n", name, benchElems, name)
+	fmt.Fprintf(&buf, "func BenchmarkBetteralign%s(b *testing.B) {\n", name)
+
+	for _, variant := range []struct{ name, sink, typ string }{
+		{"current", "betteralignSink" + name, name},
+		{"optimal", "betteralignSinkOptimal" + name, "betteralignOptimal" + name},
+	} {
+		fmt.Fprintf(&buf, "\tb.Run(%q, func(b *testing.B) {\n\t\tb.ReportAllocs()\n\n", variant.name)
+		fmt.Fprintf(&buf, "\t\tfor i := 0; i < b.N; i++ {\n\t\t\t%s = make([]%s, %d)\n\t\t}\n\t})\n",
+			variant.sink, variant.typ, benchElems)
+	}
+
+	fmt.Fprintf(&buf, "}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if err := maybe.WriteFile(longPath(fn), src, 0o644); err != nil {
+		return fmt.Errorf("%v: %w", ErrWriteFile, err)
+	}
+
+	return nil
+}
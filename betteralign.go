@@ -36,12 +36,20 @@ import (
 	"go/ast"
 	"go/token"
 	"go/types"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 
-	"github.com/google/renameio/v2/maybe"
 	"github.com/sirkon/dst"
 	"github.com/sirkon/dst/decorator"
 	"golang.org/x/tools/go/analysis"
@@ -86,21 +94,85 @@ gopls. Use this standalone command to run it on your code:
 
 `
 
-const ignoreStruct = "betteralign:ignore"
+const (
+	ignoreStruct = "betteralign:ignore"
+
+	// applyRetries is the number of times writing a file locked by another process is retried.
+	applyRetries = 5
+	// applyBackoff is the delay before the first retry, doubled with every following one.
+	applyBackoff = 100 * time.Millisecond
+)
 
 var (
-	unsafePointerTyp  = types.Unsafe.Scope().Lookup("Pointer").(*types.TypeName).Type()
-	apply             bool
-	testFiles         bool
-	generatedFiles    bool
-	excludeFiles      StringArrayFlag
-	excludeDirs       StringArrayFlag
-	testSuffixes      = []string{"_test.go"}
-	generatedSuffixes = []string{"_generated.go", "_gen.go", ".gen.go", ".pb.go", ".pb.gw.go"}
-	ErrStatFile       = errors.New("unable to stat the file")
-	ErrNotRegularFile = errors.New("not a regular file, skipping")
-	ErrWriteFile      = errors.New("unable to write to file")
-	ErrPreFilterFiles = errors.New("failed to pre-filter files")
+	unsafePointerTyp    = types.Unsafe.Scope().Lookup("Pointer").(*types.TypeName).Type()
+	applySem            = make(chan struct{}, runtime.GOMAXPROCS(0))
+	overlay             map[string]string
+	apply               bool
+	testFiles           bool
+	generatedFiles      bool
+	reorderBinary       bool
+	reorderGob          bool
+	reorderConverted    bool
+	verbose             bool
+	debug               bool
+	layoutTable         bool
+	explain             bool
+	structLayoutDir     string
+	vizFormat           string
+	vizDir              string
+	layoutType          string
+	benchType           string
+	optimizedFile       bool
+	offsetComments      bool
+	keepMutexGroups     bool
+	hotOnly             bool
+	simd                bool
+	wordSizeOverride    PowerOfTwoFlag
+	maxAlignOverride    PowerOfTwoFlag
+	audit               bool
+	planFile            string
+	baselineFile        string
+	impact              bool
+	heapProfile         string
+	assertFile          bool
+	maxSize             int64
+	splitSize           int64
+	soaLen              int64
+	changedOnly         string
+	changedLines        bool
+	noGitIgnore         bool
+	applySymlinks       bool
+	preserveMtime       bool
+	verify              bool
+	dryRun              bool
+	excludeFiles        StringArrayFlag
+	excludeDirs         StringArrayFlag
+	generatedDirs       StringArrayFlag
+	fixScope            StringArrayFlag
+	generatedComment    RegexpFlag
+	messageTemplate     TemplateFlag
+	codecFuncs          StringArrayFlag
+	testSuffixes        = []string{"_test.go"}
+	generatedSuffixes   = []string{"_generated.go", "_gen.go", ".gen.go", ".pb.go", ".pb.gw.go"}
+	ErrStatFile         = errors.New("unable to stat the file")
+	ErrNotRegularFile   = errors.New("not a regular file, skipping")
+	ErrWriteFile        = errors.New("unable to write to file")
+	ErrPreFilterFiles   = errors.New("failed to pre-filter files")
+	ErrWriteLayout      = errors.New("unable to write struct layout")
+	ErrReadProfile      = errors.New("unable to read heap profile")
+	ErrMalformedProfile = errors.New("malformed heap profile")
+	ErrGitDiff          = errors.New("unable to list changed files since")
+	ErrStructNotFound   = errors.New("struct not found")
+	ErrFieldOrder       = errors.New("field order does not match struct fields")
+	ErrUnknownArch      = errors.New("unknown architecture")
+	ErrSymlink          = errors.New("reached through a symlink, skipping")
+	ErrSkipWrite        = errors.New("skip writing file")
+	ErrDecorateFile     = errors.New("unable to decorate file")
+	ErrGoroot           = errors.New("file in GOROOT is read-only, skipping")
+	ErrGenericBench     = errors.New("benchmarks of generic types are not supported")
+	ErrPowerOfTwo       = errors.New("not a positive power of two")
+	ErrReadBaseline     = errors.New("unable to read baseline")
+	ErrUnknownFlag      = errors.New("unknown flag")
 )
 
 type StringArrayFlag []string
@@ -114,19 +186,194 @@ func (f *StringArrayFlag) Set(value string) error {
 	return nil
 }
 
+// PowerOfTwoFlag is a number of bytes which is either 0 or a power of two.
+type PowerOfTwoFlag int64
+
+func (f *PowerOfTwoFlag) String() string {
+	return strconv.FormatInt(int64(*f), 10)
+}
+
+func (f *PowerOfTwoFlag) Set(value string) error {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	if n < 0 || n&(n-1) != 0 {
+		return fmt.Errorf("%w: %d", ErrPowerOfTwo, n)
+	}
+
+	*f = PowerOfTwoFlag(n)
+
+	return nil
+}
+
+// RegexpFlag is a regular expression, unset when empty.
+type RegexpFlag struct {
+	*regexp.Regexp
+}
+
+func (f *RegexpFlag) String() string {
+	if f.Regexp == nil {
+		return ""
+	}
+
+	return f.Regexp.String()
+}
+
+func (f *RegexpFlag) Set(value string) error {
+	if value == "" {
+		f.Regexp = nil
+
+		return nil
+	}
+
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+
+	f.Regexp = re
+
+	return nil
+}
+
+// TemplateFlag is a text/template rendering messages of findings, unset when empty.
+type TemplateFlag struct {
+	*template.Template
+	text string
+}
+
+func (f *TemplateFlag) String() string {
+	return f.text
+}
+
+func (f *TemplateFlag) Set(value string) error {
+	if value == "" {
+		f.Template, f.text = nil, ""
+
+		return nil
+	}
+
+	t, err := template.New("message").Parse(value)
+	if err != nil {
+		return err
+	}
+
+	// unknown fields are only detected on execution, so catch them before analysis
+	if err := t.Execute(io.Discard, Finding{}); err != nil {
+		return err
+	}
+
+	f.Template, f.text = t, value
+
+	return nil
+}
+
 var Analyzer = &analysis.Analyzer{
-	Name:     "betteralign",
-	Doc:      Doc,
-	Requires: []*analysis.Analyzer{inspect.Analyzer},
-	Run:      run,
+	Name:       "betteralign",
+	Doc:        Doc,
+	Requires:   []*analysis.Analyzer{inspect.Analyzer, FactsAnalyzer},
+	Run:        run,
+	ResultType: reflect.TypeOf((*Result)(nil)),
+	// structs of packages with type errors are still analyzed, unless their layout depends on the errors
+	RunDespiteErrors: true,
 }
 
 func InitAnalyzer(analyzer *analysis.Analyzer) {
+	Reset()
+
+	// unlike BoolVar and friends, Var doesn't reset flag values to their defaults
+	excludeFiles, excludeDirs, generatedDirs, fixScope, codecFuncs = nil, nil, nil, nil, nil
+
 	analyzer.Flags.BoolVar(&apply, "apply", false, "apply suggested fixes")
+	analyzer.Flags.BoolVar(&applySymlinks, "apply_symlinks", false,
+		"with apply, also fix files reached through symlinks, writing to the symlink targets")
+	analyzer.Flags.BoolVar(&preserveMtime, "preserve_mtime", false,
+		"with apply, keep modification times of fixed files, for build systems keyed on timestamps")
+	analyzer.Flags.BoolVar(&verify, "verify", false,
+		"verify that rewritten structs are optimal and report structs whose fix would not converge instead of fixing")
+	analyzer.Flags.BoolVar(&dryRun, "dry_run", false,
+		"with apply, list files that would be fixed with the number of structs and bytes affected instead of writing")
 	analyzer.Flags.BoolVar(&testFiles, "test_files", false, "also check and fix test files")
 	analyzer.Flags.BoolVar(&generatedFiles, "generated_files", false, "also check and fix generated files")
+	analyzer.Flags.Var(&generatedComment, "generated_comment",
+		"also treat files as generated when a comment above the package clause matches this regexp")
+	analyzer.Flags.Var(&generatedDirs, "generated_dirs",
+		"treat files as generated when a directory or file name of their path matches a pattern (e.g. gen,zz_generated*)")
+	analyzer.Flags.BoolVar(&reorderBinary, "reorder_binary", false, "also reorder structs serialized with encoding/binary")
+	analyzer.Flags.BoolVar(&reorderGob, "reorder_gob", false, "also reorder structs encoded with encoding/gob")
+	analyzer.Flags.BoolVar(&reorderConverted, "reorder_converted", false,
+		"reorder both sides of conversions between struct types with identical fields consistently instead of warning")
+	analyzer.Flags.Var(&codecFuncs, "codec_funcs",
+		"do not reorder structs passed to these functions (import/path.Func or import/path.Type.Method)")
+	analyzer.Flags.BoolVar(&layoutTable, "layout_table", false, "include current and optimal layout table in diagnostics")
+	analyzer.Flags.BoolVar(&explain, "explain", false, "name the fields and padding holes responsible for wasted space")
+	analyzer.Flags.Var(&messageTemplate, "message_template",
+		"render messages of findings with this text/template of finding fields, e.g. '{{.Struct}}: {{.Message}}'")
+	analyzer.Flags.StringVar(&structLayoutDir, "structlayout_dir", "",
+		"write structlayout compatible JSON of current and optimal layouts into this directory")
+	analyzer.Flags.StringVar(&vizFormat, "viz", "", "render current and optimal layouts as svg or dot")
+	analyzer.Flags.StringVar(&vizDir, "viz_dir", ".", "write rendered layouts into this directory")
+	analyzer.Flags.StringVar(&layoutType, "layout", "",
+		"only print field offsets, sizes and padding of the named struct type (Type or import/path.Type)")
+	analyzer.Flags.StringVar(&benchType, "bench", "",
+		"only write a benchmark of the named struct type (Type or import/path.Type) in current and optimal field order "+
+			"into "+benchFileName+" of its package")
+	analyzer.Flags.BoolVar(&audit, "audit", false,
+		"record size, alignment, pointer bytes and padding of every analyzed struct, including optimal ones")
+	analyzer.Flags.StringVar(&planFile, "plan", "",
+		"write a JSON plan of all fixes with file, byte offsets, original and new field order and rewritten source "+
+			"of every struct to this file")
+	analyzer.Flags.StringVar(&baselineFile, "baseline", "",
+		"suppress findings of structs recorded in this result file of an earlier run (-format=jsonl or -json with "+
+			"-sort), so only new ones are reported")
+	analyzer.Flags.BoolVar(&impact, "impact", false,
+		"count static allocation sites of reported structs and include an estimated impact score")
+	analyzer.Flags.StringVar(&heapProfile, "heapprofile", "",
+		"join allocation sites of reported structs with samples of this pprof heap profile")
+	analyzer.Flags.BoolVar(&assertFile, "assert_file", false,
+		"write compile-time checks of betteralign:assert directives into "+assertFileName+" of each package")
+	analyzer.Flags.BoolVar(&offsetComments, "offset_comments", false,
+		"with apply, annotate fields of fixed structs with trailing // offset N, size M comments and keep existing "+
+			"ones up to date")
+	analyzer.Flags.BoolVar(&keepMutexGroups, "mutex_groups", true,
+		"keep sync.Mutex and sync.RWMutex fields adjacent to and preceding the fields they guard, given by "+
+			"\"guarded by mu\" comments of fields or \"guards\" comments of mutexes")
+	analyzer.Flags.BoolVar(&optimizedFile, "optimized_file", false,
+		"write TypeOptimized siblings of suboptimal structs with optimal field order and conversion functions into "+
+			optimizedFileName+" of each package, for types whose declarations can't be touched")
+	analyzer.Flags.BoolVar(&hotOnly, "hot_only", false,
+		"only report and fix hot structs: used in sync.Pool, allocated in loops, elements of slices, arrays or maps "+
+			"with at least "+strconv.Itoa(hotElems)+" elements or channel element types")
+	analyzer.Flags.BoolVar(&simd, "simd", false,
+		"report fields passed to assembly functions at offsets which are not 16-byte aligned and keep such fields "+
+			"16-byte aligned when reordering")
+	wordSizeOverride, maxAlignOverride = 0, 0
+	analyzer.Flags.Var(&wordSizeOverride, "wordsize",
+		"size of pointers in bytes, overriding the target platform, e.g. for TinyGo targets (0 uses the platform)")
+	analyzer.Flags.Var(&maxAlignOverride, "maxalign",
+		"maximum alignment in bytes, overriding the target platform (0 uses the platform)")
+	analyzer.Flags.Int64Var(&maxSize, "max_size", 0,
+		"also report structs larger than this many bytes regardless of field order (0 disables)")
+	analyzer.Flags.Int64Var(&splitSize, "split_size", 0,
+		"suggest moving rarely used big fields of structs larger than this many bytes behind a pointer (0 disables)")
+	analyzer.Flags.Int64Var(&soaLen, "soa", 0,
+		"experimental: estimate struct of arrays savings for arrays and slices of pointer-heavy structs with at least "+
+			"this many elements (0 disables)")
+	analyzer.Flags.StringVar(&changedOnly, "changed_only", "",
+		"only check and fix files changed relative to this git base ref (e.g. origin/main), including untracked files")
+	analyzer.Flags.BoolVar(&changedLines, "changed_lines", false,
+		"with changed_only, only check and fix structs whose declarations intersect added or modified lines")
+	analyzer.Flags.BoolVar(&noGitIgnore, "no_gitignore", false, "also check and fix files ignored by git")
+	analyzer.Flags.BoolVar(&verbose, "verbose", false, "report skipped files and structs to stderr")
+	analyzer.Flags.BoolVar(&debug, "debug_log", false,
+		"like verbose, and also report analysis time per package, decorated files and applied fixes to stderr")
 	analyzer.Flags.Var(&excludeFiles, "exclude_files", "exclude files matching a pattern")
 	analyzer.Flags.Var(&excludeDirs, "exclude_dirs", "exclude directories matching a pattern")
+	analyzer.Flags.Var(&fixScope, "fix_scope",
+		"only apply fixes to files in directories matching a package pattern (e.g. ./internal/hotpath/...), while all "+
+			"packages are still analyzed and reported")
 }
 
 func init() {
@@ -134,6 +381,26 @@ func init() {
 }
 
 func run(pass *analysis.Pass) (interface{}, error) {
+	result := &Result{Package: pass.Pkg.Path()}
+
+	start := time.Now()
+	defer func() {
+		Logger().Debug("analyzed package", "package", pass.Pkg.Path(), "structs", result.Analyzed,
+			"duration", time.Since(start))
+	}()
+
+	if layoutType != "" {
+		printLayouts(os.Stdout, pass, layoutType)
+
+		return result, nil
+	}
+
+	if benchType != "" {
+		writeBenches(pass, benchType)
+
+		return result, nil
+	}
+
 	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
 	dec := decorator.NewDecorator(pass.Fset)
 	nodeFilter := []ast.Node{
@@ -143,53 +410,126 @@ func run(pass *analysis.Pass) (interface{}, error) {
 	}
 
 	var aFile *ast.File
-	var dFile *dst.File
+	var lazy *lazyFile
 	var strName string
 
-	applyFixesFset := make(map[string][]byte)
+	var asserts []sizeAssertion
+	var assertDir string
+
+	var siblings []sibling
+	var siblingDir string
+
+	applyFixesFset := make(map[string]*dst.File)
 	testFset := make(map[string]bool)
 	generatedFset := make(map[string]bool)
+	cgoFset := make(map[string]bool)
+
+	pinned := findPinnedTypes(pass)
+	typeNames := structTypeNames(pass)
+	aliases := findAliases(pass)
+	directives := findFileDirectives(pass)
+
+	arrayLengths := findArrayLengths(pass)
+	hot := findHotTypes(pass, arrayLengths)
+
+	var simdFields map[*types.Var]string
+	if res, ok := pass.ResultOf[FactsAnalyzer].(*factsResult); ok {
+		simdFields = res.simd
+	}
+
+	var fieldUses map[*types.Var]int
+	if splitSize > 0 {
+		fieldUses = findFieldUses(pass)
+	}
+
+	var allocSites map[*types.TypeName][]token.Pos
+	if impact || heapProfile != "" {
+		allocSites = findAllocSites(pass)
+	}
+
+	testVariant := variantFiles != nil && isTestVariant(pass)
 
 	inspect.Preorder(nodeFilter, func(node ast.Node) {
 		fn := pass.Fset.File(node.Pos()).Name()
 
-		if !testFiles && hasSuffixes(testFset, fn, testSuffixes) {
+		if testVariant && variantFiles[fn] {
+			auditFile(pass.Fset, node, "file analyzed in package without tests")
+			return
+		}
+
+		if directives[fn] == directiveIgnore {
+			auditFile(pass.Fset, node, "file ignored by directive")
+			return
+		}
+
+		// files opted in by directive are checked regardless of file filters
+		checked := directives[fn] == directiveCheck
+
+		if !testFiles && !checked && hasSuffixes(testFset, fn, testSuffixes) {
+			auditFile(pass.Fset, node, "test file")
+			return
+		}
+
+		if !generatedFiles && !checked && hasSuffixes(generatedFset, fn, generatedSuffixes) {
+			auditFile(pass.Fset, node, "generated file")
+			return
+		}
+
+		if cgoFset[fn] {
 			return
 		}
 
-		if !generatedFiles && hasSuffixes(generatedFset, fn, generatedSuffixes) {
+		if !checked && GitIgnored(fn) {
+			auditFile(pass.Fset, node, "file ignored by git")
 			return
 		}
 
-		if len(excludeDirs) > 0 || len(excludeFiles) > 0 {
+		if marked := skipMarkerDir(fn); !checked && marked != "" {
+			auditFile(pass.Fset, node, "file in directory marked with "+filepath.Join(marked, skipMarker))
+			return
+		}
+
+		if outOfScope(fn) {
+			auditFile(pass.Fset, node, "file out of scope")
+			return
+		}
+
+		if changedOnly != "" && isUnchanged(fn) {
+			auditFile(pass.Fset, node, "file unchanged since "+changedOnly)
+			return
+		}
+
+		if !checked && (len(excludeDirs) > 0 || len(excludeFiles) > 0) {
 			wd, err := os.Getwd()
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "%v %s: %v", ErrPreFilterFiles, fn, err)
+				ReportError(StagePreFilter, fn, fmt.Errorf("%v: %w", ErrPreFilterFiles, err))
 				return
 			}
-			relfn, err := filepath.Rel(wd, fn)
+			relfn, err := filepath.Rel(normalPath(wd), normalPath(fn))
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "%v %s: %v", ErrPreFilterFiles, fn, err)
+				ReportError(StagePreFilter, fn, fmt.Errorf("%v: %w", ErrPreFilterFiles, err))
 				return
 			}
 			dir := filepath.Dir(relfn)
 			for _, excludeDir := range excludeDirs {
-				rel, err := filepath.Rel(excludeDir, dir)
+				rel, err := filepath.Rel(normalPath(excludeDir), dir)
 				if err != nil {
-					fmt.Fprintf(os.Stderr, "%v %s: %v", ErrPreFilterFiles, fn, err)
+					ReportError(StagePreFilter, fn, fmt.Errorf("%v: %w", ErrPreFilterFiles, err))
 					return
 				}
 				if !strings.HasPrefix(rel, "..") {
+					auditFile(pass.Fset, node, "file in excluded directory "+excludeDir)
 					return
 				}
 			}
 			for _, excludeFile := range excludeFiles {
-				match, err := filepath.Match(excludeFile, relfn)
+				match, err := path.Match(filepath.ToSlash(excludeFile), filepath.ToSlash(relfn))
 				if err != nil {
-					fmt.Fprintf(os.Stderr, "%v %s: %v", ErrPreFilterFiles, fn, err)
+					ReportError(StagePreFilter, fn, fmt.Errorf("%v: %w", ErrPreFilterFiles, err))
 					return
 				}
 				if match {
+					auditFile(pass.Fset, node, "excluded file matching "+excludeFile)
 					return
 				}
 			}
@@ -197,9 +537,30 @@ func run(pass *analysis.Pass) (interface{}, error) {
 
 		if f, ok := node.(*ast.File); ok {
 			aFile = f
-			dFile, _ = dec.DecorateFile(aFile)
 
-			if !generatedFiles && hasGeneratedComment(generatedFset, fn, aFile) {
+			if isCgoGeneratedFile(fn, aFile) {
+				cgoFset[fn] = true
+				auditf(pass.Fset, aFile.Package, "skipping file produced by cgo")
+
+				return
+			}
+
+			lazy = &lazyFile{dec: dec, file: aFile, fn: fn, timing: &result.Timing}
+
+			if !generatedFiles && !checked && hasGeneratedComment(generatedFset, fn, aFile) {
+				auditf(pass.Fset, aFile.Package, "skipping generated file")
+				return
+			}
+
+			if !generatedFiles && !checked && len(generatedDirs) > 0 {
+				if pattern := generatedDirMatch(generatedFset, fn); pattern != "" {
+					auditf(pass.Fset, aFile.Package, "skipping generated file with path matching %s", pattern)
+					return
+				}
+			}
+
+			if !generatedFiles && !checked && hasLineDirective(generatedFset, fn, aFile) {
+				auditf(pass.Fset, aFile.Package, "skipping generated file with //line directives")
 				return
 			}
 
@@ -212,6 +573,11 @@ func run(pass *analysis.Pass) (interface{}, error) {
 
 		if g, ok = node.(*ast.GenDecl); ok {
 			if g.Tok == token.TYPE {
+				if a := checkAssertions(pass, aFile, g); len(a) > 0 && !hasSuffixes(testFset, fn, testSuffixes) {
+					asserts = append(asserts, a...)
+					assertDir = filepath.Dir(fn)
+				}
+
 				decl := g.Specs[0].(*ast.TypeSpec)
 				strName = decl.Name.Name
 			}
@@ -228,91 +594,329 @@ func run(pass *analysis.Pass) (interface{}, error) {
 			return
 		}
 
+		if changedLines && isUnchangedDecl(fn, pass.Fset.PositionFor(s.Pos(), false).Line,
+			pass.Fset.PositionFor(s.End(), false).Line) {
+			auditf(pass.Fset, s.Pos(), "skipping struct %s with lines unchanged since %s", strName, changedOnly)
+			return
+		}
+
 		if tv, ok := pass.TypesInfo.Types[s]; ok {
-			betteralign(pass, s, tv.Type.(*types.Struct), dec, dFile, applyFixesFset, fn)
+			if f := cgoMirrorField(tv.Type.(*types.Struct)); f != nil {
+				auditf(pass.Fset, s.Pos(), "skipping struct %s mirroring a C type in field %s", strName, f.Name())
+
+				return
+			}
+
+			if f := unresolvedField(tv.Type.(*types.Struct)); f != nil {
+				auditf(pass.Fset, s.Pos(), "skipping struct %s with type errors in field %s", strName, f.Name())
+
+				return
+			}
+
+			name := strName
+			if obj := typeNames[s]; obj != nil {
+				name = obj.Name()
+			}
+
+			if hotOnly && hot[typeNames[s]] == "" {
+				auditf(pass.Fset, s.Pos(), "skipping struct %s which is not hot", name)
+
+				return
+			}
+
+			if simd {
+				checkSIMD(pass, tv.Type.(*types.Struct), name, simdFields)
+			}
+
+			if maxSize > 0 {
+				checkMaxSize(pass, s, tv.Type.(*types.Struct), name)
+			}
+
+			if splitSize > 0 {
+				checkHotCold(pass, s, tv.Type.(*types.Struct), name, fieldUses)
+			}
+
+			if soaLen > 0 {
+				checkStructOfArrays(pass, s, tv.Type.(*types.Struct), name, arrayLengths[typeNames[s]])
+			}
+
+			reported := len(result.Findings)
+
+			betteralign(pass, s, tv.Type.(*types.Struct), lazy, applyFixesFset, fn, name, pinned[typeNames[s]],
+				allocSites[typeNames[s]], arrayLengths[typeNames[s]], hot[typeNames[s]], aliases[typeNames[s]], result)
+
+			// siblings are declared at package level of a non-test file, next to the type they mirror
+			if obj := typeNames[s]; optimizedFile && len(result.Findings) > reported && obj != nil &&
+				obj.Parent() == pass.Pkg.Scope() && !strings.HasSuffix(fn, "_test.go") {
+				if named, ok := obj.Type().(*types.Named); ok && named.TypeParams().Len() == 0 {
+					siblings = append(siblings, sibling{obj, tv.Type.(*types.Struct), result.Findings[reported].Order})
+					siblingDir = filepath.Dir(fn)
+				}
+			}
 		}
 	})
 
-	if !apply {
-		return nil, nil
+	if assertFile && len(asserts) > 0 {
+		if err := writeAssertFile(assertDir, pass.Pkg.Name(), asserts); err != nil {
+			ReportError(StageAssert, pass.Pkg.Path(), err)
+		}
 	}
 
-	for fn, buf := range applyFixesFset {
-		if err := applyToFile(fn, buf); err != nil {
-			fmt.Fprintf(os.Stderr, "error applying fixes to %v: %v\n", fn, err)
+	if len(siblings) > 0 {
+		if err := writeOptimizedFile(siblingDir, pass.Pkg, siblings); err != nil {
+			ReportError(StageOptimized, siblingDir, err)
 		}
 	}
 
-	return nil, nil
+	result.Timing.Inspect = time.Since(start) - result.Timing.Decorate
+
+	if !apply {
+		return result, nil
+	}
+
+	if dryRun {
+		printDryRun(os.Stdout, result, applyFixesFset)
+	}
+
+	// Every file is printed once, after all of its structs have been reordered.
+	for _, e := range applyFixes(applyFixesFset, &result.Timing) {
+		recordError(e)
+	}
+
+	return result, nil
 }
 
-func betteralign(pass *analysis.Pass, aNode *ast.StructType, typ *types.Struct, dec *decorator.Decorator,
-	dFile *dst.File, fixOps map[string][]byte, fn string,
+func betteralign(pass *analysis.Pass, aNode *ast.StructType, typ *types.Struct, lazy *lazyFile,
+	fixOps map[string]*dst.File, fn, name string, pin pinReason,
+	sites []token.Pos, arrayLen int64, hot string, aliases []*types.TypeName, result *Result,
 ) {
-	wordSize := pass.TypesSizes.Sizeof(unsafePointerTyp)
-	maxAlign := pass.TypesSizes.Alignof(unsafePointerTyp)
+	s := newGCSizes(pass)
+	wordSize := s.WordSize
 
-	s := gcSizes{wordSize, maxAlign}
-	optimal, indexes := optimalOrder(typ, &s)
+	var groups [][]int
+	if keepMutexGroups {
+		groups = mutexGroups(pass.Fset, aNode, typ)
+	}
+
+	optimal, indexes := optimalGroupedOrder(typ, s, groups)
 	optsz, optptrs := s.Sizeof(optimal), s.ptrdata(optimal)
 
-	var message string
-	if sz := s.Sizeof(typ); sz != optsz {
+	result.Analyzed++
+
+	sz, ptrs := s.Sizeof(typ), s.ptrdata(typ)
+
+	if audit {
+		var padding int64
+		for _, f := range s.layout(typ) {
+			padding += f.Padding
+		}
+
+		result.Audit = append(result.Audit, StructAudit{
+			Package:         pass.Pkg.Path(),
+			Struct:          name,
+			Pos:             pass.Fset.Position(aNode.Pos()),
+			Size:            sz,
+			Align:           s.Alignof(typ),
+			PtrBytes:        ptrs,
+			Padding:         padding,
+			OptimalSize:     optsz,
+			OptimalPtrBytes: optptrs,
+			Optimal:         sz == optsz && ptrs == optptrs,
+		})
+	}
+
+	var message, code string
+	if sz != optsz {
 		message = fmt.Sprintf("%d bytes saved: struct of size %d could be %d", sz-optsz, sz, optsz)
-	} else if ptrs := s.ptrdata(typ); ptrs != optptrs {
+		code = CodeSize
+	} else if ptrs != optptrs {
 		message = fmt.Sprintf("%d bytes saved: struct with %d pointer bytes could be %d", ptrs-optptrs, ptrs, optptrs)
+		code = CodePointerBytes
 	} else {
-		// Already optimal order.
+		// Already optimal order, but offset comments of a previous run may be stale.
+		if apply && offsetComments && hasOffsetComments(aNode) {
+			refreshOffsets(aNode, typ, lazy, fixOps, fn, s)
+		}
+
 		return
 	}
 
-	dNode := dec.Dst.Nodes[aNode].(*dst.StructType)
+	if explain {
+		if holes := explainPadding(s.layout(typ), s.Alignof(typ)); len(holes) > 0 {
+			message += "; padding: " + strings.Join(holes, ", ")
+		}
+	}
+
+	if layoutTable {
+		message += formatLayoutTable(s.layout(typ), s.layout(optimal))
+	}
 
-	if hasIgnoreComment(dNode.Fields) {
+	dFile, err := lazy.decorate()
+	if err != nil {
 		return
 	}
 
-	// Flatten the ast node since it could have multiple field names per list item while
-	// *types.Struct only have one item per field.
-	// TODO: Preserve multi-named fields instead of flattening.
-	flat := make([]*dst.Field, 0, len(indexes))
-	dummy := &dst.Field{}
-	for _, f := range dNode.Fields.List {
-		flat = append(flat, f)
-		if len(f.Names) == 0 {
-			continue
-		}
+	dNode := lazy.dec.Dst.Nodes[aNode].(*dst.StructType)
 
-		for range f.Names[1:] {
-			flat = append(flat, dummy)
+	if hasIgnoreComment(dNode.Fields, code) {
+		return
+	}
+
+	if inBaseline(pass.Pkg.Path(), name) {
+		auditf(pass.Fset, aNode.Pos(), "skipping struct %s recorded in baseline %s", name, baselineFile)
+
+		return
+	}
+
+	if structLayoutDir != "" {
+		if err := writeStructLayouts(structLayoutDir, pass.Pkg.Path(), name, s.layout(typ), s.layout(optimal)); err != nil {
+			ReportError(StageLayout, pass.Fset.Position(aNode.Pos()).String(), err)
 		}
 	}
 
-	// Sort fields according to the optimal order.
-	reordered := make([]*dst.Field, 0, len(indexes))
-	for _, index := range indexes {
-		f := flat[index]
-		if f == dummy {
-			continue
+	if vizFormat != "" {
+		if err := writeViz(vizDir, vizFormat, pass.Pkg.Path(), name, wordSize, s.layout(typ), s.layout(optimal)); err != nil {
+			ReportError(StageViz, pass.Fset.Position(aNode.Pos()).String(), err)
 		}
-		reordered = append(reordered, f)
 	}
 
-	dNode.Fields.List = reordered
+	finding := Finding{
+		Pos:             pass.Fset.Position(aNode.Pos()),
+		Package:         pass.Pkg.Path(),
+		Struct:          name,
+		Message:         message,
+		Code:            code,
+		Size:            sz,
+		OptimalSize:     optsz,
+		PtrBytes:        ptrs,
+		OptimalPtrBytes: optptrs,
+		AllocSites:      len(sites),
+		Order:           indexes,
+		Hot:             hot,
+	}
+
+	for _, alias := range aliases {
+		finding.Aliases = append(finding.Aliases, alias.Name())
+	}
+
+	if saved := finding.Saved(); saved > 0 && arrayLen > 1 {
+		finding.Message = fmt.Sprintf("%s; %d bytes/element × %d-element array = %s", message, saved, arrayLen,
+			formatBytes(saved*arrayLen))
+		message = finding.Message
+	}
+
+	if impact {
+		finding.Message = fmt.Sprintf("%s; %d allocation sites, impact score %d", message, len(sites),
+			finding.Impact())
+		message = finding.Message
+	}
+
+	if hotOnly {
+		finding.Message = fmt.Sprintf("%s; hot: %s", message, hot)
+		message = finding.Message
+	}
+
+	if heapProfile != "" {
+		finding.HeapBytes, finding.HeapObjects = heapAllocations(pass.Fset, pass.Pkg.Path(), sites)
+		finding.Message = fmt.Sprintf("%s; heap profile: %d bytes in %d objects", message, finding.HeapBytes,
+			finding.HeapObjects)
+		message = finding.Message
+	}
+
+	// Field order of pinned structs is relied upon at runtime, so only warn about them.
+	if pin.reason != "" {
+		finding.Pinned = pin.message(pass.Fset)
+		finding.Message = renderMessage(finding, fmt.Sprintf("%s; %s", message, finding.Pinned))
+		addFinding(result, finding)
+
+		pass.Report(analysis.Diagnostic{
+			Pos:      aNode.Pos(),
+			End:      aNode.Pos() + token.Pos(len("struct")),
+			Category: code,
+			Message:  finding.CodedMessage(),
+			Related:  aliasRelated(name, aliases),
+		})
 
-	var buf bytes.Buffer
-	if err := decorator.Fprint(&buf, dFile); err != nil {
 		return
 	}
 
+	finding.Message = renderMessage(finding, message)
+	addFinding(result, finding)
+
 	pass.Report(analysis.Diagnostic{
 		Pos:            aNode.Pos(),
 		End:            aNode.Pos() + token.Pos(len("struct")),
-		Message:        message,
+		Category:       code,
+		Message:        finding.CodedMessage(),
 		SuggestedFixes: nil,
+		Related:        aliasRelated(name, aliases),
 	})
 
-	fixOps[fn] = buf.Bytes()
+	if verify {
+		if err := verifyOrder(dNode, typ, indexes, groups, s, optsz, optptrs); err != nil {
+			reportf(pass, CodeVerify, aNode.Pos(), "struct %s: apply would not converge, not fixing: %v", name, err)
+
+			return
+		}
+	}
+
+	if planFile != "" {
+		entry, err := newPlanEntry(fn, pass.Fset.Position(aNode.Pos()).Offset, pass.Fset.Position(aNode.End()).Offset,
+			indexes)
+		if err != nil {
+			ReportError(StagePlan, finding.Pos.String(), err)
+		} else {
+			entry.Package, entry.Struct = pass.Pkg.Path(), name
+			result.Plan = append(result.Plan, entry)
+		}
+	}
+
+	// Reordered DST is only needed to rewrite the file.
+	if !apply {
+		return
+	}
+
+	if !inFixScope(fn) {
+		auditf(pass.Fset, aNode.Pos(), "not fixing %s: outside of fix_scope", name)
+
+		return
+	}
+
+	starts := fieldStarts(dNode)
+	flat := flattenFields(dNode)
+
+	reorderFields(dNode, indexes)
+
+	if len(groups) > 0 {
+		separateGroups(dNode, flat, groups)
+	}
+
+	if offsetComments {
+		annotateOffsets(dNode, typ, starts, s)
+	}
+
+	fixOps[fn] = dFile
+}
+
+// structTypeNames maps struct type literals to the type names they are declared with.
+func structTypeNames(pass *analysis.Pass) map[*ast.StructType]*types.TypeName {
+	names := make(map[*ast.StructType]*types.TypeName)
+
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			if spec, ok := n.(*ast.TypeSpec); ok {
+				if s, ok := spec.Type.(*ast.StructType); ok {
+					if obj, ok := pass.TypesInfo.Defs[spec.Name].(*types.TypeName); ok {
+						names[s] = obj
+					}
+				}
+			}
+
+			return true
+		})
+	}
+
+	return names
 }
 
 func optimalOrder(str *types.Struct, sizes *gcSizes) (*types.Struct, []int) {
@@ -331,7 +935,7 @@ func optimalOrder(str *types.Struct, sizes *gcSizes) (*types.Struct, []int) {
 		ft := field.Type()
 		elems[i] = elem{
 			i,
-			sizes.Alignof(ft),
+			sizes.fieldAlign(field),
 			sizes.Sizeof(ft),
 			sizes.ptrdata(ft),
 		}
@@ -389,17 +993,41 @@ func optimalOrder(str *types.Struct, sizes *gcSizes) (*types.Struct, []int) {
 		fields[i] = str.Field(e.index)
 		indexes[i] = e.index
 	}
-	return types.NewStruct(fields, nil), indexes
+	return sizes.alignLike(types.NewStruct(fields, nil), str), indexes
 }
 
 // Code below based on go/types.StdSizes.
 
 type gcSizes struct {
-	WordSize int64
-	MaxAlign int64
+	facts        structFacts
+	aligns       map[types.Object]int64
+	structAligns map[*types.Struct]int64
+	WordSize     int64
+	MaxAlign     int64
+}
+
+// fact returns the layout fact of named struct type T, if known.
+func (s *gcSizes) fact(T types.Type) *StructFact {
+	if n, ok := T.(*types.Named); ok && s.facts != nil {
+		return s.facts[n.Obj()]
+	}
+
+	return nil
 }
 
 func (s *gcSizes) Alignof(T types.Type) int64 {
+	if f := s.fact(T); f != nil {
+		return f.Align
+	}
+
+	if a := s.typeAlign(T); a > 0 {
+		return max(a, s.Alignof(T.Underlying()))
+	}
+
+	if isAlign64(T) {
+		return 8
+	}
+
 	// For arrays and structs, alignment is defined in terms
 	// of alignment of the elements and fields, respectively.
 	switch t := T.Underlying().(type) {
@@ -413,10 +1041,13 @@ func (s *gcSizes) Alignof(T types.Type) int64 {
 		// field f of x, but at least 1."
 		max := int64(1)
 		for i, nf := 0, t.NumFields(); i < nf; i++ {
-			if a := s.Alignof(t.Field(i).Type()); a > max {
+			if a := s.fieldAlign(t.Field(i)); a > max {
 				max = a
 			}
 		}
+		if a := s.structAligns[t]; a > max {
+			max = a
+		}
 		return max
 	}
 	a := s.Sizeof(T) // may be 0
@@ -447,6 +1078,14 @@ var basicSizes = [...]byte{
 }
 
 func (s *gcSizes) Sizeof(T types.Type) int64 {
+	if f := s.fact(T); f != nil {
+		return f.Size
+	}
+
+	if a := s.typeAlign(T); a > 0 {
+		return align(s.Sizeof(T.Underlying()), s.Alignof(T))
+	}
+
 	switch t := T.Underlying().(type) {
 	case *types.Basic:
 		k := t.Kind()
@@ -472,7 +1111,7 @@ func (s *gcSizes) Sizeof(T types.Type) int64 {
 		max := int64(1)
 		for i := 0; i < nf; i++ {
 			ft := t.Field(i).Type()
-			a, sz := s.Alignof(ft), s.Sizeof(ft)
+			a, sz := s.fieldAlign(t.Field(i)), s.Sizeof(ft)
 			if a > max {
 				max = a
 			}
@@ -481,6 +1120,9 @@ func (s *gcSizes) Sizeof(T types.Type) int64 {
 			}
 			o = align(o, a) + sz
 		}
+		if a := s.structAligns[t]; a > max {
+			max = a
+		}
 		return align(o, max)
 	case *types.Interface:
 		return s.WordSize * 2
@@ -495,6 +1137,10 @@ func align(x, a int64) int64 {
 }
 
 func (s *gcSizes) ptrdata(T types.Type) int64 {
+	if f := s.fact(T); f != nil {
+		return f.PtrData
+	}
+
 	switch t := T.Underlying().(type) {
 	case *types.Basic:
 		switch t.Kind() {
@@ -526,7 +1172,7 @@ func (s *gcSizes) ptrdata(T types.Type) int64 {
 		var o, p int64
 		for i := 0; i < nf; i++ {
 			ft := t.Field(i).Type()
-			a, sz := s.Alignof(ft), s.Sizeof(ft)
+			a, sz := s.fieldAlign(t.Field(i)), s.Sizeof(ft)
 			fp := s.ptrdata(ft)
 			o = align(o, a)
 			if fp != 0 {
@@ -565,7 +1211,7 @@ func hasGeneratedComment(generatedFset map[string]bool, fn string, file *ast.Fil
 		}
 
 		for _, l := range cg.List {
-			if reGeneratedBy(l.Text) {
+			if reGeneratedBy(l.Text) || generatedComment.Regexp != nil && generatedComment.MatchString(l.Text) {
 				generatedFset[fn] = true
 				return true
 			}
@@ -575,9 +1221,131 @@ func hasGeneratedComment(generatedFset map[string]bool, fn string, file *ast.Fil
 	return false
 }
 
-func hasIgnoreComment(node *dst.FieldList) bool {
+// generatedDirMatch returns the generated_dirs pattern matched by any directory or file name of fn relative to the
+// working directory, or an empty string if there is none. This catches output of generators which leave no
+// recognizable suffix or comment, e.g. trees under gen/ or zz_generated.deepcopy.go files.
+func generatedDirMatch(generatedFset map[string]bool, fn string) string {
+	rel := fn
+	if wd, err := os.Getwd(); err == nil {
+		if r, err := filepath.Rel(normalPath(wd), normalPath(fn)); err == nil {
+			rel = r
+		}
+	}
+
+	for _, elem := range strings.Split(filepath.ToSlash(rel), "/") {
+		if elem == ".." {
+			continue
+		}
+
+		for _, pattern := range generatedDirs {
+			ok, err := filepath.Match(pattern, elem)
+			if err != nil {
+				ReportError(StagePreFilter, fn, fmt.Errorf("%v: %w", ErrPreFilterFiles, err))
+				return ""
+			}
+			if ok {
+				generatedFset[fn] = true
+				return pattern
+			}
+		}
+	}
+
+	return ""
+}
+
+// renderMessage returns message of finding f rendered with the message_template, which sees the default message
+// as .Message, or message itself when no template is set.
+func renderMessage(f Finding, message string) string {
+	if messageTemplate.Template == nil {
+		return message
+	}
+
+	f.Message = message
+
+	var b strings.Builder
+	if err := messageTemplate.Execute(&b, f); err != nil {
+		ReportError(StageMessage, f.Pos.String(), err)
+
+		return message
+	}
+
+	return b.String()
+}
+
+// hasLineDirective reports whether the file maps its positions to other sources with //line directives, as code
+// generated from templates (yacc, templ etc.) does. Diagnostics of such files are reported at the template
+// positions.
+func hasLineDirective(generatedFset map[string]bool, fn string, file *ast.File) bool {
+	for _, cg := range file.Comments {
+		for _, l := range cg.List {
+			if strings.HasPrefix(l.Text, "//line ") || strings.HasPrefix(l.Text, "/*line ") {
+				generatedFset[fn] = true
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Reset forgets changed files listed, operational errors recorded, baseline findings suppressed and the heap profile
+// loaded by a previous run, for drivers analyzing repeatedly.
+func Reset() {
+	changedOnce, changedFiles, changedHunks = sync.Once{}, nil, nil
+
+	ignoredMu.Lock()
+	gitTops, gitIgnored = nil, nil
+	ignoredMu.Unlock()
+
+	skipMu.Lock()
+	skipDirs = nil
+	skipMu.Unlock()
+
+	opErrorsMu.Lock()
+	opErrors = nil
+	opErrorsMu.Unlock()
+
+	baselineMu.Lock()
+	baselineOnce, baselineCounts = sync.Once{}, nil
+	baselineMu.Unlock()
+
+	heapProfileOnce, heapProfileLines = sync.Once{}, nil
+}
+
+// lazyFile decorates a file on first use, since most files contain no struct that needs to be checked for an
+// ignore comment or reordered.
+type lazyFile struct {
+	dec    *decorator.Decorator
+	file   *ast.File
+	dst    *dst.File
+	err    error
+	timing *Timing
+	fn     string
+	done   bool
+}
+
+// decorate returns the DST of the file, decorating it only once.
+func (l *lazyFile) decorate() (*dst.File, error) {
+	if !l.done {
+		l.done = true
+
+		start := time.Now()
+		l.dst, l.err = l.dec.DecorateFile(l.file)
+		l.timing.Decorate += time.Since(start)
+
+		if l.err != nil {
+			ReportError(StageDecorate, l.fn, fmt.Errorf("%v: %w", ErrDecorateFile, l.err))
+		} else {
+			Logger().Debug("decorated file", "file", l.fn)
+		}
+	}
+
+	return l.dst, l.err
+}
+
+func hasIgnoreComment(node *dst.FieldList, code string) bool {
 	for _, opening := range node.Decs.Opening.All() {
-		if strings.HasPrefix(opening, "//") && strings.Contains(opening, ignoreStruct) {
+		if strings.HasPrefix(opening, "//") && strings.Contains(opening, ignoreStruct) && ignoredCode(opening, code) {
 			return true
 		}
 	}
@@ -585,8 +1353,89 @@ func hasIgnoreComment(node *dst.FieldList) bool {
 	return false
 }
 
+// checkMaxSize reports struct typ larger than the max_size threshold, since copying oversized value types and the
+// stack growth they cause are costs that field order alone can't fix.
+func checkMaxSize(pass *analysis.Pass, node *ast.StructType, typ *types.Struct, name string) {
+	s := newGCSizes(pass)
+
+	if sz := s.Sizeof(typ); sz > maxSize {
+		reportf(pass, CodeMaxSize, node.Pos(), "struct %s of size %d exceeds maximum size %d", name, sz, maxSize)
+	}
+}
+
+// applyFixes prints and writes rewritten files with a bounded number of workers shared by all packages, which also
+// bounds the number of printed files held in memory. It adds print and write durations of all files to timing and
+// returns errors of all files, ordered by file name.
+func applyFixes(files map[string]*dst.File, timing *Timing) []OperationalError {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []OperationalError
+	)
+
+	for fn, dFile := range files {
+		applySem <- struct{}{}
+
+		wg.Add(1)
+
+		go func() {
+			defer func() {
+				<-applySem
+				wg.Done()
+			}()
+
+			var buf bytes.Buffer
+
+			start := time.Now()
+			err := decorator.Fprint(&buf, dFile)
+			printed := time.Now()
+
+			if err == nil {
+				err = applyToFile(fn, buf.Bytes())
+			}
+
+			mu.Lock()
+			timing.Print += printed.Sub(start)
+			timing.Write += time.Since(printed)
+			mu.Unlock()
+
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, OperationalError{Path: fn, Stage: StageApply, Error: err.Error()})
+				mu.Unlock()
+
+				return
+			}
+
+			Logger().Debug("applied fixes", "file", fn)
+		}()
+	}
+
+	wg.Wait()
+
+	sortErrors(errs)
+
+	return errs
+}
+
 func applyToFile(fn string, buf []byte) error {
-	st, err := os.Stat(fn)
+	if real, ok := symlinkTarget(fn); ok {
+		if !applySymlinks {
+			return fmt.Errorf("%v", ErrSymlink)
+		}
+
+		// writing the target keeps the symlink intact, instead of replacing it with a regular file
+		fn = real
+	}
+
+	if InGoroot(fn) {
+		return fmt.Errorf("%v", ErrGoroot)
+	}
+
+	// the decorated source came from the replacement file, so that is the one fixed
+	fn = overlayFile(fn)
+
+	st, err := os.Stat(longPath(fn))
 	if err != nil {
 		return fmt.Errorf("%v: %w", ErrStatFile, err)
 	}
@@ -595,7 +1444,27 @@ func applyToFile(fn string, buf []byte) error {
 		return fmt.Errorf("%v", ErrNotRegularFile)
 	}
 
-	if err := maybe.WriteFile(fn, buf, st.Mode()); err != nil {
+	if dryRun {
+		return nil
+	}
+
+	outputMu.RLock()
+	defer outputMu.RUnlock()
+
+	if applyHook != nil {
+		original, err := os.ReadFile(longPath(fn))
+		if err != nil {
+			return fmt.Errorf("%v: %w", ErrStatFile, err)
+		}
+
+		if err := applyHook(fn, original, buf); errors.Is(err, ErrSkipWrite) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if err := output.WriteFile(fn, buf, st.Mode()); err != nil {
 		return fmt.Errorf("%v: %w", ErrWriteFile, err)
 	}
 
@@ -1,10 +1,18 @@
 package betteralign_test
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/dkorunic/betteralign"
 	"golang.org/x/tools/go/analysis"
@@ -14,10 +22,13 @@ import (
 
 func NewTestAnalyzer() *analysis.Analyzer {
 	analyzer := &analysis.Analyzer{
-		Name:     betteralign.Analyzer.Name,
-		Doc:      betteralign.Analyzer.Doc,
-		Requires: betteralign.Analyzer.Requires,
-		Run:      betteralign.Analyzer.Run,
+		Name:       betteralign.Analyzer.Name,
+		Doc:        betteralign.Analyzer.Doc,
+		Requires:   betteralign.Analyzer.Requires,
+		Run:        betteralign.Analyzer.Run,
+		ResultType: betteralign.Analyzer.ResultType,
+
+		RunDespiteErrors: betteralign.Analyzer.RunDespiteErrors,
 	}
 	betteralign.InitAnalyzer(analyzer)
 	return analyzer
@@ -85,6 +96,41 @@ func TestApply(t *testing.T) {
 	}
 }
 
+// BenchmarkApplyGenerated measures rewriting a single generated-like file with many suboptimal structs.
+func BenchmarkApplyGenerated(b *testing.B) {
+	var src strings.Builder
+
+	src.WriteString("package gen\n")
+
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&src, "\n// S%d is a struct.\ntype S%d struct { // want \"struct of size 24 could be 16\"\n", i, i)
+		src.WriteString("\ta bool // a\n\tb int64 // b\n\tc bool // c\n}\n")
+	}
+
+	dir := b.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "src", "gen"), 0o755); err != nil {
+		b.Fatal(err)
+	}
+
+	fn := filepath.Join(dir, "src", "gen", "gen.go")
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+
+		// a fresh analyzer forgets structs seen in previous iterations
+		analyzer := NewTestAnalyzer()
+		analyzer.Flags.Set("apply", "true")
+
+		if err := os.WriteFile(fn, []byte(src.String()), 0o644); err != nil {
+			b.Fatal(err)
+		}
+
+		b.StartTimer()
+
+		analysistest.Run(b, dir, analyzer, "gen")
+	}
+}
+
 func TestFlagExcludeDirs(t *testing.T) {
 	t.Run("exclude none", func(t *testing.T) {
 		testdata := analysistest.TestData()
@@ -119,3 +165,1596 @@ func TestFlagExcludeFiles(t *testing.T) {
 		analysistest.Run(t, testdata, analyzer, "exclude/b/...")
 	})
 }
+
+func TestFlagGeneratedDirs(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("generated_dirs", "gen,zz_generated*")
+	analysistest.Run(t, testdata, analyzer, "gendir/...")
+}
+
+func TestFlagGeneratedComment(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("generated_comment", `DO NOT MODIFY — produced by \w+`)
+	defer analyzer.Flags.Set("generated_comment", "")
+	analysistest.Run(t, testdata, analyzer, "gencomment")
+
+	if err := analyzer.Flags.Set("generated_comment", "produced by ("); err == nil {
+		t.Error("expected an error for an invalid regexp")
+	}
+}
+
+func TestFileDirectives(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, NewTestAnalyzer(), "directives/...")
+}
+
+func TestSkipMarker(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, NewTestAnalyzer(), "skipmarker/...")
+}
+
+func TestPinned(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analysistest.Run(t, testdata, analyzer, "pinned")
+}
+
+func TestConversions(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, NewTestAnalyzer(), "convert")
+}
+
+func TestFlagReorderConverted(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(dir, "src", "convert"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	writePackageFile(t, dir, "convert", "convert.go", `package convert
+
+type Wire struct { // want "struct of size 24 could be 16$"
+	a byte
+	b int64
+	c byte
+}
+
+type Mirror struct { // want "struct of size 24 could be 16$"
+	a byte
+	b int64
+	c byte
+}
+
+func toMirror(w Wire) Mirror { return Mirror(w) }
+`)
+
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("apply", "true")
+	analyzer.Flags.Set("reorder_converted", "true")
+	analysistest.Run(t, dir, analyzer, "convert")
+
+	got, err := os.ReadFile(filepath.Join(dir, "src", "convert", "convert.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `package convert
+
+type Wire struct { // want "struct of size 24 could be 16$"
+	b int64
+	a byte
+	c byte
+}
+
+type Mirror struct { // want "struct of size 24 could be 16$"
+	b int64
+	a byte
+	c byte
+}
+
+func toMirror(w Wire) Mirror { return Mirror(w) }
+`
+	if string(got) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestFlagReorderBinary(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("reorder_binary", "true")
+	analysistest.Run(t, testdata, analyzer, "binary")
+}
+
+func TestFlagCodecFuncs(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("codec_funcs", "codec.Codec.Marshal,codec.Store")
+	analysistest.Run(t, testdata, analyzer, "codec")
+}
+
+func TestCgoGenerated(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("generated_files", "true")
+	analysistest.Run(t, testdata, analyzer, "cgogen")
+}
+
+func TestFlagLayoutTable(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("layout_table", "true")
+	analysistest.Run(t, testdata, analyzer, "table")
+}
+
+func TestFlagExplain(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("explain", "true")
+	analysistest.Run(t, testdata, analyzer, "explain")
+}
+
+func TestAliases(t *testing.T) {
+	testdata := analysistest.TestData()
+	results := analysistest.Run(t, testdata, NewTestAnalyzer(), "alias")
+
+	want := map[string][]string{"Bad": {"Alias", "Chain"}, "Literal": {"LiteralAlias"}}
+	for _, r := range results {
+		findings := r.Result.(*betteralign.Result).Findings
+		if len(findings) != len(want) {
+			t.Fatalf("expected %d findings, got %d", len(want), len(findings))
+		}
+
+		for i, f := range findings {
+			if !slices.Equal(f.Aliases, want[f.Struct]) {
+				t.Errorf("%s: expected aliases %v, got %v", f.Struct, want[f.Struct], f.Aliases)
+			}
+
+			if len(r.Diagnostics[i].Related) != len(want[f.Struct]) {
+				t.Errorf("%s: expected %d related locations, got %d", f.Struct, len(want[f.Struct]),
+					len(r.Diagnostics[i].Related))
+			}
+		}
+	}
+}
+
+func TestLineDirectives(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, NewTestAnalyzer(), "linedirective")
+
+	dir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(dir, "src", "linedirective"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	writePackageFile(t, dir, "linedirective", "parser.go", `package linedirective
+
+//line parser.y:40
+type yySymType struct { // want "struct of size 24 could be 16"
+	yys  bool
+	val  int64
+	done bool
+}
+`)
+
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("generated_files", "true")
+
+	for _, r := range analysistest.Run(t, dir, analyzer, "linedirective") {
+		for _, f := range r.Result.(*betteralign.Result).Findings {
+			if filepath.Base(f.Pos.Filename) != "parser.y" || f.Pos.Line != 40 {
+				t.Errorf("expected %s at parser.y:40, got %s", f.Struct, f.Pos)
+			}
+		}
+	}
+}
+
+func TestDiagnosticCodes(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("max_size", "32")
+	defer analyzer.Flags.Set("max_size", "0")
+
+	for _, r := range analysistest.Run(t, testdata, analyzer, "codes") {
+		for _, d := range r.Diagnostics {
+			if !strings.HasPrefix(d.Message, d.Category+": ") {
+				t.Errorf("expected message prefixed with category %q, got %q", d.Category, d.Message)
+			}
+		}
+
+		for _, f := range r.Result.(*betteralign.Result).Findings {
+			if want := map[string]string{"Size": betteralign.CodeSize, "Pointers": betteralign.CodePointerBytes,
+				"IgnoredOther": betteralign.CodeSize}[f.Struct]; f.Code != want {
+				t.Errorf("%s: expected code %s, got %s", f.Struct, want, f.Code)
+			}
+		}
+	}
+}
+
+func TestFlagMessageTemplate(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+
+	if err := analyzer.Flags.Set("message_template", "struct {{.Struct}} in {{.Package}}: {{.Message}}"); err != nil {
+		t.Fatal(err)
+	}
+	defer analyzer.Flags.Set("message_template", "")
+
+	for _, r := range analysistest.Run(t, testdata, analyzer, "a") {
+		for i, f := range r.Result.(*betteralign.Result).Findings {
+			if want := "struct " + f.Struct + " in a: "; !strings.HasPrefix(f.Message, want) {
+				t.Errorf("expected message starting with %q, got %q", want, f.Message)
+			}
+
+			if want := f.Code + ": " + f.Message; r.Diagnostics[i].Message != want {
+				t.Errorf("expected diagnostic %q, got %q", want, r.Diagnostics[i].Message)
+			}
+		}
+	}
+
+	for _, text := range []string{"{{.Struct", "{{.NoSuchField}}"} {
+		if err := analyzer.Flags.Set("message_template", text); err == nil {
+			t.Errorf("expected an error for template %q", text)
+		}
+	}
+}
+
+func TestFlagVerify(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("verify", "true")
+	analysistest.Run(t, testdata, analyzer, "a", "verify")
+}
+
+func TestTypeErrors(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, NewTestAnalyzer(), "typeerrors")
+}
+
+func TestAlignDirectives(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, NewTestAnalyzer(), "align")
+}
+
+func TestFlagSIMD(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("simd", "true")
+	analysistest.Run(t, testdata, analyzer, "vector")
+}
+
+func TestFlagWordSize(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("wordsize", "4")
+	analyzer.Flags.Set("maxalign", "4")
+	analysistest.Run(t, testdata, analyzer, "wordsize")
+
+	if err := analyzer.Flags.Set("maxalign", "3"); !errors.Is(err, betteralign.ErrPowerOfTwo) {
+		t.Errorf("Set(maxalign=3) error = %v, want %v", err, betteralign.ErrPowerOfTwo)
+	}
+}
+
+func TestFlagStructLayoutDir(t *testing.T) {
+	layoutDir := t.TempDir()
+
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("structlayout_dir", layoutDir)
+	analysistest.Run(t, testdata, analyzer, "a")
+
+	current, err := os.ReadFile(filepath.Join(layoutDir, "a.Bad.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	optimal, err := os.ReadFile(filepath.Join(layoutDir, "a.Bad.optimal.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden.Assert(t, string(current)+"\n"+string(optimal)+"\n", "structlayout.golden")
+}
+
+func TestFlagViz(t *testing.T) {
+	vizDir := t.TempDir()
+
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("viz", "dot")
+	analyzer.Flags.Set("viz_dir", vizDir)
+	analysistest.Run(t, testdata, analyzer, "a")
+
+	dot, err := os.ReadFile(filepath.Join(vizDir, "a.Bad.dot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden.Assert(t, string(dot), "viz.dot.golden")
+}
+
+func TestFlagLayout(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("layout", "Mixed")
+	analysistest.Run(t, testdata, analyzer, "layout")
+
+	os.Stdout = stdout
+	w.Close()
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden.Assert(t, string(out), "layout.golden")
+}
+
+func TestFlagBench(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(dir, "src", "bench"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	writePackageFile(t, dir, "bench", "bench.go",
+		"package bench\n\nimport \"time\"\n\ntype Bench struct {\n\ta bool\n\tt time.Time\n\tb int64\n\tc bool\n}\n")
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+
+	stdout := os.Stdout
+	os.Stdout = devNull
+
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("bench", "Bench")
+	analysistest.Run(t, dir, analyzer, "bench")
+
+	os.Stdout = stdout
+
+	got, err := os.ReadFile(filepath.Join(dir, "src", "bench", "betteralign_bench_test.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden.Assert(t, string(got), "bench.golden")
+}
+
+func TestFlagOptimizedFile(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(dir, "src", "sibling"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	writePackageFile(t, dir, "sibling", "sibling.go", `package sibling
+
+import "sync"
+
+type Sibling struct { // want "struct of size 32 could be 24"
+	a  bool   `+"`json:\"a\"`"+`
+	mu sync.Mutex
+	b  *int
+	c  bool
+	_  int32
+}
+`)
+
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("optimized_file", "true")
+	analysistest.Run(t, dir, analyzer, "sibling")
+
+	got, err := os.ReadFile(filepath.Join(dir, "src", "sibling", "betteralign_optimized.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden.Assert(t, string(got), "optimized.golden")
+}
+
+func TestFlagOffsetComments(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(dir, "src", "offsets"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	writePackageFile(t, dir, "offsets", "offsets.go", `package offsets
+
+type Offsets struct { // want "struct of size 24 could be 16"
+	a    bool // flag
+	b    int64
+	c, d bool
+}
+
+type Stale struct {
+	x int64 // offset 8, size 4
+	y int32 // offset 0, size 8
+}
+`)
+
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("apply", "true")
+	analyzer.Flags.Set("offset_comments", "true")
+	analysistest.Run(t, dir, analyzer, "offsets")
+
+	got, err := os.ReadFile(filepath.Join(dir, "src", "offsets", "offsets.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `package offsets
+
+type Offsets struct { // want "struct of size 24 could be 16"
+	b    int64 // offset 0, size 8
+	a    bool  // flag // offset 8, size 1
+	c, d bool  // offset 9, size 2
+}
+
+type Stale struct {
+	x int64 // offset 0, size 8
+	y int32 // offset 8, size 4
+}
+`
+	if string(got) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestFlagHotOnly(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("hot_only", "true")
+	analysistest.Run(t, testdata, analyzer, "hot")
+}
+
+func TestMutexGroups(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(dir, "src", "guards"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	writePackageFile(t, dir, "guards", "guards.go", `package guards
+
+import "sync"
+
+type Cache struct { // want "struct of size 48 could be 40"
+	open bool
+
+	// mu guards the fields below.
+	mu    sync.Mutex
+	ok    bool
+	hits  int64
+	dirty bool
+
+	name string
+}
+
+type Explicit struct { // want "struct of size 72 could be 64"
+	a     bool
+	mu    sync.RWMutex
+	b     bool
+	count int64 // guarded by mu
+	c     bool
+	items []int // protected by mu
+}
+
+type Pair struct { // want "struct of size 56 could be 48"
+	a bool
+
+	// mu1 guards the fields below.
+	mu1 sync.Mutex
+	x   bool
+	y   int64
+
+	// mu2 guards the fields below.
+	mu2 sync.Mutex
+	z   bool
+	w   int64
+
+	b bool
+}
+`)
+
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("apply", "true")
+	analysistest.Run(t, dir, analyzer, "guards")
+
+	got, err := os.ReadFile(filepath.Join(dir, "src", "guards", "guards.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `package guards
+
+import "sync"
+
+type Cache struct { // want "struct of size 48 could be 40"
+	name string
+
+	// mu guards the fields below.
+	mu    sync.Mutex
+	hits  int64
+	ok    bool
+	dirty bool
+
+	open bool
+}
+
+type Explicit struct { // want "struct of size 72 could be 64"
+	mu    sync.RWMutex
+	items []int // protected by mu
+	count int64 // guarded by mu
+
+	a bool
+	b bool
+	c bool
+}
+
+type Pair struct { // want "struct of size 56 could be 48"
+	// mu1 guards the fields below.
+	mu1 sync.Mutex
+	y   int64
+	x   bool
+
+	// mu2 guards the fields below.
+	mu2 sync.Mutex
+	w   int64
+	z   bool
+
+	a bool
+
+	b bool
+}
+`
+	if string(got) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestMutexGroupsDisabled(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(dir, "src", "guards"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	writePackageFile(t, dir, "guards", "guards.go", `package guards
+
+import "sync"
+
+type Explicit struct { // want "struct of size 72 could be 64"
+	a     bool
+	mu    sync.RWMutex
+	b     bool
+	count int64 // guarded by mu
+	c     bool
+	items []int // protected by mu
+}
+`)
+
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("apply", "true")
+	analyzer.Flags.Set("mutex_groups", "false")
+	analysistest.Run(t, dir, analyzer, "guards")
+
+	got, err := os.ReadFile(filepath.Join(dir, "src", "guards", "guards.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `package guards
+
+import "sync"
+
+type Explicit struct { // want "struct of size 72 could be 64"
+	items []int // protected by mu
+	count int64 // guarded by mu
+	mu    sync.RWMutex
+	a     bool
+	b     bool
+	c     bool
+}
+`
+	if string(got) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	results := analysistest.Run(t, testdata, analyzer, "exclude/none/...")
+
+	var pkgResults []*betteralign.Result
+	for _, r := range results {
+		pkgResults = append(pkgResults, r.Result.(*betteralign.Result))
+	}
+
+	var buf bytes.Buffer
+	if err := betteralign.Summarize(pkgResults).WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	golden.Assert(t, buf.String(), "summary.golden")
+}
+
+func TestFlagAudit(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("audit", "true")
+	results := analysistest.Run(t, testdata, analyzer, "a")
+
+	var pkgResults []*betteralign.Result
+	for _, r := range results {
+		pkgResults = append(pkgResults, r.Result.(*betteralign.Result))
+	}
+
+	audits := betteralign.AllAudits(pkgResults)
+
+	var analyzed int
+	for _, r := range pkgResults {
+		analyzed += r.Analyzed
+	}
+
+	if len(audits) != analyzed {
+		t.Errorf("AllAudits() returned %d structs, want all %d analyzed", len(audits), analyzed)
+	}
+
+	want := map[string]betteralign.StructAudit{
+		"Good": {Size: 8, Align: 4, Padding: 2, OptimalSize: 8, Optimal: true},
+		"Bad":  {Size: 12, Align: 4, Padding: 6, OptimalSize: 8},
+	}
+
+	for _, a := range audits {
+		w, ok := want[a.Struct]
+		if !ok {
+			continue
+		}
+
+		delete(want, a.Struct)
+
+		if a.Size != w.Size || a.Align != w.Align || a.Padding != w.Padding || a.OptimalSize != w.OptimalSize ||
+			a.Optimal != w.Optimal {
+			t.Errorf("%s: got %+v, want %+v", a.Struct, a, w)
+		}
+	}
+
+	for name := range want {
+		t.Errorf("struct %s not audited", name)
+	}
+}
+
+func TestSetFindingHandler(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		streamed []betteralign.Finding
+	)
+
+	betteralign.SetFindingHandler(func(f betteralign.Finding) {
+		mu.Lock()
+		streamed = append(streamed, f)
+		mu.Unlock()
+	})
+	defer betteralign.SetFindingHandler(nil)
+
+	testdata := analysistest.TestData()
+	results := analysistest.Run(t, testdata, NewTestAnalyzer(), "a")
+
+	var findings int
+	for _, r := range results {
+		findings += len(r.Result.(*betteralign.Result).Findings)
+	}
+
+	if findings == 0 || len(streamed) != findings {
+		t.Errorf("handler got %d findings, want all %d recorded", len(streamed), findings)
+	}
+}
+
+func TestResultTiming(t *testing.T) {
+	testdata := analysistest.TestData()
+	results := analysistest.Run(t, testdata, NewTestAnalyzer(), "a")
+
+	for _, r := range results {
+		timing := r.Result.(*betteralign.Result).Timing
+		if timing.Inspect <= 0 || timing.Print != 0 || timing.Write != 0 {
+			t.Errorf("%s: expected only inspect time without apply, got %+v", r.Pass.Pkg.Path(), timing)
+		}
+	}
+}
+
+func TestFlagPlan(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(dir, "src", "plan"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	src := `package plan
+
+type Good struct {
+	b int64
+	a bool
+}
+
+type Plan struct { // want "struct of size 24 could be 16"
+	a bool // flag
+	b int64
+	c bool
+}
+`
+	writePackageFile(t, dir, "plan", "plan.go", src)
+
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("plan", filepath.Join(dir, "plan.json"))
+	results := analysistest.Run(t, dir, analyzer, "plan")
+
+	var pkgResults []*betteralign.Result
+	for _, r := range results {
+		pkgResults = append(pkgResults, r.Result.(*betteralign.Result))
+	}
+
+	plans := betteralign.AllPlans(pkgResults)
+	if len(plans) != 1 {
+		t.Fatalf("AllPlans() = %+v, want 1 plan", plans)
+	}
+
+	p := plans[0]
+	if p.Struct != "Plan" || !slices.Equal(p.OriginalOrder, []int{0, 1, 2}) || !slices.Equal(p.Order, []int{1, 0, 2}) {
+		t.Errorf("AllPlans() = %+v, want Plan reordered from [0 1 2] to [1 0 2]", p)
+	}
+
+	if got := src[p.Start:p.End]; got != p.Original || !strings.HasPrefix(got, "struct {") {
+		t.Errorf("source at offsets %d-%d = %q, want original %q", p.Start, p.End, got, p.Original)
+	}
+
+	want := "struct { // want \"struct of size 24 could be 16\"\n\tb int64\n\ta bool // flag\n\tc bool\n}"
+	if p.Rewritten != want {
+		t.Errorf("rewritten = %q, want %q", p.Rewritten, want)
+	}
+}
+
+func TestFlagBaseline(t *testing.T) {
+	defer betteralign.Reset()
+
+	dir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(dir, "src", "baseline"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	writePackageFile(t, dir, "baseline", "baseline.go", `package baseline
+
+type Legacy struct {
+	a bool
+	b int64
+	c bool
+}
+
+type New struct { // want "struct of size 24 could be 16"
+	a bool
+	b int64
+	c bool
+}
+`)
+
+	fn := filepath.Join(dir, "baseline.jsonl")
+	if err := os.WriteFile(fn, []byte(`{"package": "baseline", "struct": "Legacy"}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("baseline", fn)
+	results := analysistest.Run(t, dir, analyzer, "baseline")
+
+	for _, r := range results {
+		for _, f := range r.Result.(*betteralign.Result).Findings {
+			if f.Struct != "New" {
+				t.Errorf("expected only New to be reported, got %s", f.Struct)
+			}
+		}
+	}
+}
+
+func TestSetFlag(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+
+	if err := betteralign.SetFlag("explain", "true"); err != nil {
+		t.Fatal(err)
+	}
+	defer betteralign.SetFlag("explain", "false")
+
+	for _, r := range analysistest.Run(t, testdata, analyzer, "a") {
+		for _, f := range r.Result.(*betteralign.Result).Findings {
+			if f.Saved() > 0 && !strings.Contains(f.Message, "; padding: ") {
+				t.Errorf("%s: expected explained padding, got %q", f.Struct, f.Message)
+			}
+		}
+	}
+
+	if err := betteralign.SetFlag("no_such_flag", "true"); !errors.Is(err, betteralign.ErrUnknownFlag) {
+		t.Errorf("expected ErrUnknownFlag, got %v", err)
+	}
+
+	if err := betteralign.SetFlag("max_size", "many"); err == nil {
+		t.Error("expected an error for an invalid value")
+	}
+}
+
+func TestTopFindings(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	results := analysistest.Run(t, testdata, analyzer, "a")
+
+	var pkgResults []*betteralign.Result
+	for _, r := range results {
+		pkgResults = append(pkgResults, r.Result.(*betteralign.Result))
+	}
+
+	top := betteralign.TopFindings(pkgResults, 3)
+	if len(top) != 3 {
+		t.Fatalf("expected 3 findings, got %d", len(top))
+	}
+
+	for i, want := range []string{"MultiField", "s4", "s9"} {
+		if top[i].Struct != want || top[i].Saved() != 16 {
+			t.Errorf("finding %d: expected %s saving 16 bytes, got %s saving %d bytes", i, want, top[i].Struct,
+				top[i].Saved())
+		}
+	}
+}
+
+func TestSummaryByWaste(t *testing.T) {
+	summary := betteralign.Summarize([]*betteralign.Result{
+		{Package: "a", Analyzed: 2, Findings: []betteralign.Finding{{Size: 12, OptimalSize: 8}}},
+		{Package: "b", Analyzed: 1},
+		{Package: "c", Analyzed: 1, Findings: []betteralign.Finding{{Size: 24, OptimalSize: 16}}},
+		{Package: "a", Analyzed: 2, Findings: []betteralign.Finding{{PtrBytes: 16, OptimalPtrBytes: 8}}},
+	})
+
+	pkgs := summary.ByWaste()
+	if len(pkgs) != 2 {
+		t.Fatalf("expected 2 packages, got %d", len(pkgs))
+	}
+
+	if pkgs[0].Package != "c" || pkgs[1].Package != "a" || pkgs[1].Suboptimal != 2 || pkgs[1].PtrBytesSaved != 8 {
+		t.Errorf("unexpected package order or totals: %+v", pkgs)
+	}
+}
+
+func TestSummaryBadge(t *testing.T) {
+	for saved, want := range map[int64]betteralign.Badge{
+		0:     {Message: "0 B", Color: "brightgreen"},
+		8:     {Message: "8 B", Color: "yellow"},
+		12698: {Message: "12.4 KiB", Color: "orange"},
+	} {
+		summary := betteralign.Summarize([]*betteralign.Result{
+			{Package: "a", Analyzed: 1, Findings: []betteralign.Finding{{Size: 16 + saved, OptimalSize: 16}}},
+		})
+
+		want.SchemaVersion, want.Label = 1, "struct padding waste"
+		if got := summary.Badge(); got != want {
+			t.Errorf("%d bytes saved: expected badge %+v, got %+v", saved, want, got)
+		}
+	}
+}
+
+func TestSummaryWriteMetrics(t *testing.T) {
+	summary := betteralign.Summarize([]*betteralign.Result{
+		{Package: "example.com/a", Analyzed: 3, Findings: []betteralign.Finding{{Size: 24, OptimalSize: 16}}},
+		{Package: `example.com/"b"`, Analyzed: 1},
+	})
+
+	var buf bytes.Buffer
+	if err := summary.WriteMetrics(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"# TYPE betteralign_structs_suboptimal gauge\n",
+		`betteralign_structs_analyzed{package="example.com/a"} 3` + "\n",
+		`betteralign_structs_suboptimal{package="example.com/\"b\""} 0` + "\n",
+		`betteralign_bytes_wasted_total{package="example.com/a"} 8` + "\n",
+		`betteralign_pointer_bytes_wasted_total{package="example.com/a"} 0` + "\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected metrics to contain %q, got\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestComputeStats(t *testing.T) {
+	stats := betteralign.ComputeStats([]*betteralign.Result{
+		{Audit: []betteralign.StructAudit{
+			{Package: "a", Size: 24, Padding: 14, OptimalSize: 16},
+			{Package: "a", Size: 8, Optimal: true},
+		}},
+		{Audit: []betteralign.StructAudit{{Package: "b", Size: 40, Padding: 16, OptimalSize: 24}}},
+		{Audit: []betteralign.StructAudit{{Package: "c", Size: 16, Padding: 4, Optimal: true}}},
+	}, 1)
+
+	want := betteralign.PackageStats{Structs: 4, Suboptimal: 2, Bytes: 88, PaddingBytes: 34, RecoverableBytes: 24}
+	if stats.PackageStats != want {
+		t.Errorf("expected totals %+v, got %+v", want, stats.PackageStats)
+	}
+
+	if len(stats.TopPackages) != 1 || stats.TopPackages[0].Package != "b" || stats.TopPackages[0].RecoverableBytes != 16 {
+		t.Errorf("expected only package b as top package, got %+v", stats.TopPackages)
+	}
+}
+
+func TestCompareFindings(t *testing.T) {
+	baseline, err := betteralign.ReadFindings(strings.NewReader(`[
+		{"package": "a", "struct": "Kept", "pos": {"Filename": "a.go", "Line": 3}},
+		{"package": "a", "struct": "Fixed", "pos": {"Filename": "a.go", "Line": 9}}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := betteralign.ReadFindings(strings.NewReader(
+		`{"package": "a", "struct": "Kept", "pos": {"Filename": "a.go", "Line": 5}}` + "\n" +
+			`{"package": "b", "struct": "Kept", "pos": {"Filename": "b.go", "Line": 1}}` + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := betteralign.CompareFindings(baseline, current)
+
+	if len(c.Introduced) != 1 || c.Introduced[0].Package != "b" {
+		t.Errorf("expected b.Kept to be introduced, got %+v", c.Introduced)
+	}
+
+	if len(c.Fixed) != 1 || c.Fixed[0].Struct != "Fixed" {
+		t.Errorf("expected a.Fixed to be fixed, got %+v", c.Fixed)
+	}
+}
+
+func TestWasteHistogram(t *testing.T) {
+	var findings []betteralign.Finding
+	for _, saved := range []int64{0, 4, 8, 8, 9, 100} {
+		findings = append(findings, betteralign.Finding{Size: 16 + saved, OptimalSize: 16})
+	}
+
+	var buf bytes.Buffer
+
+	buckets := betteralign.WasteHistogram([]*betteralign.Result{{Package: "a", Findings: findings}})
+	if err := betteralign.WriteHistogram(&buf, buckets); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `bytes saved  structs
+1-8          3  ########################################
+9-16         1  ##############
+17-64        0
+65+          1  ##############
+`
+	if buf.String() != want {
+		t.Errorf("expected histogram\n%s\ngot\n%s", want, buf.String())
+	}
+}
+
+func TestFlagImpact(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("impact", "true")
+	analysistest.Run(t, testdata, analyzer, "impact")
+}
+
+func TestArrayAmplification(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, NewTestAnalyzer(), "array")
+}
+
+func TestAssert(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, NewTestAnalyzer(), "assert")
+}
+
+func TestFlagAssertFile(t *testing.T) {
+	dir := t.TempDir()
+
+	src, err := os.ReadFile(filepath.Join(analysistest.TestData(), "src", "assert", "assert.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "src", "assert"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "src", "assert", "assert.go"), src, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("assert_file", "true")
+	analysistest.Run(t, dir, analyzer, "assert")
+
+	got, err := os.ReadFile(filepath.Join(dir, "src", "assert", "betteralign_assert.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden.Assert(t, string(got), "assert.golden")
+}
+
+func TestFlagMaxSize(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("max_size", "64")
+	analysistest.Run(t, testdata, analyzer, "maxsize")
+}
+
+func TestFlagSplitSize(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("split_size", "256")
+	analysistest.Run(t, testdata, analyzer, "split")
+}
+
+func TestFlagSoA(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("soa", "1024")
+	analysistest.Run(t, testdata, analyzer, "soa")
+}
+
+func TestFacts(t *testing.T) {
+	betteralign.SetFacts(true)
+	defer betteralign.SetFacts(false)
+
+	testdata := analysistest.TestData()
+	analysistest.Run(t, testdata, betteralign.FactsAnalyzer, "facts/dep", "facts")
+}
+
+// suboptimalStruct is the body of a struct of size 24 that could be 16.
+const suboptimalStruct = "struct {\n\ta bool\n\tb int64\n\tc bool\n}\n"
+
+// wantSuboptimal is suboptimalStruct expecting its diagnostic.
+var wantSuboptimal = strings.Replace(suboptimalStruct, "{", "{ // want \"struct of size 24 could be 16\"", 1)
+
+// initGitPackage commits files of package pkg into a new git repository and returns its directory, usable as
+// analysistest data directory.
+func initGitPackage(t *testing.T, pkg string, files map[string]string) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(dir, "src", pkg), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, src := range files {
+		writePackageFile(t, dir, pkg, name, src)
+	}
+
+	for _, args := range [][]string{{"init", "-q"}, {"add", "."}, {"commit", "-q", "-m", "initial"}} {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"},
+			args...)...)
+		cmd.Dir = dir
+
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+
+	return dir
+}
+
+// writePackageFile writes src into file name of package pkg in analysistest data directory dir.
+func writePackageFile(t *testing.T, dir, pkg, name, src string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(dir, "src", pkg, name), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileScope(t *testing.T) {
+	defer betteralign.SetFileScope(nil)
+
+	dir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(dir, "src", "scope"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	writePackageFile(t, dir, "scope", "in.go", "package scope\n\ntype In "+wantSuboptimal)
+	writePackageFile(t, dir, "scope", "out.go", "package scope\n\ntype Out "+suboptimalStruct)
+
+	real, err := filepath.EvalSymlinks(filepath.Join(dir, "src", "scope"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	betteralign.SetFileScope(map[string]bool{filepath.Join(real, "in.go"): true})
+	analysistest.Run(t, dir, NewTestAnalyzer(), "scope")
+}
+
+func TestFlagFixScope(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, pkg := range []string{"fixscope/hot", "fixscope/cold"} {
+		if err := os.MkdirAll(filepath.Join(dir, "src", pkg), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		writePackageFile(t, dir, pkg, "types.go", "package "+filepath.Base(pkg)+"\n\ntype T "+wantSuboptimal)
+	}
+
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("apply", "true")
+	analyzer.Flags.Set("fix_scope", filepath.Join(dir, "src", "fixscope", "hot")+"/...")
+	analysistest.Run(t, dir, analyzer, "fixscope/hot", "fixscope/cold")
+
+	for pkg, fixed := range map[string]bool{"hot": true, "cold": false} {
+		got, err := os.ReadFile(filepath.Join(dir, "src", "fixscope", pkg, "types.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Contains(string(got), "\tb int64\n\ta bool\n") != fixed {
+			t.Errorf("%s fixed = %v, want %v:\n%s", pkg, !fixed, fixed, got)
+		}
+	}
+}
+
+func TestFlagChangedOnly(t *testing.T) {
+	dir := initGitPackage(t, "changed", map[string]string{
+		"legacy.go":   "package changed\n\ntype Legacy " + suboptimalStruct,
+		"modified.go": "package changed\n",
+	})
+
+	writePackageFile(t, dir, "changed", "modified.go", "package changed\n\ntype Modified "+wantSuboptimal)
+	writePackageFile(t, dir, "changed", "added.go", "package changed\n\ntype Added "+wantSuboptimal)
+
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("changed_only", "HEAD")
+	analysistest.Run(t, dir, analyzer, "changed")
+}
+
+func TestFlagChangedLines(t *testing.T) {
+	dir := initGitPackage(t, "hunks", map[string]string{
+		"hunks.go": "package hunks\n\ntype Legacy " + suboptimalStruct + "\ntype Modified " + suboptimalStruct,
+	})
+
+	writePackageFile(t, dir, "hunks", "hunks.go", "package hunks\n\ntype Legacy "+suboptimalStruct+
+		"\ntype Modified "+strings.Replace(wantSuboptimal, "c bool", "c bool // changed", 1))
+	writePackageFile(t, dir, "hunks", "added.go", "package hunks\n\ntype Added "+wantSuboptimal)
+
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("changed_only", "HEAD")
+	analyzer.Flags.Set("changed_lines", "true")
+	analysistest.Run(t, dir, analyzer, "hunks")
+}
+
+func TestInGoroot(t *testing.T) {
+	out, err := exec.Command("go", "env", "GOROOT").Output()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	goroot := strings.TrimSpace(string(out))
+
+	for fn, want := range map[string]bool{
+		filepath.Join(goroot, "src", "sync", "mutex.go"):           true,
+		goroot + "-other" + string(filepath.Separator) + "file.go": false,
+		filepath.Join("testdata", "src", "a", "a.go"):              false,
+	} {
+		if got := betteralign.InGoroot(fn); got != want {
+			t.Errorf("InGoroot(%s) = %v, want %v", fn, got, want)
+		}
+	}
+}
+
+func TestGitIgnore(t *testing.T) {
+	dir := initGitPackage(t, "ignored", map[string]string{
+		"tracked.go": "package ignored\n\ntype Tracked " + wantSuboptimal,
+	})
+
+	if err := os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*_output.go\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	writePackageFile(t, dir, "ignored", "build_output.go", "package ignored\n\ntype Output "+suboptimalStruct)
+
+	analysistest.Run(t, dir, NewTestAnalyzer(), "ignored")
+}
+
+func TestFlagNoGitIgnore(t *testing.T) {
+	dir := initGitPackage(t, "ignored", map[string]string{
+		"tracked.go": "package ignored\n\ntype Tracked " + wantSuboptimal,
+	})
+
+	if err := os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*_output.go\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	writePackageFile(t, dir, "ignored", "build_output.go", "package ignored\n\ntype Output "+wantSuboptimal)
+
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("no_gitignore", "true")
+	analysistest.Run(t, dir, analyzer, "ignored")
+}
+
+func TestFlagApplySymlinks(t *testing.T) {
+	for _, follow := range []bool{false, true} {
+		dir := t.TempDir()
+		target := filepath.Join(dir, "linked.go")
+		src := "package linked\n\ntype Linked " + wantSuboptimal
+
+		if err := os.WriteFile(target, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.MkdirAll(filepath.Join(dir, "src", "linked"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		link := filepath.Join(dir, "src", "linked", "linked.go")
+		if err := os.Symlink(target, link); err != nil {
+			t.Skip(err)
+		}
+
+		analyzer := NewTestAnalyzer()
+		analyzer.Flags.Set("apply", "true")
+		analyzer.Flags.Set("apply_symlinks", fmt.Sprint(follow))
+		analysistest.Run(t, dir, analyzer, "linked")
+
+		if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("apply_symlinks=%v: symlink replaced: %v", follow, err)
+		}
+
+		got, err := os.ReadFile(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fixed := string(got) != src; fixed != follow {
+			t.Errorf("apply_symlinks=%v: symlink target fixed = %v", follow, fixed)
+		}
+
+		errs := betteralign.OperationalErrors()
+		if reported := len(errs) == 1 && errs[0].Stage == betteralign.StageApply && errs[0].Path == link; reported == follow {
+			t.Errorf("apply_symlinks=%v: operational errors = %v", follow, errs)
+		}
+	}
+}
+
+func TestFlagPreserveMtime(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(dir, "src", "mtime"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	writePackageFile(t, dir, "mtime", "mtime.go", "package mtime\n\ntype Mtime "+wantSuboptimal)
+
+	fn := filepath.Join(dir, "src", "mtime", "mtime.go")
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	if err := os.Chtimes(fn, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("apply", "true")
+	analyzer.Flags.Set("preserve_mtime", "true")
+	analysistest.Run(t, dir, analyzer, "mtime")
+
+	fi, err := os.Stat(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !fi.ModTime().Equal(mtime) {
+		t.Errorf("modification time = %v, want %v", fi.ModTime(), mtime)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	defer betteralign.SetOutput(betteralign.DiskOutput{})
+
+	src := "package output\n\ntype Output " + wantSuboptimal
+	root := t.TempDir()
+
+	for _, output := range []betteralign.Output{&betteralign.MemOutput{}, betteralign.DirOutput{Root: root}} {
+		dir := t.TempDir()
+
+		if err := os.MkdirAll(filepath.Join(dir, "src", "output"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		writePackageFile(t, dir, "output", "output.go", src)
+
+		betteralign.SetOutput(output)
+
+		analyzer := NewTestAnalyzer()
+		analyzer.Flags.Set("apply", "true")
+		analysistest.Run(t, dir, analyzer, "output")
+
+		fn := filepath.Join(dir, "src", "output", "output.go")
+
+		if got, err := os.ReadFile(fn); err != nil || string(got) != src {
+			t.Errorf("%T: original file rewritten: %v", output, err)
+		}
+
+		var got []byte
+
+		switch o := output.(type) {
+		case *betteralign.MemOutput:
+			got = o.Files()[fn]
+		case betteralign.DirOutput:
+			got, _ = os.ReadFile(filepath.Join(root, fn))
+		}
+
+		if !strings.Contains(string(got), "b int64\n\ta bool") {
+			t.Errorf("%T: rewritten file = %q", output, got)
+		}
+	}
+}
+
+func TestApplyHook(t *testing.T) {
+	defer betteralign.SetApplyHook(nil)
+
+	src := "package hook\n\ntype Hook " + wantSuboptimal
+
+	for _, hookErr := range []error{nil, betteralign.ErrSkipWrite} {
+		dir := t.TempDir()
+
+		if err := os.MkdirAll(filepath.Join(dir, "src", "hook"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		writePackageFile(t, dir, "hook", "hook.go", src)
+
+		var calls int
+
+		betteralign.SetApplyHook(func(path string, original, rewritten []byte) error {
+			calls++
+
+			if string(original) != src || string(rewritten) == src {
+				t.Errorf("hook(%s) got unexpected original %q or rewritten %q", path, original, rewritten)
+			}
+
+			return hookErr
+		})
+
+		analyzer := NewTestAnalyzer()
+		analyzer.Flags.Set("apply", "true")
+		analysistest.Run(t, dir, analyzer, "hook")
+
+		if calls != 1 {
+			t.Errorf("hook called %d times, want 1", calls)
+		}
+
+		got, err := os.ReadFile(filepath.Join(dir, "src", "hook", "hook.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if written := string(got) != src; written != (hookErr == nil) {
+			t.Errorf("hook returning %v: file written = %v", hookErr, written)
+		}
+	}
+}
+
+func TestFlagDryRun(t *testing.T) {
+	dir := t.TempDir()
+	src := "package dryrun\n\ntype DryRun " + wantSuboptimal
+
+	if err := os.MkdirAll(filepath.Join(dir, "src", "dryrun"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	writePackageFile(t, dir, "dryrun", "dryrun.go", src)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("apply", "true")
+	analyzer.Flags.Set("dry_run", "true")
+	analysistest.Run(t, dir, analyzer, "dryrun")
+
+	os.Stdout = stdout
+	w.Close()
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fn := filepath.Join(dir, "src", "dryrun", "dryrun.go")
+	if want := fn + ": would fix 1 structs, 8 bytes saved, 0 pointer bytes saved\n"; string(out) != want {
+		t.Errorf("dry run output = %q, want %q", out, want)
+	}
+
+	if got, err := os.ReadFile(fn); err != nil || string(got) != src {
+		t.Errorf("dry run rewrote file: %v", err)
+	}
+}
+
+func TestReorderFields(t *testing.T) {
+	src := "package p\n\n// T is a struct.\ntype T struct {\n\ta bool // a\n\tb int64 // b\n\tc bool // c\n}\n"
+	want := "package p\n\n// T is a struct.\ntype T struct {\n\tb int64 // b\n\ta bool  // a\n\tc bool  // c\n}\n"
+
+	got, err := betteralign.ReorderFields("p.go", []byte(src), strings.Index(src, "struct {"), []int{1, 0, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != want {
+		t.Errorf("ReorderFields() = %q, want %q", got, want)
+	}
+
+	if _, err := betteralign.ReorderFields("p.go", []byte(src), 0, []int{1, 0, 2}); err == nil {
+		t.Error("ReorderFields() at offset without struct succeeded")
+	}
+
+	if _, err := betteralign.ReorderFields("p.go", []byte(src), strings.Index(src, "struct {"), []int{1, 0}); err == nil {
+		t.Error("ReorderFields() with mismatched order succeeded")
+	}
+}
+
+func TestReorderStructs(t *testing.T) {
+	src := "package p\n\ntype T struct { \n\ta bool\n\tb int64\n}\n\ntype U struct {\n\tc bool\n\td *int\n}\n"
+	want := "package p\n\ntype T struct {\n\tb int64\n\ta bool\n}\n\ntype U struct {\n\td *int\n\tc bool\n}\n"
+
+	orders := map[int][]int{
+		strings.Index(src, "struct { "):      {1, 0},
+		strings.LastIndex(src, "struct {\n"): {1, 0},
+	}
+
+	got, err := betteralign.ReorderStructs("p.go", []byte(src), orders)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != want {
+		t.Errorf("ReorderStructs() = %q, want %q", got, want)
+	}
+}
+
+func TestAnalyzeSnippet(t *testing.T) {
+	src := "import \"sync\"\n\ntype T struct {\n\ta  bool\n\tmu sync.Mutex\n\tb  bool\n}\n"
+	want := "import \"sync\"\n\ntype T struct {\n\tmu sync.Mutex\n\ta  bool\n\tb  bool\n}\n"
+
+	got, err := betteralign.AnalyzeSnippet(src, "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Errors) != 0 {
+		t.Fatalf("AnalyzeSnippet() errors = %v", got.Errors)
+	}
+
+	if got.Source != want {
+		t.Errorf("AnalyzeSnippet() source = %q, want %q", got.Source, want)
+	}
+
+	if len(got.Structs) != 1 || got.Structs[0].Size != 16 || got.Structs[0].OptimalSize != 12 {
+		t.Errorf("AnalyzeSnippet() structs = %+v, want T of size 16 could be 12", got.Structs)
+	}
+
+	if _, err := betteralign.AnalyzeSnippet(src, "nonexistent"); !errors.Is(err, betteralign.ErrUnknownArch) {
+		t.Errorf("AnalyzeSnippet() with unknown architecture error = %v, want %v", err, betteralign.ErrUnknownArch)
+	}
+}
+
+func TestSizesMatrix(t *testing.T) {
+	src := `import "sync/atomic"
+
+type Padded struct {
+	a bool
+	b int64
+	c bool
+}
+
+type Floats struct {
+	a bool
+	b float64
+	c complex64
+	d complex128
+}
+
+type Words struct {
+	s string
+	i any
+	u uintptr
+	n int
+	e struct{}
+}
+
+type ZeroTail struct {
+	a int32
+	z [0]int64
+}
+
+type Atomic struct {
+	a bool
+	x atomic.Int64
+	b bool
+}
+
+type Pointers struct {
+	f  func()
+	m  map[int]int
+	ch chan int
+	s  []byte
+}
+`
+
+	// sizes and alignments as computed by the gc compiler for each architecture
+	type layout struct{ size, align int64 }
+
+	tests := []struct {
+		arch    string
+		layouts []layout
+	}{
+		{"amd64", []layout{{24, 8}, {40, 8}, {56, 8}, {16, 8}, {24, 8}, {48, 8}}},
+		{"arm64", []layout{{24, 8}, {40, 8}, {56, 8}, {16, 8}, {24, 8}, {48, 8}}},
+		{"wasm", []layout{{24, 8}, {40, 8}, {56, 8}, {16, 8}, {24, 8}, {48, 8}}},
+		{"386", []layout{{16, 4}, {36, 4}, {28, 4}, {8, 4}, {24, 8}, {24, 4}}},
+		{"arm", []layout{{16, 4}, {36, 4}, {28, 4}, {8, 4}, {24, 8}, {24, 4}}},
+		{"mips", []layout{{16, 4}, {36, 4}, {28, 4}, {8, 4}, {24, 8}, {24, 4}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arch, func(t *testing.T) {
+			got, err := betteralign.AnalyzeSnippet(src, tt.arch)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got.Errors) != 0 {
+				t.Fatalf("AnalyzeSnippet() errors = %v", got.Errors)
+			}
+
+			structs := make(map[string]betteralign.SnippetStruct)
+			for _, st := range got.Structs {
+				structs[st.Name] = st
+			}
+
+			for i, name := range []string{"Padded", "Floats", "Words", "ZeroTail", "Atomic", "Pointers"} {
+				st, want := structs[name], tt.layouts[i]
+				if st.Size != want.size || st.Align != want.align {
+					t.Errorf("%s: size %d, align %d, want %d, %d", name, st.Size, st.Align, want.size, want.align)
+				}
+			}
+		})
+	}
+}
+
+func TestFlagHeapProfile(t *testing.T) {
+	testdata := analysistest.TestData()
+	analyzer := NewTestAnalyzer()
+	analyzer.Flags.Set("heapprofile", filepath.Join(testdata, "heap.pb.gz"))
+	analysistest.Run(t, testdata, analyzer, "heap")
+}
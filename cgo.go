@@ -0,0 +1,94 @@
+package betteralign
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strings"
+)
+
+// cgoPrefixes are identifier prefixes cgo uses when rewriting references to the "C" pseudo-package.
+var cgoPrefixes = []string{"_Ctype_", "_Cfunc_", "_Cvar_", "_Cmacro_", "_Cgo_"}
+
+// cgoGeneratedComment is the banner cmd/cgo puts in front of all files it produces.
+const cgoGeneratedComment = "Code generated by cmd/cgo"
+
+// cgoRewritePos returns the position of the first identifier rewritten by cgo, or token.NoPos if there is none.
+func cgoRewritePos(f *ast.File) token.Pos {
+	var pos token.Pos
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && isCgoName(id.Name) {
+			pos = id.Pos()
+		}
+
+		return !pos.IsValid()
+	})
+
+	return pos
+}
+
+// isCgoName reports whether name is an identifier produced by cgo.
+func isCgoName(name string) bool {
+	for _, prefix := range cgoPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isCgoGeneratedFile reports whether the file was produced by cgo, either by its well known names (_cgo_gotypes.go,
+// _cgo_import.go, x.cgo1.go), by the cmd/cgo banner or by containing cgo-rewritten identifiers.
+func isCgoGeneratedFile(fn string, f *ast.File) bool {
+	base := filepath.Base(fn)
+	if strings.HasPrefix(base, "_cgo_") || strings.HasSuffix(base, ".cgo1.go") || strings.HasSuffix(base, ".cgo2.go") {
+		return true
+	}
+
+	for _, cg := range f.Comments {
+		if cg.Pos() > f.Package {
+			break
+		}
+
+		for _, l := range cg.List {
+			if strings.Contains(l.Text, cgoGeneratedComment) {
+				return true
+			}
+		}
+	}
+
+	return cgoRewritePos(f).IsValid()
+}
+
+// cgoMirrorField returns the first field of typ having a C type (directly or through pointers and arrays), which
+// means the struct mirrors a C definition, or nil if there is none.
+func cgoMirrorField(typ *types.Struct) *types.Var {
+	for i := 0; i < typ.NumFields(); i++ {
+		if isCgoType(typ.Field(i).Type()) {
+			return typ.Field(i)
+		}
+	}
+
+	return nil
+}
+
+// isCgoType reports whether t refers to a type from the "C" pseudo-package.
+func isCgoType(t types.Type) bool {
+	for {
+		switch u := types.Unalias(t).(type) {
+		case *types.Pointer:
+			t = u.Elem()
+		case *types.Array:
+			t = u.Elem()
+		case *types.Named:
+			obj := u.Obj()
+
+			return isCgoName(obj.Name()) || (obj.Pkg() != nil && obj.Pkg().Path() == "C")
+		default:
+			return false
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package betteralign
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	changedOnce  sync.Once
+	changedFiles map[string]bool
+	changedHunks map[string][][2]int
+	realNames    sync.Map
+)
+
+// ChangedFiles returns absolute names of files changed relative to the changed_only base ref in the git work tree
+// containing dir, including untracked files. It returns false when changed_only is not used or git fails, in which
+// case all files are analyzed. Files are listed once per run.
+func ChangedFiles(dir string) (map[string]bool, bool) {
+	if changedOnly == "" {
+		return nil, false
+	}
+
+	changedOnce.Do(func() {
+		var err error
+		if changedFiles, err = listChangedFiles(dir, changedOnly); err != nil {
+			ReportError(StageGitDiff, dir, fmt.Errorf("%v %s: %w, analyzing all files", ErrGitDiff, changedOnly, err))
+
+			return
+		}
+
+		if changedLines {
+			if changedHunks, err = listChangedLines(dir, changedOnly); err != nil {
+				ReportError(StageGitDiff, dir, fmt.Errorf("%v %s: %w, analyzing all files", ErrGitDiff, changedOnly, err))
+				changedFiles = nil
+			}
+		}
+	})
+
+	return changedFiles, changedFiles != nil
+}
+
+// isUnchanged reports whether file fn is unchanged relative to the changed_only base ref.
+func isUnchanged(fn string) bool {
+	files, ok := ChangedFiles(filepath.Dir(fn))
+
+	return ok && !files[realName(fn)]
+}
+
+// isUnchangedDecl reports whether lines from start to end of file fn are unchanged relative to the changed_only
+// base ref, when changed_lines is used.
+func isUnchangedDecl(fn string, start, end int) bool {
+	if _, ok := ChangedFiles(filepath.Dir(fn)); !ok || changedHunks == nil {
+		return false
+	}
+
+	for _, h := range changedHunks[realName(fn)] {
+		if h[0] <= end && start <= h[1] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ChangeState describes how file fn differs from the changed_only base ref: empty when all files are analyzed,
+// "unchanged", or "changed" followed by its changed line ranges with changed_lines. Results depend on it besides
+// file contents, so caching drivers include it in their cache keys.
+func ChangeState(fn string) string {
+	files, ok := ChangedFiles(filepath.Dir(fn))
+	if !ok {
+		return ""
+	}
+
+	if !files[realName(fn)] {
+		return "unchanged"
+	}
+
+	return fmt.Sprint("changed", changedHunks[realName(fn)])
+}
+
+// realName returns fn with symlinks resolved, as git reports them.
+func realName(fn string) string {
+	if changedFiles[fn] {
+		return fn
+	}
+
+	real, ok := realNames.Load(fn)
+	if !ok {
+		name, err := filepath.EvalSymlinks(fn)
+		if err != nil {
+			name = fn
+		}
+
+		real, _ = realNames.LoadOrStore(fn, name)
+	}
+
+	return real.(string)
+}
+
+// listChangedFiles lists files of the git work tree containing dir that differ from base or are untracked.
+func listChangedFiles(dir, base string) (map[string]bool, error) {
+	top, err := gitOutput(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := gitOutput(dir, "diff", "--name-only", base, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	untracked, err := gitOutput(dir, "ls-files", "--others", "--exclude-standard", "--full-name")
+	if err != nil {
+		return nil, err
+	}
+
+	root := strings.TrimSpace(top)
+	files := make(map[string]bool)
+
+	for _, name := range strings.Fields(diff + "\n" + untracked) {
+		files[filepath.Join(root, filepath.FromSlash(name))] = true
+	}
+
+	return files, nil
+}
+
+// listChangedLines returns line ranges of added or modified lines of files changed relative to base, with
+// untracked files changed as a whole. For hunks only deleting lines, the lines around the deletion count as changed.
+func listChangedLines(dir, base string) (map[string][][2]int, error) {
+	top, err := gitOutput(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := gitOutput(dir, "diff", "--unified=0", "--no-color", "--no-ext-diff", base, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	untracked, err := gitOutput(dir, "ls-files", "--others", "--exclude-standard", "--full-name")
+	if err != nil {
+		return nil, err
+	}
+
+	root := strings.TrimSpace(top)
+	hunks := make(map[string][][2]int)
+
+	for _, name := range strings.Fields(untracked) {
+		hunks[filepath.Join(root, filepath.FromSlash(name))] = [][2]int{{1, math.MaxInt}}
+	}
+
+	var fn string
+
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			fn = ""
+			if name, ok := strings.CutPrefix(line, "+++ b/"); ok {
+				fn = filepath.Join(root, filepath.FromSlash(name))
+			}
+		case strings.HasPrefix(line, "@@ ") && fn != "":
+			// @@ -a,b +c,d @@
+			fields := strings.Fields(line)
+			if len(fields) < 3 {
+				continue
+			}
+
+			first, n, hasCount := strings.Cut(strings.TrimPrefix(fields[2], "+"), ",")
+
+			start, err := strconv.Atoi(first)
+			if err != nil {
+				continue
+			}
+
+			count := 1
+			if hasCount {
+				if count, err = strconv.Atoi(n); err != nil {
+					continue
+				}
+			}
+
+			if count == 0 {
+				hunks[fn] = append(hunks[fn], [2]int{start, start + 1})
+			} else {
+				hunks[fn] = append(hunks[fn], [2]int{start, start + count - 1})
+			}
+		}
+	}
+
+	return hunks, nil
+}
+
+// gitOutput runs git with args in dir and returns its standard output.
+func gitOutput(dir string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+
+	return string(out), nil
+}
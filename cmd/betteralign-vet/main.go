@@ -0,0 +1,70 @@
+// Command betteralign-vet runs the betteralign analyzer as a go vet tool, reusing the build cache of go vet and its
+// JSON diagnostics protocol, with layout facts of imported packages passed between units:
+//
+//	go vet -vettool=$(which betteralign-vet) ./...
+//
+// Analyzer flags are given with the analyzer name as prefix, such as -betteralign.test_files. Fixes are better
+// applied with betteralign itself, since go vet analyzes a package and its test variant in separate processes.
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/dkorunic/betteralign"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/unitchecker"
+)
+
+// unitConfig is the part of the unit configuration written by go vet which is handled before unitchecker runs.
+type unitConfig struct {
+	Stdout   string // since Go 1.26, file to write JSON diagnostics to
+	VetxOnly bool   // dependency analyzed only for facts
+}
+
+func main() {
+	cfg := readUnitConfig(os.Args[1:])
+
+	// go vet runs tools with -json and reads JSON diagnostics from the Stdout file, formatting them as plain text
+	// unless go vet itself was given -json, while unitchecker of the golang.org/x/tools version in use writes them
+	// to stdout
+	if cfg.Stdout != "" {
+		f, err := os.Create(cfg.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		os.Stdout = f
+	}
+
+	// unitchecker also runs analyzers depending on fact producers for dependencies, where only facts are needed,
+	// so reports and fixes of dependencies are skipped
+	if cfg.VetxOnly {
+		betteralign.Analyzer.Run = func(pass *analysis.Pass) (any, error) {
+			return &betteralign.Result{Package: pass.Pkg.Path()}, nil
+		}
+	}
+
+	// layout facts of dependencies come with the build cache of go vet
+	betteralign.SetFacts(true)
+
+	unitchecker.Main(betteralign.Analyzer)
+}
+
+// readUnitConfig reads the unit configuration given as the last of args, if any. Errors are left to unitchecker to
+// report.
+func readUnitConfig(args []string) unitConfig {
+	var cfg unitConfig
+
+	if len(args) == 0 || !strings.HasSuffix(args[len(args)-1], ".cfg") {
+		return cfg
+	}
+
+	if data, err := os.ReadFile(args[len(args)-1]); err == nil {
+		_ = json.Unmarshal(data, &cfg)
+	}
+
+	return cfg
+}
@@ -0,0 +1,57 @@
+//go:build js && wasm
+
+// Command betteralign-wasm exposes struct layout analysis to JavaScript, for online playgrounds and editor
+// extensions running the analysis client-side. It registers globalThis.betteralign.analyze(source, goarch), which
+// returns a JSON encoded betteralign.Snippet, or a JSON object with an error member on failure. Architecture goarch
+// defaults to amd64.
+package main
+
+import (
+	"encoding/json"
+	"syscall/js"
+
+	"github.com/dkorunic/betteralign"
+)
+
+// defaultGOARCH is the target architecture of snippets analyzed without an explicit one.
+const defaultGOARCH = "amd64"
+
+func main() {
+	js.Global().Set("betteralign", js.ValueOf(map[string]any{
+		"analyze": js.FuncOf(analyze),
+	}))
+
+	// keep exported functions callable
+	select {}
+}
+
+// analyze implements betteralign.analyze(source, goarch).
+func analyze(_ js.Value, args []js.Value) any {
+	if len(args) == 0 || args[0].Type() != js.TypeString {
+		return errorJSON("analyze(source, goarch) requires source string")
+	}
+
+	goarch := defaultGOARCH
+	if len(args) > 1 && args[1].Type() == js.TypeString && args[1].String() != "" {
+		goarch = args[1].String()
+	}
+
+	snippet, err := betteralign.AnalyzeSnippet(args[0].String(), goarch)
+	if err != nil {
+		return errorJSON(err.Error())
+	}
+
+	buf, err := json.Marshal(snippet)
+	if err != nil {
+		return errorJSON(err.Error())
+	}
+
+	return string(buf)
+}
+
+// errorJSON returns a JSON object with error message msg.
+func errorJSON(msg string) string {
+	buf, _ := json.Marshal(map[string]string{"error": msg})
+
+	return string(buf)
+}
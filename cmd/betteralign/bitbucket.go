@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dkorunic/betteralign"
+)
+
+const (
+	formatBitbucket = "bitbucket"
+
+	// insightsReportID identifies the Code Insights report of a commit, so reruns replace it.
+	insightsReportID = "betteralign"
+	// insightsBatch is the maximum number of annotations created by a single request.
+	insightsBatch = 100
+	// insightsMaxAnnotations is the maximum number of annotations of a report.
+	insightsMaxAnnotations = 1000
+	// insightsSummaryLen is the maximum length of an annotation summary in characters.
+	insightsSummaryLen = 450
+	// defaultBitbucketAPI is the Bitbucket Cloud API endpoint.
+	defaultBitbucketAPI = "https://api.bitbucket.org"
+	// pipelinesAPI is the Bitbucket Cloud API endpoint reached through pipelinesProxy, which only proxies plain HTTP.
+	pipelinesAPI = "http://api.bitbucket.org"
+	// pipelinesProxy is the proxy of Bitbucket Pipelines authenticating Code Insights requests of the build.
+	pipelinesProxy = "http://localhost:29418"
+)
+
+var errNoCommit = errors.New("expected BITBUCKET_WORKSPACE, BITBUCKET_REPO_SLUG and BITBUCKET_COMMIT to be set")
+
+// insightsReport is a Bitbucket Code Insights report of a commit.
+type insightsReport struct {
+	Title      string         `json:"title"`
+	Details    string         `json:"details"`
+	ReportType string         `json:"report_type"`
+	Reporter   string         `json:"reporter"`
+	Result     string         `json:"result"`
+	Data       []insightsData `json:"data"`
+}
+
+// insightsData is a value shown next to a Code Insights report.
+type insightsData struct {
+	Title string `json:"title"`
+	Type  string `json:"type"`
+	Value int64  `json:"value"`
+}
+
+// insightsAnnotation is a Code Insights annotation of a line.
+type insightsAnnotation struct {
+	ExternalID     string `json:"external_id"`
+	AnnotationType string `json:"annotation_type"`
+	Path           string `json:"path"`
+	Summary        string `json:"summary"`
+	Details        string `json:"details"`
+	Severity       string `json:"severity"`
+	Line           int    `json:"line"`
+}
+
+// insightsPayload is the report together with its annotations, as printed by -format=bitbucket.
+type insightsPayload struct {
+	Report      insightsReport       `json:"report"`
+	Annotations []insightsAnnotation `json:"annotations"`
+}
+
+// newInsightsPayload returns the Code Insights report of results with annotations of all root diagnostics. The
+// report fails when there are any.
+func newInsightsPayload(anns []annotation, results []*betteralign.Result) insightsPayload {
+	s := betteralign.Summarize(results)
+
+	p := insightsPayload{
+		Report: insightsReport{
+			Title: "betteralign",
+			Details: fmt.Sprintf("%d of %d analyzed structs are suboptimal: %d bytes and %d pointer bytes could be saved",
+				s.Suboptimal, s.Analyzed, s.BytesSaved, s.PtrBytesSaved),
+			ReportType: "BUG",
+			Reporter:   "betteralign",
+			Result:     "PASSED",
+			Data: []insightsData{
+				{Title: "Suboptimal structs", Type: "NUMBER", Value: int64(s.Suboptimal)},
+				{Title: "Bytes saved", Type: "NUMBER", Value: s.BytesSaved},
+				{Title: "Pointer bytes saved", Type: "NUMBER", Value: s.PtrBytesSaved},
+			},
+		},
+		Annotations: make([]insightsAnnotation, 0, len(anns)),
+	}
+
+	if len(anns) > 0 {
+		p.Report.Result = "FAILED"
+	}
+
+	ids := fingerprints(anns)
+
+	for i, a := range anns {
+		// messages contain multi-byte characters such as ×, so cut at a character boundary
+		summary := firstLine(a.message)
+		if utf8.RuneCountInString(summary) > insightsSummaryLen {
+			summary = string([]rune(summary)[:insightsSummaryLen-3]) + "..."
+		}
+
+		p.Annotations = append(p.Annotations, insightsAnnotation{
+			ExternalID:     ids[i],
+			AnnotationType: "CODE_SMELL",
+			Path:           a.file,
+			Summary:        summary,
+			Details:        a.message,
+			Severity:       "LOW",
+			Line:           a.line,
+		})
+	}
+
+	return p
+}
+
+// printBitbucket prints the Code Insights payload to stdout as JSON, for pipelines publishing it themselves.
+func printBitbucket(p insightsPayload) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+
+	return enc.Encode(p)
+}
+
+// insightsTarget is the commit the Code Insights report is published to.
+type insightsTarget struct {
+	client *http.Client
+	api    string
+	token  string
+	path   string
+}
+
+// newInsightsTarget returns the commit built by Bitbucket Pipelines. Requests are authenticated with BITBUCKET_TOKEN
+// when set, and by the proxy of Bitbucket Pipelines otherwise.
+func newInsightsTarget() (*insightsTarget, error) {
+	workspace, slug, commit := os.Getenv("BITBUCKET_WORKSPACE"), os.Getenv("BITBUCKET_REPO_SLUG"),
+		os.Getenv("BITBUCKET_COMMIT")
+	if workspace == "" || slug == "" || commit == "" {
+		return nil, errNoCommit
+	}
+
+	t := &insightsTarget{
+		client: &http.Client{Timeout: time.Minute},
+		api:    defaultBitbucketAPI,
+		token:  os.Getenv("BITBUCKET_TOKEN"),
+		path: fmt.Sprintf("/2.0/repositories/%s/%s/commit/%s/reports/%s", url.PathEscape(workspace),
+			url.PathEscape(slug), url.PathEscape(commit), insightsReportID),
+	}
+
+	if t.token == "" {
+		proxy, err := url.Parse(pipelinesProxy)
+		if err != nil {
+			return nil, err
+		}
+
+		t.client.Transport = &http.Transport{Proxy: http.ProxyURL(proxy)}
+		t.api = pipelinesAPI
+	}
+
+	t.api = strings.TrimSuffix(cmp.Or(os.Getenv("BITBUCKET_API_URL"), t.api), "/")
+
+	return t, nil
+}
+
+// publish replaces the report of the commit with the report of p and adds its annotations, up to the maximum
+// number of annotations of a report.
+func (t *insightsTarget) publish(p insightsPayload) error {
+	// annotations of a previous run are deleted together with its report
+	if err := t.do(http.MethodDelete, t.path, nil); err != nil {
+		return err
+	}
+
+	if err := t.do(http.MethodPut, t.path, p.Report); err != nil {
+		return err
+	}
+
+	anns := p.Annotations[:min(len(p.Annotations), insightsMaxAnnotations)]
+
+	for len(anns) > 0 {
+		n := min(len(anns), insightsBatch)
+
+		if err := t.do(http.MethodPost, t.path+"/annotations", anns[:n]); err != nil {
+			return err
+		}
+
+		anns = anns[n:]
+	}
+
+	return nil
+}
+
+// do sends a Bitbucket API request with v as JSON payload, unless it is nil. Deleting a report which doesn't exist
+// succeeds.
+func (t *insightsTarget) do(method, path string, v any) error {
+	var body []byte
+
+	if v != nil {
+		var err error
+		if body, err = json.Marshal(v); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, t.api+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if v != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if t.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if method == http.MethodDelete && resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: %s", method, req.URL.Path, resp.Status)
+	}
+
+	return nil
+}
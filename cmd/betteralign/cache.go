@@ -0,0 +1,260 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dkorunic/betteralign"
+	"github.com/google/renameio/v2/maybe"
+	"golang.org/x/tools/go/analysis/checker"
+	"golang.org/x/tools/go/packages"
+)
+
+// cacheEntry is the cached outcome of analyzing a single package.
+type cacheEntry struct {
+	Result      *betteralign.Result `json:"result"`
+	Diagnostics []cachedDiagnostic  `json:"diagnostics"`
+}
+
+// cachedDiagnostic is a diagnostic with its position already resolved.
+type cachedDiagnostic struct {
+	Posn    string `json:"posn"`
+	Message string `json:"message"`
+	Code    string `json:"code,omitempty"`
+}
+
+// resultCache is an on-disk cache of analysis outcomes keyed by a hash of everything that affects them: the tool
+// binary, analyzer and build flags, Go version, target platform and contents of all non-GOROOT files of a package
+// and its dependencies.
+type resultCache struct {
+	fileHashes map[string]string
+	flags      *flag.FlagSet
+	dir        string
+	toolHash   string
+	build      []string
+}
+
+// buildEnv lists environment variables of the go command selecting the build target, and thereby sizes and files.
+var buildEnv = []string{"GOOS", "GOARCH", "GOARM", "GO386", "GOAMD64", "GOFLAGS", "GOEXPERIMENT", "CGO_ENABLED"}
+
+var (
+	toolHashOnce sync.Once
+	toolHash     string
+)
+
+// newResultCache returns a cache of results of an analyzer with flags of packages loaded with go build flags build,
+// stored in dir, creating the directory if needed.
+func newResultCache(dir string, flags *flag.FlagSet, build []string) (*resultCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	toolHashOnce.Do(func() {
+		toolHash = GitTag + GitCommit + GitDirty + BuildTime
+
+		// development builds carry no version, so identify them by their contents
+		if exe, err := os.Executable(); err == nil {
+			if h, err := hashFile(exe); err == nil {
+				toolHash = h
+			}
+		}
+	})
+
+	return &resultCache{
+		dir: dir, toolHash: toolHash, flags: flags, build: build, fileHashes: make(map[string]string),
+	}, nil
+}
+
+// key returns the cache key of pkg.
+func (c *resultCache) key(pkg *packages.Package) (string, error) {
+	h := sha256.New()
+
+	fmt.Fprintf(h, "tool %s\ngo %s %s/%s\npkg %s\n", c.toolHash, runtime.Version(), runtime.GOOS, runtime.GOARCH, pkg.ID)
+
+	c.flags.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(h, "flag %s=%s\n", f.Name, f.Value)
+	})
+
+	fmt.Fprintf(h, "build %q\n", c.build)
+
+	for _, name := range buildEnv {
+		fmt.Fprintf(h, "env %s=%s\n", name, os.Getenv(name))
+	}
+
+	// suppressed findings depend on contents of the baseline, not just its name
+	if fn := c.flags.Lookup("baseline").Value.String(); fn != "" {
+		bh, err := hashFile(fn)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(h, "baseline %s\n", bh)
+	}
+
+	// files unchanged since the changed_only base ref or ignored by git are skipped, whatever their contents
+	for _, fn := range pkg.CompiledGoFiles {
+		fmt.Fprintf(h, "git %s %q %t\n", fn, betteralign.ChangeState(fn), betteralign.GitIgnored(fn))
+	}
+
+	var files []string
+
+	seen := make(map[*packages.Package]bool)
+
+	var visit func(p *packages.Package)
+	visit = func(p *packages.Package) {
+		if seen[p] {
+			return
+		}
+		seen[p] = true
+
+		files = append(files, p.CompiledGoFiles...)
+
+		for _, imp := range p.Imports {
+			visit(imp)
+		}
+	}
+	visit(pkg)
+
+	sort.Strings(files)
+
+	goroot := filepath.Clean(build.Default.GOROOT) + string(filepath.Separator)
+	for _, fn := range files {
+		// standard library is identified by the Go version
+		if strings.HasPrefix(fn, goroot) {
+			continue
+		}
+
+		fh, ok := c.fileHashes[fn]
+		if !ok {
+			var err error
+			if fh, err = hashFile(overlayName(fn)); err != nil {
+				return "", err
+			}
+			c.fileHashes[fn] = fh
+		}
+
+		fmt.Fprintf(h, "file %s %s\n", fn, fh)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cacheable returns a predicate reporting whether results of a package of pkgs may be cached, i.e. whether none of
+// operational errors errs, such as failures to read or write fixed files, concern it. Errors which concern no
+// package in particular, such as an unreadable baseline, leave no results cacheable.
+func cacheable(pkgs []*packages.Package, errs []betteralign.OperationalError) func(*packages.Package) bool {
+	owners := make(map[string][]*packages.Package)
+
+	for _, pkg := range pkgs {
+		owners[pkg.PkgPath] = append(owners[pkg.PkgPath], pkg)
+
+		for _, fn := range pkg.CompiledGoFiles {
+			owners[fn] = append(owners[fn], pkg)
+			owners[filepath.Dir(fn)] = append(owners[filepath.Dir(fn)], pkg)
+		}
+	}
+
+	failed := make(map[*packages.Package]bool)
+
+	for _, e := range errs {
+		// paths are package paths, directories, files or positions in files
+		path := e.Path
+		for range 2 {
+			if rest, _, ok := cutLast(path); ok && owners[path] == nil {
+				path = rest
+			}
+		}
+
+		if owners[path] == nil {
+			return func(*packages.Package) bool { return false }
+		}
+
+		for _, pkg := range owners[path] {
+			failed[pkg] = true
+		}
+	}
+
+	return func(pkg *packages.Package) bool { return !failed[pkg] }
+}
+
+// putAction stores diagnostics and result of root action act under key, unless ok reports that they are incomplete,
+// e.g. with fixes of its package not written.
+func (c *resultCache) putAction(key string, act *checker.Action, ok func(*packages.Package) bool) error {
+	if !ok(act.Package) {
+		return nil
+	}
+
+	r, _ := act.Result.(*betteralign.Result)
+
+	e := &cacheEntry{Result: r}
+	for _, d := range act.Diagnostics {
+		e.Diagnostics = append(e.Diagnostics, cachedDiagnostic{
+			Posn:    act.Package.Fset.Position(d.Pos).String(),
+			Message: d.Message,
+			Code:    d.Category,
+		})
+	}
+
+	return c.put(key, e)
+}
+
+// path returns the file name of cache entry key, spread over subdirectories like GOCACHE.
+func (c *resultCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+// get returns the cached entry for key, if any.
+func (c *resultCache) get(key string) (*cacheEntry, bool) {
+	buf, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	var e cacheEntry
+	if err := json.Unmarshal(buf, &e); err != nil {
+		return nil, false
+	}
+
+	return &e, true
+}
+
+// put stores entry e under key.
+func (c *resultCache) put(key string, e *cacheEntry) error {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path(key)), 0o755); err != nil {
+		return err
+	}
+
+	return maybe.WriteFile(c.path(key), buf, 0o644)
+}
+
+// hashFile returns hex encoded SHA-256 of the contents of file fn.
+func hashFile(fn string) (string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"flag"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/dkorunic/betteralign"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/checker"
+	"golang.org/x/tools/go/packages"
+)
+
+// cacheFixture is a git work tree with a single package, whose file is added by its second commit.
+type cacheFixture struct {
+	pkg   *packages.Package
+	flags *flag.FlagSet
+	dir   string
+	fn    string
+}
+
+func newCacheFixture(t *testing.T) *cacheFixture {
+	t.Helper()
+
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "a.go")
+
+	if err := os.WriteFile(fn, []byte("package a\n\ntype T struct{ a bool }\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	git(t, dir, "init", "-q")
+	git(t, dir, "commit", "-q", "--allow-empty", "-m", "init")
+	git(t, dir, "add", ".")
+	git(t, dir, "commit", "-qm", "a")
+
+	flags := flag.NewFlagSet("betteralign", flag.ContinueOnError)
+	flags.String("baseline", "", "")
+	flags.Bool("apply", false, "")
+
+	return &cacheFixture{
+		pkg:   &packages.Package{ID: "a", PkgPath: "a", CompiledGoFiles: []string{fn}},
+		flags: flags,
+		dir:   dir,
+		fn:    fn,
+	}
+}
+
+// key returns the cache key of the fixture package with a fresh cache, so file hashes are not reused.
+func (f *cacheFixture) key(t *testing.T, build ...string) string {
+	t.Helper()
+
+	c, err := newResultCache(t.TempDir(), f.flags, build)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := c.key(f.pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func git(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command("git", append([]string{"-c", "user.name=t", "-c", "user.email=t@example.com"}, args...)...)
+	cmd.Dir = dir
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	for _, name := range buildEnv {
+		t.Setenv(name, "")
+	}
+
+	tests := []struct {
+		change func(t *testing.T, f *cacheFixture) []string
+		name   string
+	}{
+		{
+			name: "content",
+			change: func(t *testing.T, f *cacheFixture) []string {
+				if err := os.WriteFile(f.fn, []byte("package a\n\ntype T struct{ b bool }\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+
+				return nil
+			},
+		},
+		{
+			name: "build flags",
+			change: func(*testing.T, *cacheFixture) []string {
+				return []string{"-tags=integration"}
+			},
+		},
+		{
+			name: "target platform",
+			change: func(t *testing.T, _ *cacheFixture) []string {
+				t.Setenv("GOARCH", "386")
+
+				return nil
+			},
+		},
+		{
+			name: "analyzer flags",
+			change: func(t *testing.T, f *cacheFixture) []string {
+				if err := f.flags.Set("apply", "true"); err != nil {
+					t.Fatal(err)
+				}
+
+				return nil
+			},
+		},
+		{
+			name: "git ignored",
+			change: func(t *testing.T, f *cacheFixture) []string {
+				betteralign.Reset()
+
+				// tracked files are not ignored
+				git(t, f.dir, "rm", "-q", "--cached", "a.go")
+
+				if err := os.WriteFile(filepath.Join(f.dir, ".gitignore"), []byte("a.go\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+
+				return nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer betteralign.Reset()
+
+			f := newCacheFixture(t)
+			base := f.key(t)
+
+			if build := tt.change(t, f); f.key(t, build...) == base {
+				t.Errorf("key unchanged after changing %s", tt.name)
+			}
+		})
+	}
+}
+
+func TestCacheKeyChangeState(t *testing.T) {
+	f := newCacheFixture(t)
+
+	// the file is unchanged since HEAD, but was added after the commit before it
+	setAnalyzerFlag(t, "changed_only", "HEAD")
+	unchanged := f.key(t)
+
+	setAnalyzerFlag(t, "changed_only", "HEAD~1")
+	changed := f.key(t)
+
+	setAnalyzerFlag(t, "changed_only", "HEAD")
+	if unchanged == changed {
+		t.Error("key unchanged after the file changed since the changed_only base ref")
+	}
+
+	if f.key(t) != unchanged {
+		t.Error("key differs with the same changed_only base ref")
+	}
+}
+
+// setAnalyzerFlag sets analyzer flag name to value until the test ends, resetting state derived from flags.
+func setAnalyzerFlag(t *testing.T, name, value string) {
+	t.Helper()
+
+	f := betteralign.Analyzer.Flags.Lookup(name)
+	old := f.Value.String()
+
+	t.Cleanup(func() {
+		betteralign.Reset()
+		f.Value.Set(old)
+	})
+
+	betteralign.Reset()
+
+	if err := f.Value.Set(value); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheable(t *testing.T) {
+	a := &packages.Package{ID: "a", PkgPath: "example.com/a", CompiledGoFiles: []string{"/src/a/a.go"}}
+	aTest := &packages.Package{
+		ID: "a [a.test]", PkgPath: "example.com/a", CompiledGoFiles: []string{"/src/a/a.go", "/src/a/a_test.go"},
+	}
+	b := &packages.Package{ID: "b", PkgPath: "example.com/b", CompiledGoFiles: []string{"/src/b/b.go"}}
+	pkgs := []*packages.Package{a, aTest, b}
+
+	tests := []struct {
+		name string
+		errs []string
+		want []bool // a, aTest, b
+	}{
+		{"no errors", nil, []bool{true, true, true}},
+		{"package path", []string{"example.com/b"}, []bool{true, true, false}},
+		{"directory", []string{"/src/b"}, []bool{true, true, false}},
+		{"file", []string{"/src/a/a_test.go"}, []bool{true, false, true}},
+		{"shared file", []string{"/src/a/a.go"}, []bool{false, false, true}},
+		{"line", []string{"/src/b/b.go:3"}, []bool{true, true, false}},
+		{"position", []string{"/src/b/b.go:3:6"}, []bool{true, true, false}},
+		{"several", []string{"/src/a/a_test.go:1:1", "example.com/b"}, []bool{true, false, false}},
+		{"unknown path", []string{"/src/baseline.json"}, []bool{false, false, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs []betteralign.OperationalError
+			for _, path := range tt.errs {
+				errs = append(errs, betteralign.OperationalError{Path: path, Stage: betteralign.StageApply})
+			}
+
+			ok := cacheable(pkgs, errs)
+
+			for i, pkg := range pkgs {
+				if got := ok(pkg); got != tt.want[i] {
+					t.Errorf("cacheable(%s) = %t, want %t", pkg.ID, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCachePutAction(t *testing.T) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("/src/a/a.go", -1, 100)
+	file.SetLines([]int{0, 10, 20})
+
+	pkg := &packages.Package{ID: "a", PkgPath: "example.com/a", Fset: fset, CompiledGoFiles: []string{"/src/a/a.go"}}
+	act := &checker.Action{
+		Package: pkg,
+		IsRoot:  true,
+		Result:  &betteralign.Result{Package: "example.com/a", Analyzed: 1},
+		Diagnostics: []analysis.Diagnostic{{
+			Pos: file.Pos(12), Category: betteralign.CodeSize, Message: "BA001: 8 bytes saved",
+		}},
+	}
+
+	tests := []struct {
+		name string
+		errs []betteralign.OperationalError
+		want bool
+	}{
+		{"complete", nil, true},
+		{"fix not written", []betteralign.OperationalError{{Path: "/src/a/a.go", Stage: betteralign.StageApply}}, false},
+		{"unknown path", []betteralign.OperationalError{{Path: "baseline.json", Stage: betteralign.StageBaseline}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newResultCache(t.TempDir(), flag.NewFlagSet("betteralign", flag.ContinueOnError), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			const key = "0123456789abcdef"
+
+			if err := c.putAction(key, act, cacheable([]*packages.Package{pkg}, tt.errs)); err != nil {
+				t.Fatal(err)
+			}
+
+			e, ok := c.get(key)
+			if ok != tt.want {
+				t.Fatalf("cached: %t, want %t", ok, tt.want)
+			}
+
+			if ok && (len(e.Diagnostics) != 1 || e.Diagnostics[0].Posn != "/src/a/a.go:2:3" ||
+				e.Diagnostics[0].Code != betteralign.CodeSize || e.Result.Analyzed != 1) {
+				t.Errorf("cached entry %+v", e)
+			}
+		})
+	}
+}
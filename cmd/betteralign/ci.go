@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/analysis/checker"
+)
+
+const (
+	formatGitHub     = "github"
+	formatGitLab     = "gitlab"
+	formatAzure      = "azure"
+	formatCheckstyle = "checkstyle"
+)
+
+const (
+	// gitLabReportFile is the GitLab Code Quality report written in GitLab CI, to be declared as
+	// artifacts:reports:codequality of the job.
+	gitLabReportFile = "gl-code-quality-report.json"
+	// checkstyleReportFile is the Checkstyle report written in Jenkins, to be recorded by the Warnings plugin.
+	checkstyleReportFile = "betteralign-checkstyle.xml"
+)
+
+// ciFormat returns the annotation format of the CI environment betteralign runs in together with the file its
+// report is written to, or "" for stdout: GitHub Actions workflow commands annotating the job log, a GitLab Code
+// Quality report in GitLab CI, or a Checkstyle report for the Jenkins Warnings plugin in Jenkins. Outside of these
+// it returns the text format.
+func ciFormat() (string, string) {
+	switch {
+	case os.Getenv("GITHUB_ACTIONS") == "true":
+		return formatGitHub, ""
+	case os.Getenv("GITLAB_CI") == "true":
+		return formatGitLab, gitLabReportFile
+	case os.Getenv("JENKINS_URL") != "":
+		return formatCheckstyle, checkstyleReportFile
+	}
+
+	return formatText, ""
+}
+
+// printReport prints a report with print to stdout, or writes it to file fn unless it is empty.
+func printReport(fn string, print func(io.Writer) error) error {
+	if fn == "" {
+		return print(os.Stdout)
+	}
+
+	var buf bytes.Buffer
+	if err := print(&buf); err != nil {
+		return err
+	}
+
+	return os.WriteFile(fn, buf.Bytes(), 0o644)
+}
+
+// annotation is a root diagnostic located by its file, relative to the working directory when possible, line and
+// column.
+type annotation struct {
+	file    string
+	code    string
+	message string
+	line    int
+	col     int
+}
+
+// annotations returns cached and analyzed root diagnostics ordered by position.
+func annotations(cached []*cacheEntry, graph *checker.Graph) []annotation {
+	var anns []annotation
+
+	add := func(file string, line, col int, code, message string) {
+		anns = append(anns, annotation{
+			file:    relPath(file),
+			code:    code,
+			message: message,
+			line:    line,
+			col:     col,
+		})
+	}
+
+	for _, e := range cached {
+		for _, d := range e.Diagnostics {
+			// positions are file:line:col, where file may contain colons itself
+			rest, col, _ := cutLast(d.Posn)
+			file, line, _ := cutLast(rest)
+			add(file, line, col, d.Code, d.Message)
+		}
+	}
+
+	graph.All()(func(act *checker.Action) bool {
+		if act.IsRoot && act.Err == nil {
+			for _, d := range act.Diagnostics {
+				p := act.Package.Fset.Position(d.Pos)
+				add(p.Filename, p.Line, p.Column, d.Category, d.Message)
+			}
+		}
+
+		return true
+	})
+
+	slices.SortFunc(anns, func(a, b annotation) int {
+		return cmp.Or(cmp.Compare(a.file, b.file), cmp.Compare(a.line, b.line), cmp.Compare(a.col, b.col))
+	})
+
+	return anns
+}
+
+// relPath returns file name fn relative to the working directory with forward slashes, or fn itself when it is
+// outside of it.
+func relPath(fn string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return fn
+	}
+
+	if rel, err := filepath.Rel(wd, fn); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+
+	return fn
+}
+
+// cutLast cuts posn at its last colon and returns the part before it and the number after it.
+func cutLast(posn string) (string, int, bool) {
+	i := strings.LastIndexByte(posn, ':')
+	if i < 0 {
+		return posn, 0, false
+	}
+
+	n, err := strconv.Atoi(posn[i+1:])
+	if err != nil {
+		return posn, 0, false
+	}
+
+	return posn[:i], n, true
+}
+
+// printGitHub prints annotations to stdout as GitHub Actions warning commands, shown on the lines of pull request
+// diffs.
+func printGitHub(anns []annotation) error {
+	w := bufio.NewWriter(os.Stdout)
+
+	data := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	property := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+
+	for _, a := range anns {
+		// messages start with the code already
+		fmt.Fprintf(w, "::warning file=%s,line=%d,col=%d,title=betteralign::%s\n", property.Replace(a.file), a.line,
+			a.col, data.Replace(a.message))
+	}
+
+	return w.Flush()
+}
+
+// printAzure prints annotations to stdout as Azure Pipelines logging commands, listing them as warnings in the
+// build summary.
+func printAzure(anns []annotation) error {
+	w := bufio.NewWriter(os.Stdout)
+
+	data := strings.NewReplacer("%", "%AZP25", "\r", "%0D", "\n", "%0A")
+	property := strings.NewReplacer("%", "%AZP25", "\r", "%0D", "\n", "%0A", ";", "%3B", "]", "%5D")
+
+	for _, a := range anns {
+		fmt.Fprintf(w, "##vso[task.logissue type=warning;sourcepath=%s;linenumber=%d;columnnumber=%d;code=%s]%s\n",
+			property.Replace(a.file), a.line, a.col, property.Replace(a.code), data.Replace(a.message))
+	}
+
+	return w.Flush()
+}
+
+// codeQualityIssue is an issue of a GitLab Code Quality report, a subset of the Code Climate format.
+type codeQualityIssue struct {
+	Description string `json:"description"`
+	CheckName   string `json:"check_name"`
+	Fingerprint string `json:"fingerprint"`
+	Severity    string `json:"severity"`
+	Location    struct {
+		Path  string `json:"path"`
+		Lines struct {
+			Begin int `json:"begin"`
+		} `json:"lines"`
+	} `json:"location"`
+}
+
+// fingerprints returns stable identifiers of annotations, unique among them. They leave out line numbers, so issues
+// of moved code are not reported as new.
+func fingerprints(anns []annotation) []string {
+	ids := make([]string, 0, len(anns))
+	seen := make(map[string]int)
+
+	for _, a := range anns {
+		id := fmt.Sprintf("%s:%s:%s", a.file, a.code, firstLine(a.message))
+		seen[id]++
+
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s#%d", id, seen[id])))
+		ids = append(ids, hex.EncodeToString(sum[:]))
+	}
+
+	return ids
+}
+
+// printGitLab prints annotations to w as a GitLab Code Quality report.
+func printGitLab(w io.Writer, anns []annotation) error {
+	issues := make([]codeQualityIssue, 0, len(anns))
+	ids := fingerprints(anns)
+
+	for i, a := range anns {
+		issue := codeQualityIssue{
+			Description: firstLine(a.message),
+			CheckName:   a.code,
+			Fingerprint: ids[i],
+			Severity:    "minor",
+		}
+		issue.Location.Path = a.file
+		issue.Location.Lines.Begin = a.line
+
+		issues = append(issues, issue)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+
+	return enc.Encode(issues)
+}
+
+// checkstyleReport is a Checkstyle XML report, as read by the Jenkins Warnings plugin among others.
+type checkstyleReport struct {
+	XMLName xml.Name         `xml:"checkstyle"`
+	Version string           `xml:"version,attr"`
+	Files   []checkstyleFile `xml:"file"`
+}
+
+type checkstyleFile struct {
+	Name   string            `xml:"name,attr"`
+	Errors []checkstyleError `xml:"error"`
+}
+
+type checkstyleError struct {
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+	Line     int    `xml:"line,attr"`
+	Column   int    `xml:"column,attr"`
+}
+
+// printCheckstyle prints annotations to w as a Checkstyle report with one file element per file.
+func printCheckstyle(w io.Writer, anns []annotation) error {
+	report := checkstyleReport{Version: "4.3"}
+
+	for _, a := range anns {
+		if n := len(report.Files); n == 0 || report.Files[n-1].Name != a.file {
+			report.Files = append(report.Files, checkstyleFile{Name: a.file})
+		}
+
+		f := &report.Files[len(report.Files)-1]
+		f.Errors = append(f.Errors, checkstyleError{
+			Severity: "warning",
+			Message:  a.message,
+			Source:   "betteralign." + a.code,
+			Line:     a.line,
+			Column:   a.col,
+		})
+	}
+
+	buf, err := xml.MarshalIndent(report, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, buf)
+
+	return err
+}
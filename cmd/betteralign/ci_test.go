@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestCIFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    map[string]string
+		format string
+		report string
+	}{
+		{"none", nil, formatText, ""},
+		{"github", map[string]string{"GITHUB_ACTIONS": "true"}, formatGitHub, ""},
+		{"gitlab", map[string]string{"GITLAB_CI": "true"}, formatGitLab, gitLabReportFile},
+		{"jenkins", map[string]string{"JENKINS_URL": "https://ci.example.com/"}, formatCheckstyle, checkstyleReportFile},
+		{"azure", map[string]string{"TF_BUILD": "True"}, formatText, ""},
+		{"github not true", map[string]string{"GITHUB_ACTIONS": "false"}, formatText, ""},
+		{"gitlab not true", map[string]string{"GITLAB_CI": "1"}, formatText, ""},
+		{"github in jenkins", map[string]string{"GITHUB_ACTIONS": "true", "JENKINS_URL": "https://ci.example.com/"},
+			formatGitHub, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"GITHUB_ACTIONS", "GITLAB_CI", "JENKINS_URL", "TF_BUILD"} {
+				t.Setenv(name, tt.env[name])
+			}
+
+			format, report := ciFormat()
+			if format != tt.format || report != tt.report {
+				t.Errorf("ciFormat() = %q, %q, want %q, %q", format, report, tt.format, tt.report)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dkorunic/betteralign"
+)
+
+const (
+	// commentMarker identifies the summary comment among pull request comments, so reruns update it in place.
+	commentMarker = "<!-- betteralign summary -->"
+	// commentRows limits the number of findings listed in the summary comment.
+	commentRows = 50
+	// defaultGitHubAPI is the GitHub API endpoint unless GITHUB_API_URL names a GitHub Enterprise one.
+	defaultGitHubAPI = "https://api.github.com"
+	// defaultAppSlug is the GitHub App of GITHUB_TOKEN in GitHub Actions.
+	defaultAppSlug = "github-actions"
+)
+
+var (
+	errNoToken = errors.New("GITHUB_TOKEN is not set")
+	errNoRepo  = errors.New("expected a repository as owner/name with -repo or GITHUB_REPOSITORY")
+	errNoPR    = errors.New("expected a pull request number with -pr or a pull request GITHUB_REF")
+)
+
+// commentTarget is the pull request the summary comment is posted to.
+type commentTarget struct {
+	api   string
+	repo  string
+	token string
+	bot   string // login of the GitHub App posting with an installation token
+	pr    int
+}
+
+// newCommentTarget returns the pull request given by -repo and -pr, which default to the repository and pull
+// request of a GitHub Actions pull_request workflow run.
+func newCommentTarget() (*commentTarget, error) {
+	t := &commentTarget{
+		api:   strings.TrimSuffix(cmp.Or(os.Getenv("GITHUB_API_URL"), defaultGitHubAPI), "/"),
+		repo:  cmp.Or(prRepo, os.Getenv("GITHUB_REPOSITORY")),
+		token: os.Getenv("GITHUB_TOKEN"),
+		bot:   cmp.Or(appSlug, defaultAppSlug) + "[bot]",
+		pr:    prNumber,
+	}
+
+	if t.token == "" {
+		return nil, errNoToken
+	}
+
+	if owner, name, ok := strings.Cut(t.repo, "/"); !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return nil, errNoRepo
+	}
+
+	// pull_request workflows check out refs/pull/<number>/merge
+	if t.pr == 0 {
+		if ref, ok := strings.CutPrefix(os.Getenv("GITHUB_REF"), "refs/pull/"); ok {
+			t.pr, _ = strconv.Atoi(strings.TrimSuffix(ref, "/merge"))
+		}
+	}
+
+	if t.pr <= 0 {
+		return nil, errNoPR
+	}
+
+	return t, nil
+}
+
+// issueComment is the subset of GitHub issue comment fields used to find the summary comment.
+type issueComment struct {
+	Body string      `json:"body"`
+	User commentUser `json:"user"`
+	ID   int64       `json:"id"`
+}
+
+// commentUser is the author of an issue comment, or the user authenticated by the token.
+type commentUser struct {
+	Login string `json:"login"`
+	Type  string `json:"type"`
+}
+
+// statusError is an unsuccessful GitHub API response.
+type statusError struct {
+	method string
+	path   string
+	status string
+	code   int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.method, e.path, e.status)
+}
+
+// post creates the summary comment with body, or updates it when a previous run already created one, so the pull
+// request carries a single up to date summary.
+func (t *commentTarget) post(body string) error {
+	client := &http.Client{Timeout: time.Minute}
+
+	id, err := t.findComment(client)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string]string{"body": body})
+	if err != nil {
+		return err
+	}
+
+	if id == 0 {
+		return t.do(client, http.MethodPost, fmt.Sprintf("/repos/%s/issues/%d/comments", t.repo, t.pr), payload, nil)
+	}
+
+	return t.do(client, http.MethodPatch, fmt.Sprintf("/repos/%s/issues/comments/%d", t.repo, id), payload, nil)
+}
+
+// findComment returns the ID of the summary comment written by the token identity on the pull request, or 0 if there
+// is none. Comments quoting the marker written by others are left alone.
+func (t *commentTarget) findComment(client *http.Client) (int64, error) {
+	const perPage = 100
+
+	mine, err := t.author(client)
+	if err != nil {
+		return 0, err
+	}
+
+	for page := 1; ; page++ {
+		var comments []issueComment
+
+		path := fmt.Sprintf("/repos/%s/issues/%d/comments?per_page=%d&page=%d", t.repo, t.pr, perPage, page)
+		if err := t.do(client, http.MethodGet, path, nil, &comments); err != nil {
+			return 0, err
+		}
+
+		for _, c := range comments {
+			if mine(c.User) && strings.Contains(c.Body, commentMarker) {
+				return c.ID, nil
+			}
+		}
+
+		if len(comments) < perPage {
+			return 0, nil
+		}
+	}
+}
+
+// author returns a predicate matching comments written by the token identity: the user of a personal access token,
+// or the bot of the GitHub App given by -app_slug for installation tokens, such as GITHUB_TOKEN of GitHub Actions,
+// which aren't allowed to look themselves up.
+func (t *commentTarget) author(client *http.Client) (func(commentUser) bool, error) {
+	var u commentUser
+
+	err := t.do(client, http.MethodGet, "/user", nil, &u)
+
+	var se *statusError
+	if errors.As(err, &se) && se.code == http.StatusForbidden {
+		return func(c commentUser) bool { return c.Type == "Bot" && c.Login == t.bot }, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return func(c commentUser) bool { return c.Login == u.Login }, nil
+}
+
+// do sends an authenticated GitHub API request with JSON payload, if any, and decodes the JSON response into v,
+// unless it is nil.
+func (t *commentTarget) do(client *http.Client, method, path string, payload []byte, v any) error {
+	req, err := http.NewRequest(method, t.api+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{method: method, path: req.URL.Path, status: resp.Status, code: resp.StatusCode}
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(buf, v)
+}
+
+// commentBody renders the summary comment of results in Markdown: totals followed by a table of findings with the
+// largest savings.
+func commentBody(results []*betteralign.Result) string {
+	var b strings.Builder
+
+	s := betteralign.Summarize(results)
+
+	fmt.Fprintf(&b, "%s\n### betteralign\n\n", commentMarker)
+
+	if s.Suboptimal == 0 {
+		fmt.Fprintf(&b, "All %d analyzed structs are optimally aligned.\n", s.Analyzed)
+
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "%d of %d analyzed structs are suboptimal: %d bytes and %d pointer bytes could be saved.\n\n",
+		s.Suboptimal, s.Analyzed, s.BytesSaved, s.PtrBytesSaved)
+
+	b.WriteString("| Struct | Position | Size | Optimal | Pointer bytes | Optimal pointer bytes |\n")
+	b.WriteString("| --- | --- | ---: | ---: | ---: | ---: |\n")
+
+	findings := betteralign.TopFindings(results, 0)
+
+	for i, f := range findings {
+		if i == commentRows {
+			fmt.Fprintf(&b, "\n…and %d more.\n", len(findings)-commentRows)
+
+			break
+		}
+
+		fmt.Fprintf(&b, "| `%s.%s` | `%s:%d` | %d | %d | %d | %d |\n", f.Package, f.Struct, relPath(f.Pos.Filename),
+			f.Pos.Line, f.Size, f.OptimalSize, f.PtrBytes, f.OptimalPtrBytes)
+	}
+
+	return b.String()
+}
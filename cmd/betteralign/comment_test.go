@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCommentPost(t *testing.T) {
+	var (
+		me       = commentUser{Login: "me", Type: "User"}
+		other    = commentUser{Login: "other", Type: "User"}
+		actions  = commentUser{Login: "github-actions[bot]", Type: "Bot"}
+		renovate = commentUser{Login: "renovate[bot]", Type: "Bot"}
+		app      = commentUser{Login: "my-app[bot]", Type: "Bot"}
+	)
+
+	tests := []struct {
+		name         string
+		installation bool // the token is not allowed to look itself up
+		bot          string
+		comments     []issueComment
+		want         string
+	}{
+		{
+			name: "user updates own comment",
+			comments: []issueComment{
+				{ID: 1, User: other, Body: commentMarker},
+				{ID: 2, User: me, Body: commentMarker},
+			},
+			want: "PATCH /repos/o/r/issues/comments/2",
+		},
+		{
+			name: "user ignores quoted marker",
+			comments: []issueComment{
+				{ID: 1, User: other, Body: "> " + commentMarker},
+				{ID: 2, User: me, Body: "lgtm"},
+			},
+			want: "POST /repos/o/r/issues/7/comments",
+		},
+		{
+			name:         "github actions updates own comment",
+			installation: true,
+			bot:          "github-actions[bot]",
+			comments: []issueComment{
+				{ID: 1, User: renovate, Body: commentMarker},
+				{ID: 2, User: actions, Body: commentMarker},
+			},
+			want: "PATCH /repos/o/r/issues/comments/2",
+		},
+		{
+			name:         "github actions ignores other bots",
+			installation: true,
+			bot:          "github-actions[bot]",
+			comments: []issueComment{
+				{ID: 1, User: renovate, Body: commentMarker},
+				{ID: 2, User: app, Body: commentMarker},
+			},
+			want: "POST /repos/o/r/issues/7/comments",
+		},
+		{
+			name:         "app slug",
+			installation: true,
+			bot:          "my-app[bot]",
+			comments: []issueComment{
+				{ID: 1, User: actions, Body: commentMarker},
+				{ID: 2, User: app, Body: commentMarker},
+			},
+			want: "PATCH /repos/o/r/issues/comments/2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var writes []string
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer token" {
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+					return
+				}
+
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/user":
+					if tt.installation {
+						http.Error(w, "Resource not accessible by integration", http.StatusForbidden)
+
+						return
+					}
+
+					json.NewEncoder(w).Encode(me)
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/issues/7/comments":
+					json.NewEncoder(w).Encode(tt.comments)
+				default:
+					writes = append(writes, r.Method+" "+r.URL.Path)
+				}
+			}))
+			defer srv.Close()
+
+			target := &commentTarget{api: srv.URL, repo: "o/r", token: "token", bot: tt.bot, pr: 7}
+			if err := target.post("body"); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(writes) != 1 || writes[0] != tt.want {
+				t.Errorf("got requests %q, want %q", writes, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/dkorunic/betteralign"
+)
+
+// baselineOut is the baseline regenerated by -update_baseline, or "".
+var baselineOut string
+
+// readFindingsFile reads findings of a previous run from file fn.
+func readFindingsFile(fn string) ([]betteralign.Finding, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	findings, err := betteralign.ReadFindings(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return findings, nil
+}
+
+// compareRuns compares findings of the -baseline and -current result files and prints introduced and fixed
+// findings, as JSON to stdout with -json or as one line per finding to stderr otherwise. It returns the exit code:
+// 1 on errors, 3 when findings were introduced and 0 otherwise, so that CI can reject new waste without failing on
+// legacy findings.
+func compareRuns() int {
+	baseline, err := readFindingsFile(baselineFile())
+	if err != nil {
+		log.Printf("reading baseline: %v", err)
+
+		return 1
+	}
+
+	current, err := readFindingsFile(currentFile)
+	if err != nil {
+		log.Printf("reading current results: %v", err)
+
+		return 1
+	}
+
+	c := betteralign.CompareFindings(baseline, current)
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+
+		if err := enc.Encode(c); err != nil {
+			log.Print(err)
+
+			return 1
+		}
+	} else {
+		for _, f := range c.Introduced {
+			fmt.Fprintf(os.Stderr, "introduced: %v: %s: %s\n", f.Pos, f.Struct, firstLine(f.CodedMessage()))
+		}
+
+		for _, f := range c.Fixed {
+			fmt.Fprintf(os.Stderr, "fixed: %v: %s: %s\n", f.Pos, f.Struct, firstLine(f.CodedMessage()))
+		}
+
+		fmt.Fprintf(os.Stderr, "%d introduced, %d fixed\n", len(c.Introduced), len(c.Fixed))
+	}
+
+	if len(c.Introduced) > 0 {
+		return 3
+	}
+
+	return 0
+}
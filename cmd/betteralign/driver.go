@@ -0,0 +1,1393 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dkorunic/betteralign"
+	"github.com/google/renameio/v2/maybe"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/checker"
+	"golang.org/x/tools/go/packages"
+)
+
+var (
+	GitTag    = ""
+	GitCommit = ""
+	GitDirty  = ""
+	BuildTime = ""
+
+	includeTests bool
+	jsonOutput   bool
+	contextLines int
+	cpuProfile   string
+	memProfile   string
+	traceFile    string
+	printVersion bool
+	summary      bool
+	summaryJSON  string
+	top          int
+	sortBy       string
+	perPackage   bool
+	maxWaste     int64
+	quiet        bool
+	summaryOnly  bool
+	cacheDir     string
+	watchMode    bool
+	lspMode      bool
+	serveAddr    string
+	serveRoot    string
+	playAddr     string
+	update       bool
+	filesFrom    string
+	followLinks  bool
+	bestEffort   bool
+	errorReport  string
+	format       string
+	reportFile   string
+	templateText string
+	groupByPkg   bool
+	badge        string
+	metrics      string
+	timingFile   string
+	statsMode    bool
+	currentFile  string
+	rebaseline   bool
+	histogram    bool
+	scope        string
+	jobs         int
+	modMode      string
+	overlayJSON  string
+	overlayFiles map[string][]byte
+	prComment    bool
+	prRepo       string
+	appSlug      string
+	prNumber     int
+	prTarget     *commentTarget
+	bbReport     bool
+	bbTarget     *insightsTarget
+	memRatio     float64
+	noAutoLimits bool
+	exportFacts  bool
+)
+
+const (
+	sortPath    = "path"
+	sortSavings = "savings"
+	sortHeap    = "heap"
+
+	scopePackage = "package"
+	scopeFile    = "file"
+
+	modMod      = "mod"
+	modVendor   = "vendor"
+	modReadonly = "readonly"
+)
+
+// statsTop is the number of top packages listed by -stats without -top.
+const statsTop = 10
+
+// registerFlags registers driver flags together with all analyzer flags on the default flag set.
+func registerFlags(a *analysis.Analyzer) {
+	flag.BoolVar(&includeTests, "test", true, "indicates whether test files should be analyzed, too")
+	flag.BoolVar(&jsonOutput, "json", false, "emit JSON output")
+	flag.StringVar(&format, "format", formatText,
+		"diagnostics format: text, editor printing file:line:col: message lines to stdout for vim quickfix and Emacs compilation-mode, template, "+
+			"jsonl streaming one JSON finding per line to stdout as analysis progresses, "+
+			"tap printing a Test Anything Protocol test point per package (per struct with -audit) to stdout, "+
+			"github printing GitHub Actions annotations, gitlab printing a GitLab Code Quality report, bitbucket "+
+			"printing a Bitbucket Code Insights report with annotations, azure printing Azure Pipelines logging "+
+			"commands or checkstyle printing a Checkstyle report for Jenkins to stdout; unless given, github is "+
+			"detected in GitHub Actions, and gitlab and checkstyle in GitLab CI and Jenkins, writing "+
+			gitLabReportFile+" and "+checkstyleReportFile+" respectively")
+	flag.BoolVar(&groupByPkg, "group_by_package", false,
+		"print diagnostics grouped by package, each group headed by the package path and followed by its subtotal")
+	flag.StringVar(&templateText, "template", "",
+		"with -format=template, print every finding to stdout with this text/template (e.g. '{{.Path}}:{{.Line}} {{.Saved}}B {{.Struct}}')")
+	flag.IntVar(&contextLines, "c", -1, "display offending line with this many lines of context")
+	flag.IntVar(&jobs, "j", 0,
+		"maximum number of packages built, analyzed and fixed files written in parallel (default GOMAXPROCS)")
+	flag.StringVar(&modMode, "mod", "",
+		"module download mode passed to package loading like to go build: mod, vendor or readonly (default from GOFLAGS or go.mod)")
+	flag.StringVar(&overlayJSON, "overlay", "",
+		"read a JSON file replacing file contents like go build -overlay, analyzing and fixing the replacement files")
+	flag.Float64Var(&memRatio, "memlimit_ratio", defaultMemRatio,
+		"set the Go memory limit to this ratio of the cgroup or system memory, 0 keeps the Go default (or GOMEMLIMIT)")
+	flag.BoolVar(&noAutoLimits, "no_auto_limits", false,
+		"don't derive the Go memory limit and GOMAXPROCS from cgroup or system limits")
+	flag.BoolVar(&prComment, "comment", false,
+		"post or update a summary comment with findings on the GitHub pull request given by -repo and -pr, which "+
+			"makes findings advisory instead of failing the run (token read from GITHUB_TOKEN)")
+	flag.StringVar(&prRepo, "repo", "", "with -comment, GitHub repository as owner/name (default GITHUB_REPOSITORY)")
+	flag.IntVar(&prNumber, "pr", 0,
+		"with -comment, pull request number (default from GITHUB_REF of pull_request workflows)")
+	flag.StringVar(&appSlug, "app_slug", defaultAppSlug,
+		"with -comment, slug of the GitHub App whose installation token posts the comment as <slug>[bot]")
+	flag.BoolVar(&bbReport, "bitbucket_report", false,
+		"publish findings as a Bitbucket Code Insights report with annotations of the commit built by Bitbucket "+
+			"Pipelines (authenticated by its proxy, or with BITBUCKET_TOKEN)")
+	flag.StringVar(&cpuProfile, "cpuprofile", "", "write CPU profile to this file")
+	flag.StringVar(&memProfile, "memprofile", "", "write memory profile to this file")
+	flag.StringVar(&traceFile, "trace", "", "write trace log to this file")
+	flag.BoolVar(&printVersion, "V", false, "print version and exit")
+	flag.BoolVar(&update, "self_update", false,
+		"replace this binary with the latest GitHub release after verifying its checksum, and exit")
+	flag.BoolVar(&summary, "summary", false, "print a summary of analyzed structs and savings per package to stderr")
+	flag.IntVar(&top, "top", 0, "only list this many structs with the largest potential savings across the run")
+	flag.StringVar(&sortBy, "sort", sortPath, "order diagnostics by source position (path), potential savings (savings) or heap profile bytes (heap)")
+	flag.BoolVar(&perPackage, "per_package", false,
+		"report one line per package with number of suboptimal structs and total waste instead of every struct")
+	flag.Int64Var(&maxWaste, "max_total_waste", -1,
+		"only fail on struct findings when total potential savings across all packages exceed this many bytes, "+
+			"while other diagnostics still fail (-1 fails on any diagnostic)")
+	flag.BoolVar(&quiet, "quiet", false, "do not print diagnostics, only requested reports and the exit code")
+	flag.BoolVar(&summaryOnly, "summary_only", false,
+		"do not print diagnostics, only a single line with totals of analyzed and suboptimal structs")
+	flag.StringVar(&scope, "scope", scopePackage,
+		"package, or file to only check and fix the Go files given as arguments while type-checking their packages in full "+
+			"(e.g. //go:generate betteralign -apply -scope=file $GOFILE)")
+	flag.StringVar(&filesFrom, "files_from", "",
+		"analyze packages of files listed one per line in this file (- for stdin) in addition to package arguments")
+	flag.BoolVar(&followLinks, "follow_symlinks", false,
+		"also analyze packages in symlinked directories below ./... patterns, skipping symlink cycles")
+	flag.BoolVar(&bestEffort, "best_effort", false,
+		"skip packages failing to load, listing them and packages with type errors at the end, instead of failing the run")
+	flag.BoolVar(&exportFacts, "facts", false,
+		"reuse layout facts of struct types exported for all dependencies, which loads syntax of dependencies too")
+	flag.StringVar(&cacheDir, "cache_dir", "",
+		"cache results in this directory and skip packages whose files, dependencies and flags haven't changed")
+	flag.BoolVar(&lspMode, "lsp", false,
+		"run as a language server on stdin and stdout, publishing diagnostics and offering field reordering")
+	flag.StringVar(&serveAddr, "serve", "",
+		"serve an HTTP/JSON API on this address analyzing directories and source archives (e.g. localhost:8080)")
+	flag.StringVar(&serveRoot, "serve_root", "",
+		"with -serve, analyze directories named by requests only below this directory (default none, only archives)")
+	flag.StringVar(&playAddr, "play", "",
+		"serve a web playground on this address rendering layouts of pasted struct types (e.g. localhost:8081)")
+	flag.BoolVar(&watchMode, "watch", false, "re-analyze packages whenever their Go files change, until interrupted")
+	flag.BoolVar(&histogram, "histogram", false,
+		"print a histogram of suboptimal structs by bytes saved (1-8, 9-16, 17-64 and 65+) to stderr")
+	flag.StringVar(&summaryJSON, "summary_json", "", "write a JSON summary of analyzed structs and savings to this file")
+	flag.StringVar(&badge, "badge", "",
+		"write a shields.io endpoint badge JSON with total struct padding waste to this file")
+	flag.StringVar(&metrics, "metrics", "",
+		"write per package gauges of suboptimal structs and wasted bytes to this file in the Prometheus text format")
+	flag.BoolVar(&statsMode, "stats", false,
+		"print aggregate padding statistics of all structs: total and padding bytes, bytes recoverable by "+
+			"reordering and top packages by recoverable bytes (-top of them, 10 by default)")
+	flag.StringVar(&currentFile, "current", "",
+		"instead of analyzing, report findings of this result file introduced or fixed since the -baseline")
+	flag.BoolVar(&rebaseline, "update_baseline", false,
+		"instead of suppressing findings of the -baseline, regenerate it with all findings of this run")
+	flag.StringVar(&timingFile, "timing", "",
+		"write a JSON timing breakdown of loading and analyzing, per package parse, inspect, decorate, print and "+
+			"write, to this file")
+	flag.StringVar(&errorReport, "error_report", "",
+		"write operational errors (load, analysis, decoration and write failures) as JSON with path, stage and error to this file")
+
+	a.Flags.VisitAll(func(f *flag.Flag) {
+		flag.Var(f.Value, f.Name, f.Usage)
+	})
+
+	registerLegacyFlags(a)
+
+	flag.Usage = func() {
+		paras := strings.Split(a.Doc, "\n\n")
+		fmt.Fprintf(os.Stderr, "%s: %s\n\n", a.Name, paras[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [command] [-flag] [package]\n\n", a.Name)
+
+		if len(paras) > 1 {
+			fmt.Fprintln(os.Stderr, strings.Join(paras[1:], "\n\n"))
+		}
+
+		fmt.Fprintln(os.Stderr, "\nCommands:")
+
+		names := make([]string, 0, len(subcommands))
+		for name := range subcommands {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			fmt.Fprintf(os.Stderr, "  %-12s %s\n", name, subcommands[name].usage)
+		}
+
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		flag.PrintDefaults()
+	}
+}
+
+// runDriver loads the packages matching args, runs the analyzer on them and prints diagnostics followed by any
+// requested reports. It returns the exit code: 1 on errors, 3 when total potential savings exceed -max_total_waste or
+// diagnostics were reported, with struct findings only counted without -max_total_waste, and 0 otherwise.
+func runDriver(a *analysis.Analyzer, args []string) int {
+	if printVersion {
+		fmt.Printf("betteralign %s (%s%s), built %s\n", GitTag, GitCommit, GitDirty, BuildTime)
+
+		return 0
+	}
+
+	if printFlags {
+		if err := printFlagsJSON(); err != nil {
+			log.Print(err)
+
+			return 1
+		}
+
+		return 0
+	}
+
+	if update {
+		return selfUpdate()
+	}
+
+	if err := applyLegacyFlags(a); err != nil {
+		log.Printf("invalid %v", err)
+
+		return 1
+	}
+
+	if jobs < 0 {
+		log.Printf("invalid -j value %d, expected a positive number of jobs", jobs)
+
+		return 1
+	}
+
+	if jobs > 0 {
+		limitJobs(a, jobs)
+	}
+
+	switch modMode {
+	case "", modMod, modVendor, modReadonly:
+	default:
+		log.Printf("invalid -mod value %q, expected %s, %s or %s", modMode, modMod, modVendor, modReadonly)
+
+		return 1
+	}
+
+	if overlayJSON != "" {
+		var err error
+		if overlayFiles, err = loadOverlay(overlayJSON); err != nil {
+			log.Printf("invalid -overlay: %v", err)
+
+			return 1
+		}
+	}
+
+	if prComment {
+		var err error
+		if prTarget, err = newCommentTarget(); err != nil {
+			log.Printf("invalid -comment: %v", err)
+
+			return 1
+		}
+	}
+
+	if bbReport {
+		var err error
+		if bbTarget, err = newInsightsTarget(); err != nil {
+			log.Printf("invalid -bitbucket_report: %v", err)
+
+			return 1
+		}
+	}
+
+	betteralign.SetFacts(exportFacts)
+
+	if lspMode {
+		return serveLSP(a, os.Stdin, os.Stdout)
+	}
+
+	if serveAddr != "" {
+		return serve(a, serveAddr)
+	}
+
+	if playAddr != "" {
+		return play(playAddr)
+	}
+
+	if currentFile != "" {
+		if baselineFile() == "" {
+			log.Print("-current needs a -baseline to compare with")
+
+			return 1
+		}
+
+		return compareRuns()
+	}
+
+	if rebaseline {
+		if baselineOut = baselineFile(); baselineOut == "" {
+			log.Print("-update_baseline needs a -baseline to regenerate")
+
+			return 1
+		}
+
+		// the baseline is regenerated from all findings, none of which are suppressed
+		if err := flag.Set("baseline", ""); err != nil {
+			log.Print(err)
+
+			return 1
+		}
+	}
+
+	var filter func([]*packages.Package) []*packages.Package
+
+	if filesFrom != "" {
+		dirs, files, err := readFileList(filesFrom)
+		if err != nil {
+			log.Printf("reading file list: %v", err)
+
+			return 1
+		}
+
+		if len(dirs) == 0 && len(args) == 0 {
+			return 0
+		}
+
+		// package arguments are analyzed in full, listed files narrow down only packages of their directories
+		if len(args) == 0 {
+			filter = func(pkgs []*packages.Package) []*packages.Package {
+				return changedPackages(pkgs, files)
+			}
+		}
+
+		args = append(args, dirs...)
+	}
+
+	switch scope {
+	case scopePackage:
+	case scopeFile:
+		dirs, files, err := fileDirs(args)
+		if err != nil {
+			log.Printf("resolving files: %v", err)
+
+			return 1
+		}
+
+		betteralign.SetFileScope(files)
+
+		args = dirs
+	default:
+		log.Printf("invalid -scope value %q, expected %s or %s", scope, scopePackage, scopeFile)
+
+		return 1
+	}
+
+	if len(args) == 0 {
+		flag.Usage()
+
+		return 1
+	}
+
+	if followLinks {
+		args = expandSymlinks(args)
+	}
+
+	// CI pipelines get annotations of their own unless the output is chosen explicitly
+	explicit := jsonOutput
+	flag.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "format" })
+
+	if !explicit {
+		format, reportFile = ciFormat()
+	}
+
+	switch format {
+	case formatText, formatEditor, formatJSONL, formatTAP, formatGitHub, formatGitLab, formatBitbucket, formatAzure,
+		formatCheckstyle:
+	case formatTemplate:
+		if err := parseTemplate(templateText); err != nil {
+			log.Printf("invalid -template: %v", err)
+
+			return 1
+		}
+	default:
+		log.Printf("invalid -format value %q, expected %s, %s, %s, %s, %s, %s, %s, %s, %s or %s", format, formatText,
+			formatEditor, formatTemplate, formatJSONL, formatTAP, formatGitHub, formatGitLab, formatBitbucket,
+			formatAzure, formatCheckstyle)
+
+		return 1
+	}
+
+	// statistics aggregate layouts of all structs, which are recorded by audit
+	if statsMode {
+		if err := flag.Set("audit", "true"); err != nil {
+			log.Print(err)
+
+			return 1
+		}
+	}
+
+	if sortBy != sortPath && sortBy != sortSavings && sortBy != sortHeap {
+		log.Printf("invalid -sort value %q, expected %s, %s or %s", sortBy, sortPath, sortSavings, sortHeap)
+
+		return 1
+	}
+
+	if cpuProfile != "" {
+		f, err := os.Create(cpuProfile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := pprof.StartCPUProfile(f); err != nil {
+			log.Fatal(err)
+		}
+
+		defer func() {
+			pprof.StopCPUProfile()
+			f.Close()
+		}()
+	}
+
+	if traceFile != "" {
+		f, err := os.Create(traceFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := trace.Start(f); err != nil {
+			log.Fatal(err)
+		}
+
+		defer func() {
+			trace.Stop()
+			f.Close()
+		}()
+	}
+
+	if memProfile != "" {
+		f, err := os.Create(memProfile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		defer func() {
+			runtime.GC()
+
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				log.Printf("writing memory profile: %v", err)
+			}
+
+			f.Close()
+		}()
+	}
+
+	if watchMode {
+		return watch(a, args)
+	}
+
+	return analyze(a, args, filter)
+}
+
+// buildFlags returns go build flags of package loading. GOFLAGS of the environment is read by go list itself, while
+// flags given here take precedence over it.
+func buildFlags() []string {
+	var flags []string
+
+	// dependencies are compiled by go list for their export data
+	if jobs > 0 {
+		flags = append(flags, "-p="+strconv.Itoa(jobs))
+	}
+
+	if modMode != "" {
+		flags = append(flags, "-mod="+modMode)
+	}
+
+	if buildTags != "" {
+		flags = append(flags, "-tags="+buildTags)
+	}
+
+	return flags
+}
+
+// analyze loads packages matching args, narrowed by filter when given, runs the analyzer on them and prints
+// diagnostics followed by any requested reports. It returns the exit code as runDriver does.
+func analyze(a *analysis.Analyzer, args []string, filter func([]*packages.Package) []*packages.Package) int {
+	conf := packages.Config{
+		Mode:       packages.LoadSyntax | packages.NeedModule,
+		Tests:      includeTests,
+		BuildFlags: buildFlags(),
+		Overlay:    overlayFiles,
+	}
+
+	// analyzers exchanging facts also run on dependencies, which then need syntax too
+	if needFacts(a) {
+		conf.Mode = packages.LoadAllSyntax | packages.NeedModule
+	}
+
+	parse := &parseTimes{files: make(map[string]time.Duration)}
+	if timingFile != "" {
+		conf.ParseFile = parse.parseFile
+	}
+
+	start := time.Now()
+
+	initial, err := packages.Load(&conf, args...)
+	loaded := time.Since(start)
+	if err == nil && len(initial) == 0 {
+		err = fmt.Errorf("%s matched no packages", strings.Join(args, " "))
+	}
+
+	if err != nil {
+		log.Print(err)
+
+		if err := writeErrorReport([]betteralign.OperationalError{{
+			Path: strings.Join(args, " "), Stage: betteralign.StageLoad, Error: err.Error(),
+		}}); err != nil {
+			log.Print(err)
+		}
+
+		return 1
+	}
+
+	betteralign.Logger().Debug("loaded packages", "packages", len(initial), "duration", loaded)
+
+	if wd, err := os.Getwd(); err == nil {
+		if files, ok := betteralign.ChangedFiles(wd); ok {
+			initial = changedPackages(initial, files)
+		}
+	}
+
+	initial = unignoredPackages(initial)
+
+	if filter != nil {
+		initial = filter(initial)
+	}
+
+	if std := gorootPackages(initial); len(std) > 0 && applying() {
+		log.Printf("refusing to apply fixes to read-only GOROOT packages %s, run without -apply",
+			strings.Join(std, " "))
+
+		return 1
+	}
+
+	opErrs := loadErrors(initial)
+
+	var skipped, partial []string
+	if bestEffort {
+		initial, skipped, partial = skipBroken(initial)
+	}
+
+	exitCode := 0
+	if !bestEffort && packages.PrintErrors(initial) > 0 {
+		exitCode = 1
+	}
+
+	// the cache replays results of either variant alone, so shared files are owned by the package without tests
+	betteralign.SetVariantFiles(variantFiles(initial))
+
+	var (
+		cache  *resultCache
+		cached []*cacheEntry
+	)
+
+	roots, keys := initial, make(map[*packages.Package]string)
+
+	// JSON output is printed by the checker and needs the full analysis graph
+	if cacheDir != "" && !jsonOutput {
+		if cache, err = newResultCache(cacheDir, &a.Flags, conf.BuildFlags); err != nil {
+			log.Print(err)
+
+			return 1
+		}
+
+		roots = nil
+
+		for _, pkg := range initial {
+			key, err := cache.key(pkg)
+			if err == nil {
+				if e, ok := cache.get(key); ok {
+					betteralign.Logger().Debug("cached package", "package", pkg.ID)
+					cached = append(cached, e)
+
+					continue
+				}
+
+				// packages with errors are not cached, as their results are incomplete
+				if len(pkg.Errors) == 0 {
+					keys[pkg] = key
+				}
+			}
+
+			roots = append(roots, pkg)
+		}
+	}
+
+	// findings of cached packages are streamed first, followed by findings of analyzed packages as they are reported
+	if streaming := format == formatJSONL && !quiet && !summaryOnly; streaming {
+		for _, e := range cached {
+			for _, f := range e.Result.Findings {
+				printJSONL(f)
+			}
+		}
+
+		betteralign.SetFindingHandler(printJSONL)
+		defer betteralign.SetFindingHandler(nil)
+	}
+
+	start = time.Now()
+
+	graph, err := checker.Analyze([]*analysis.Analyzer{a}, roots, nil)
+	if err != nil {
+		log.Print(err)
+
+		return 1
+	}
+
+	if timingFile != "" {
+		if err := writeTiming(timingFile, graph, parse, loaded, time.Since(start)); err != nil {
+			log.Print(err)
+
+			return 1
+		}
+	}
+
+	// otherDiags counts root diagnostics other than struct findings, which fail the run regardless of
+	// -max_total_waste, and hardDiags those of violated hard constraints, which fail it even with -audit
+	var numErrors, rootDiags, otherDiags, hardDiags int
+
+	// advisory outputs don't fail the run on diagnostics, while inventories only fail it on hard constraints
+	var advisory, inventory bool
+
+	var results []*betteralign.Result
+
+	// results of packages which failed partially, e.g. with fixes not written, are incomplete
+	cacheOK := cacheable(roots, betteralign.OperationalErrors())
+
+	for _, e := range cached {
+		rootDiags += len(e.Diagnostics)
+		results = append(results, e.Result)
+
+		for _, d := range e.Diagnostics {
+			if !wasteCode(d.Code) {
+				otherDiags++
+			}
+
+			if hardCode(d.Code) {
+				hardDiags++
+			}
+		}
+	}
+
+	graph.All()(func(act *checker.Action) bool {
+		if act.Err != nil {
+			numErrors++
+
+			opErrs = append(opErrs, betteralign.OperationalError{
+				Path: act.Package.ID, Stage: betteralign.StageAnalyze, Error: act.Err.Error(),
+			})
+		} else if act.IsRoot {
+			rootDiags += len(act.Diagnostics)
+
+			for _, d := range act.Diagnostics {
+				if !wasteCode(d.Category) {
+					otherDiags++
+				}
+
+				if hardCode(d.Category) {
+					hardDiags++
+				}
+			}
+
+			r, _ := act.Result.(*betteralign.Result)
+			if r != nil {
+				results = append(results, r)
+			}
+
+			if key, ok := keys[act.Package]; ok {
+				if err := cache.putAction(key, act, cacheOK); err != nil {
+					betteralign.Logger().Warn("unable to cache results", "package", act.Package.ID, "error", err)
+				}
+			}
+		}
+
+		return true
+	})
+
+	switch {
+	case quiet || summaryOnly:
+	case format == formatJSONL:
+	case statsMode:
+		// statistics are informational, so diagnostics don't fail the run
+		advisory = true
+
+		if err := printStats(betteralign.ComputeStats(results, cmp.Or(top, statsTop))); err != nil {
+			log.Print(err)
+
+			return 1
+		}
+	case format == formatTAP:
+		inventory = auditing()
+
+		if err := printTAP(results); err != nil {
+			log.Print(err)
+
+			return 1
+		}
+	case auditing():
+		// the inventory is informational, so only violated hard constraints fail the run
+		inventory = true
+
+		if err := printAudit(betteralign.AllAudits(results)); err != nil {
+			log.Print(err)
+
+			return 1
+		}
+	case perPackage:
+		if err := printPackages(betteralign.Summarize(results).ByWaste()); err != nil {
+			log.Print(err)
+
+			return 1
+		}
+	case format == formatTemplate:
+		if err := printTemplate(orderedFindings(results)); err != nil {
+			log.Print(err)
+
+			return 1
+		}
+	case top > 0 || sortBy != sortPath:
+		// the listing is narrowed down, while every root diagnostic still fails the run
+		if err := printFindings(orderedFindings(results)); err != nil {
+			log.Print(err)
+
+			return 1
+		}
+	case format == formatEditor:
+		if err := printEditor(cached, graph); err != nil {
+			log.Print(err)
+
+			return 1
+		}
+	case format == formatGitHub:
+		if err := printGitHub(annotations(cached, graph)); err != nil {
+			log.Print(err)
+
+			return 1
+		}
+	case format == formatGitLab:
+		if err := printReport(reportFile, func(w io.Writer) error {
+			return printGitLab(w, annotations(cached, graph))
+		}); err != nil {
+			log.Print(err)
+
+			return 1
+		}
+	case format == formatBitbucket:
+		if err := printBitbucket(newInsightsPayload(annotations(cached, graph), results)); err != nil {
+			log.Print(err)
+
+			return 1
+		}
+	case format == formatAzure:
+		if err := printAzure(annotations(cached, graph)); err != nil {
+			log.Print(err)
+
+			return 1
+		}
+	case format == formatCheckstyle:
+		if err := printReport(reportFile, func(w io.Writer) error {
+			return printCheckstyle(w, annotations(cached, graph))
+		}); err != nil {
+			log.Print(err)
+
+			return 1
+		}
+	case jsonOutput:
+		if err := graph.PrintJSON(os.Stdout); err != nil {
+			return 1
+		}
+	case groupByPkg:
+		if err := printGrouped(cached, graph, results); err != nil {
+			log.Print(err)
+
+			return 1
+		}
+	default:
+		for _, e := range cached {
+			for _, d := range e.Diagnostics {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", d.Posn, d.Message)
+			}
+		}
+
+		if err := graph.PrintText(os.Stderr, contextLines); err != nil {
+			return 1
+		}
+	}
+
+	if err := writeReports(results); err != nil {
+		log.Print(err)
+
+		return 1
+	}
+
+	if bbTarget != nil {
+		if err := bbTarget.publish(newInsightsPayload(annotations(cached, graph), results)); err != nil {
+			log.Printf("publishing Code Insights report: %v", err)
+
+			return 1
+		}
+	}
+
+	// the pull request comment is advisory, so findings don't fail the run
+	if prTarget != nil {
+		if err := prTarget.post(commentBody(results)); err != nil {
+			log.Printf("posting pull request comment: %v", err)
+
+			return 1
+		}
+
+		advisory = true
+	}
+
+	// findings of a regenerated baseline are accepted
+	if baselineOut != "" {
+		advisory = true
+	}
+
+	printPackageErrors("analyzed %d packages partially, skipping structs depending on type errors:", partial)
+	printPackageErrors("skipped %d packages with errors:", skipped)
+
+	if err := writeErrorReport(append(opErrs, betteralign.OperationalErrors()...)); err != nil {
+		log.Print(err)
+
+		return 1
+	}
+
+	return exitStatus(runStatus{
+		diags:      rootDiags,
+		otherDiags: otherDiags,
+		hardDiags:  hardDiags,
+		waste:      betteralign.Summarize(results).BytesSaved,
+		maxWaste:   maxWaste,
+		failed:     numErrors > 0 || exitCode != 0,
+		advisory:   advisory,
+		inventory:  inventory,
+		json:       jsonOutput,
+		// go:generate stops on failing commands, so fixed files of -scope=file don't fail the run
+		fixedFiles: scope == scopeFile && applying(),
+	})
+}
+
+// runStatus describes the outcome of an analysis run, which determines its exit code.
+type runStatus struct {
+	diags      int   // root diagnostics
+	otherDiags int   // root diagnostics other than struct findings, see wasteCode
+	hardDiags  int   // root diagnostics of violated hard constraints, see hardCode
+	waste      int64 // total potential savings of all findings
+	maxWaste   int64 // -max_total_waste, or negative when not set
+	failed     bool  // packages failed to load or analyze
+	advisory   bool  // diagnostics are informational, e.g. statistics or a regenerated baseline
+	inventory  bool  // diagnostics accompany a layout inventory of -audit
+	json       bool  // diagnostics were printed as JSON
+	fixedFiles bool  // diagnostics were fixed in files given by -scope=file
+}
+
+// exitStatus returns the exit code of a run: 1 on errors, 3 when diagnostics fail the run and 0 otherwise. With
+// -max_total_waste, struct findings only fail the run once their total savings exceed it.
+func exitStatus(s runStatus) int {
+	if s.failed {
+		return 1
+	}
+
+	diags := s.diags
+
+	if s.maxWaste >= 0 {
+		if s.waste > s.maxWaste {
+			log.Printf("total potential savings of %d bytes exceed -max_total_waste=%d", s.waste, s.maxWaste)
+
+			return 3
+		}
+
+		diags = min(diags, s.otherDiags)
+	}
+
+	if s.inventory {
+		diags = min(diags, s.hardDiags)
+	}
+
+	if diags > 0 && !s.advisory && !s.json && !s.fixedFiles {
+		return 3
+	}
+
+	return 0
+}
+
+// wasteCode reports whether diagnostic code reports a struct wasting memory, as judged by -max_total_waste.
+func wasteCode(code string) bool {
+	return code == betteralign.CodeSize || code == betteralign.CodePointerBytes
+}
+
+// hardCode reports whether diagnostic code reports a violated hard constraint, which fails the run even with -audit.
+func hardCode(code string) bool {
+	return code == betteralign.CodeMaxSize || code == betteralign.CodeAssert
+}
+
+// readFileList reads file names listed one per line in fn, or stdin if fn is -, and returns their distinct
+// directories together with the set of listed files. Files of directories which no longer exist are skipped.
+func readFileList(fn string) ([]string, map[string]bool, error) {
+	r := os.Stdin
+
+	if fn != "-" {
+		f, err := os.Open(fn)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	var names []string
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if name := strings.TrimSpace(sc.Text()); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return fileDirs(names)
+}
+
+// fileDirs returns distinct directories of files names together with the set of their absolute names, with
+// symlinks of directories resolved. Files of directories which no longer exist are skipped.
+func fileDirs(names []string) ([]string, map[string]bool, error) {
+	var dirs []string
+
+	files := make(map[string]bool)
+	seenDirs := make(map[string]bool)
+
+	for _, name := range names {
+		name, err := filepath.Abs(name)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		dir := filepath.Dir(name)
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = real
+		} else {
+			continue
+		}
+
+		files[filepath.Join(dir, filepath.Base(name))] = true
+
+		if !seenDirs[dir] {
+			seenDirs[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	return dirs, files, nil
+}
+
+// skipBroken returns packages of pkgs which, together with all of their dependencies, loaded without errors other
+// than type errors, and descriptions of the skipped packages and of the packages with type errors, which are
+// analyzed partially, with their first error.
+func skipBroken(pkgs []*packages.Package) ([]*packages.Package, []string, []string) {
+	var (
+		ok, partial []*packages.Package
+		skipped     []string
+	)
+
+	for _, pkg := range pkgs {
+		var broken *packages.Package
+
+		packages.Visit([]*packages.Package{pkg}, func(p *packages.Package) bool {
+			if broken == nil && slices.ContainsFunc(p.Errors, func(err packages.Error) bool {
+				return err.Kind != packages.TypeError
+			}) {
+				broken = p
+			}
+
+			return broken == nil
+		}, nil)
+
+		switch {
+		case broken == nil && len(pkg.Errors) > 0:
+			partial = append(partial, pkg)
+		case broken == nil:
+			ok = append(ok, pkg)
+		case broken == pkg:
+			skipped = append(skipped, fmt.Sprintf("%s: %v", pkg.ID, pkg.Errors[0]))
+		default:
+			skipped = append(skipped, fmt.Sprintf("%s: dependency %s: %v", pkg.ID, broken.ID, broken.Errors[0]))
+		}
+	}
+
+	var typeErrors []string
+	for _, pkg := range partial {
+		typeErrors = append(typeErrors, fmt.Sprintf("%s: %v", pkg.ID, pkg.Errors[0]))
+	}
+
+	return append(ok, partial...), skipped, typeErrors
+}
+
+// applying reports whether the analyzer applies fixes.
+func applying() bool {
+	return flag.Lookup("apply").Value.String() == "true"
+}
+
+// auditing reports whether the analyzer records layouts of all structs.
+func auditing() bool {
+	return flag.Lookup("audit").Value.String() == "true"
+}
+
+// baselineFile returns the result file named by the baseline analyzer flag, or "".
+func baselineFile() string {
+	return flag.Lookup("baseline").Value.String()
+}
+
+// gorootPackages returns distinct paths of packages of pkgs with files in GOROOT, such as standard library packages.
+func gorootPackages(pkgs []*packages.Package) []string {
+	var paths []string
+
+	for _, pkg := range pkgs {
+		if len(pkg.GoFiles) > 0 && betteralign.InGoroot(pkg.GoFiles[0]) && !slices.Contains(paths, pkg.PkgPath) {
+			paths = append(paths, pkg.PkgPath)
+		}
+	}
+
+	return paths
+}
+
+// loadErrors returns errors of packages pkgs and their dependencies as operational errors, listing errors of every
+// package once.
+func loadErrors(pkgs []*packages.Package) []betteralign.OperationalError {
+	var errs []betteralign.OperationalError
+
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		for _, err := range pkg.Errors {
+			path := err.Pos
+			if path == "" || path == "-" {
+				path = pkg.ID
+			}
+
+			errs = append(errs, betteralign.OperationalError{Path: path, Stage: betteralign.StageLoad, Error: err.Msg})
+		}
+	})
+
+	return errs
+}
+
+// writeErrorReport writes operational errors errs as a JSON array to the file named by -error_report, if any. An
+// empty array is written when there were no errors, so CI can tell a clean run from a missing report.
+func writeErrorReport(errs []betteralign.OperationalError) error {
+	if errorReport == "" {
+		return nil
+	}
+
+	if errs == nil {
+		errs = []betteralign.OperationalError{}
+	}
+
+	buf, err := json.MarshalIndent(errs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(errorReport, buf, 0o644)
+}
+
+// printPackageErrors prints header, formatted with the number of packages, followed by descriptions of packages
+// with errors, if any.
+func printPackageErrors(header string, pkgs []string) {
+	if len(pkgs) == 0 {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, header+"\n", len(pkgs))
+
+	for _, p := range pkgs {
+		fmt.Fprintf(os.Stderr, "\t%s\n", p)
+	}
+}
+
+// unignoredPackages returns packages of pkgs with at least one file not ignored by git, or without files at all.
+func unignoredPackages(pkgs []*packages.Package) []*packages.Package {
+	var unignored []*packages.Package
+
+	for _, pkg := range pkgs {
+		ignored := len(pkg.CompiledGoFiles) > 0
+
+		for _, fn := range pkg.CompiledGoFiles {
+			if !betteralign.GitIgnored(fn) {
+				ignored = false
+
+				break
+			}
+		}
+
+		if ignored {
+			betteralign.Logger().Info("skipping package ignored by git", "package", pkg.ID)
+
+			continue
+		}
+
+		unignored = append(unignored, pkg)
+	}
+
+	return unignored
+}
+
+// changedPackages returns packages of pkgs with at least one of files.
+func changedPackages(pkgs []*packages.Package, files map[string]bool) []*packages.Package {
+	var changed []*packages.Package
+
+	for _, pkg := range pkgs {
+		for _, fn := range pkg.CompiledGoFiles {
+			if real, err := filepath.EvalSymlinks(fn); err == nil {
+				fn = real
+			}
+
+			if files[fn] {
+				changed = append(changed, pkg)
+
+				break
+			}
+		}
+	}
+
+	betteralign.Logger().Debug("changed packages", "packages", len(changed))
+
+	return changed
+}
+
+// variantFiles returns non-test files of pkgs which are analyzed both in a package and in its test variant, e.g. in
+// foo and foo [foo.test], so that the test variant skips them.
+func variantFiles(pkgs []*packages.Package) map[string]bool {
+	plain := make(map[string]*packages.Package)
+	for _, pkg := range pkgs {
+		if pkg.ID == pkg.PkgPath {
+			plain[pkg.PkgPath] = pkg
+		}
+	}
+
+	files := make(map[string]bool)
+
+	for _, pkg := range pkgs {
+		if p, ok := plain[pkg.PkgPath]; ok && pkg != p && strings.HasSuffix(pkg.ID, ".test]") {
+			for _, fn := range p.CompiledGoFiles {
+				files[fn] = true
+			}
+		}
+	}
+
+	return files
+}
+
+// needFacts reports whether analyzer a or any analyzer it requires uses facts.
+func needFacts(a *analysis.Analyzer) bool {
+	if len(a.FactTypes) > 0 {
+		return true
+	}
+
+	for _, req := range a.Requires {
+		if needFacts(req) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// orderedFindings returns findings of all results ordered by -sort, or by savings when only -top is used, and
+// truncated to -top.
+func orderedFindings(results []*betteralign.Result) []betteralign.Finding {
+	switch {
+	case sortBy == sortHeap:
+		return betteralign.TopHeapFindings(results, top)
+	case sortBy == sortSavings || top > 0:
+		return betteralign.TopFindings(results, top)
+	}
+
+	findings := betteralign.AllFindings(results)
+	betteralign.SortByPosition(findings)
+
+	return findings
+}
+
+// printFindings prints findings as JSON to stdout with -json, or as one line per finding to stderr otherwise.
+func printFindings(findings []betteralign.Finding) error {
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+
+		return enc.Encode(findings)
+	}
+
+	for _, f := range findings {
+		if _, err := fmt.Fprintf(os.Stderr, "%v: %s\n", f.Pos, f.CodedMessage()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printAudit prints layouts of all structs as JSON to stdout with -json, or as one line per struct to stderr
+// otherwise.
+func printAudit(audits []betteralign.StructAudit) error {
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+
+		return enc.Encode(audits)
+	}
+
+	for _, sa := range audits {
+		state := "optimal"
+		if !sa.Optimal {
+			state = fmt.Sprintf("could be %d with %d pointer bytes", sa.OptimalSize, sa.OptimalPtrBytes)
+		}
+
+		if _, err := fmt.Fprintf(os.Stderr, "%v: %s: size %d, align %d, %d pointer bytes, %d padding bytes, %s\n",
+			sa.Pos, sa.Struct, sa.Size, sa.Align, sa.PtrBytes, sa.Padding, state); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printStats prints padding statistics as JSON to stdout with -json, or as text to stderr otherwise.
+func printStats(s betteralign.Stats) error {
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+
+		return enc.Encode(s)
+	}
+
+	return s.WriteText(os.Stderr)
+}
+
+// printPackages prints per package aggregates as JSON to stdout with -json, or as one line per package to stderr
+// otherwise.
+func printPackages(pkgs []betteralign.PackageSummary) error {
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+
+		return enc.Encode(pkgs)
+	}
+
+	for _, ps := range pkgs {
+		if _, err := fmt.Fprintf(os.Stderr, "%s: %d structs suboptimal, %d bytes saved, %d pointer bytes saved\n",
+			ps.Package, ps.Suboptimal, ps.BytesSaved, ps.PtrBytesSaved); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeReports writes the reports requested by driver flags from the collected analyzer results.
+func writeReports(results []*betteralign.Result) error {
+	if histogram {
+		if err := betteralign.WriteHistogram(os.Stderr, betteralign.WasteHistogram(results)); err != nil {
+			return err
+		}
+	}
+
+	if baselineOut != "" {
+		findings := betteralign.AllFindings(results)
+		betteralign.SortByPosition(findings)
+
+		buf, err := json.MarshalIndent(findings, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		if err := maybe.WriteFile(baselineOut, buf, 0o644); err != nil {
+			return err
+		}
+	}
+
+	if fn := flag.Lookup("plan").Value.String(); fn != "" {
+		buf, err := json.MarshalIndent(betteralign.AllPlans(results), "", "  ")
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(fn, buf, 0o644); err != nil {
+			return err
+		}
+	}
+
+	if !summary && !summaryOnly && summaryJSON == "" && badge == "" && metrics == "" {
+		return nil
+	}
+
+	s := betteralign.Summarize(results)
+
+	if summaryOnly && !summary {
+		if _, err := fmt.Fprintf(os.Stderr, "total: %v\n", s.PackageSummary); err != nil {
+			return err
+		}
+	}
+
+	if summary {
+		if err := s.WriteText(os.Stderr); err != nil {
+			return err
+		}
+	}
+
+	if summaryJSON != "" {
+		buf, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(summaryJSON, buf, 0o644); err != nil {
+			return err
+		}
+	}
+
+	if badge != "" {
+		buf, err := json.MarshalIndent(s.Badge(), "", "  ")
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(badge, buf, 0o644); err != nil {
+			return err
+		}
+	}
+
+	if metrics != "" {
+		var buf bytes.Buffer
+		if err := s.WriteMetrics(&buf); err != nil {
+			return err
+		}
+
+		// the textfile collector may read at any time, so the file is replaced atomically
+		if err := maybe.WriteFile(metrics, buf.Bytes(), 0o644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
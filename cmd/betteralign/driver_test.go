@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestExitStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		s    runStatus
+		want int
+	}{
+		{"clean", runStatus{maxWaste: -1}, 0},
+		{"findings", runStatus{diags: 2, maxWaste: -1}, 3},
+		{"errors", runStatus{failed: true, maxWaste: -1}, 1},
+		{"errors with findings", runStatus{failed: true, diags: 2, maxWaste: -1}, 1},
+		{"json format", runStatus{diags: 2, maxWaste: -1, json: true}, 0},
+		{"json format with errors", runStatus{failed: true, diags: 2, maxWaste: -1, json: true}, 1},
+		{"stats", runStatus{diags: 2, maxWaste: -1, advisory: true}, 0},
+		{"stats with errors", runStatus{failed: true, diags: 2, maxWaste: -1, advisory: true}, 1},
+		{"baseline regenerated", runStatus{diags: 2, otherDiags: 1, maxWaste: -1, advisory: true}, 0},
+		{"fixed files", runStatus{diags: 2, maxWaste: -1, fixedFiles: true}, 0},
+		{"waste below max", runStatus{diags: 2, waste: 16, maxWaste: 16}, 0},
+		{"waste above max", runStatus{diags: 2, waste: 24, maxWaste: 16}, 3},
+		{"waste above zero max", runStatus{diags: 1, waste: 8, maxWaste: 0}, 3},
+		{"waste below max with other diagnostics", runStatus{diags: 3, otherDiags: 1, waste: 8, maxWaste: 16}, 3},
+		{"waste above max with stats", runStatus{diags: 2, waste: 24, maxWaste: 16, advisory: true}, 3},
+		{"waste above max with json format", runStatus{diags: 2, waste: 24, maxWaste: 16, json: true}, 3},
+		{"waste above max with errors", runStatus{failed: true, diags: 2, waste: 24, maxWaste: 16}, 1},
+		{"waste below max with baseline", runStatus{diags: 3, otherDiags: 1, waste: 8, maxWaste: 16, advisory: true}, 0},
+		{"audit", runStatus{diags: 2, otherDiags: 1, maxWaste: -1, inventory: true}, 0},
+		{"audit with assert", runStatus{diags: 2, otherDiags: 1, hardDiags: 1, maxWaste: -1, inventory: true}, 3},
+		{"audit with max size", runStatus{diags: 1, otherDiags: 1, hardDiags: 1, maxWaste: -1, inventory: true}, 3},
+		{"audit with errors", runStatus{failed: true, diags: 2, maxWaste: -1, inventory: true}, 1},
+		{"audit with json format", runStatus{diags: 1, otherDiags: 1, hardDiags: 1, maxWaste: -1, inventory: true, json: true}, 0},
+		{"audit with waste below max", runStatus{diags: 2, otherDiags: 1, hardDiags: 1, waste: 8, maxWaste: 16, inventory: true}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitStatus(tt.s); got != tt.want {
+				t.Errorf("exitStatus(%+v) = %d, want %d", tt.s, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/dkorunic/betteralign"
+	"golang.org/x/tools/go/analysis/checker"
+)
+
+const (
+	formatText     = "text"
+	formatEditor   = "editor"
+	formatTemplate = "template"
+	formatJSONL    = "jsonl"
+	formatTAP      = "tap"
+)
+
+var errEmptyTemplate = errors.New("-format=template needs a -template")
+
+// findingTemplate is the parsed -template.
+var findingTemplate *template.Template
+
+// jsonlMu serializes findings streamed by concurrently analyzed packages.
+var jsonlMu sync.Mutex
+
+// templateFinding is a finding as seen by -template: all Finding fields and methods (such as .Saved, .PtrSaved and
+// .Impact), with its position flattened into .Path, .Line and .Column.
+type templateFinding struct {
+	Path string
+	betteralign.Finding
+	Line   int
+	Column int
+}
+
+// printEditor prints cached and analyzed root diagnostics to stdout one per line as file:line:col: message, the
+// format parsed by vim quickfix and Emacs compilation-mode. Multi-line messages, such as layout tables, are cut to
+// their first line.
+func printEditor(cached []*cacheEntry, graph *checker.Graph) error {
+	w := bufio.NewWriter(os.Stdout)
+
+	for _, e := range cached {
+		for _, d := range e.Diagnostics {
+			fmt.Fprintf(w, "%s: %s\n", d.Posn, firstLine(d.Message))
+		}
+	}
+
+	graph.All()(func(act *checker.Action) bool {
+		if act.IsRoot && act.Err == nil {
+			for _, d := range act.Diagnostics {
+				fmt.Fprintf(w, "%s: %s\n", act.Package.Fset.Position(d.Pos), firstLine(d.Message))
+			}
+		}
+
+		return true
+	})
+
+	return w.Flush()
+}
+
+// printGrouped prints cached and analyzed root diagnostics to stderr grouped by package: the package path, its
+// diagnostics and its subtotal. Packages are ordered by path and packages without diagnostics are left out.
+func printGrouped(cached []*cacheEntry, graph *checker.Graph, results []*betteralign.Result) error {
+	diags := make(map[string][]string)
+
+	for _, e := range cached {
+		if e.Result == nil {
+			continue
+		}
+
+		for _, d := range e.Diagnostics {
+			diags[e.Result.Package] = append(diags[e.Result.Package], fmt.Sprintf("%s: %s", d.Posn, d.Message))
+		}
+	}
+
+	graph.All()(func(act *checker.Action) bool {
+		if act.IsRoot && act.Err == nil {
+			for _, d := range act.Diagnostics {
+				diags[act.Package.PkgPath] = append(diags[act.Package.PkgPath],
+					fmt.Sprintf("%s: %s", act.Package.Fset.Position(d.Pos), d.Message))
+			}
+		}
+
+		return true
+	})
+
+	w := bufio.NewWriter(os.Stderr)
+
+	for _, ps := range betteralign.Summarize(results).Packages {
+		lines := diags[ps.Package]
+		if len(lines) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "%s\n", ps.Package)
+
+		for _, line := range lines {
+			fmt.Fprintf(w, "\t%s\n", strings.ReplaceAll(line, "\n", "\n\t"))
+		}
+
+		fmt.Fprintf(w, "\tsubtotal: %v\n\n", ps)
+	}
+
+	return w.Flush()
+}
+
+// firstLine returns s up to its first line break.
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+
+	return line
+}
+
+// parseTemplate parses and checks text as the -template printing every finding.
+func parseTemplate(text string) error {
+	if text == "" {
+		return errEmptyTemplate
+	}
+
+	t, err := template.New("finding").Parse(text)
+	if err != nil {
+		return err
+	}
+
+	// unknown fields are only detected on execution, so catch them before a possibly long analysis
+	if err := t.Execute(io.Discard, templateFinding{}); err != nil {
+		return err
+	}
+
+	findingTemplate = t
+
+	return nil
+}
+
+// printTemplate prints findings to stdout with the -template, one finding per line.
+func printTemplate(findings []betteralign.Finding) error {
+	w := bufio.NewWriter(os.Stdout)
+
+	for _, f := range findings {
+		tf := templateFinding{Finding: f, Path: f.Pos.Filename, Line: f.Pos.Line, Column: f.Pos.Column}
+
+		if err := findingTemplate.Execute(w, tf); err != nil {
+			return err
+		}
+
+		if err := w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+// printJSONL prints finding f to stdout as a single line of JSON, as soon as it is reported.
+func printJSONL(f betteralign.Finding) {
+	buf, err := json.Marshal(f)
+	if err != nil {
+		log.Print(err)
+
+		return
+	}
+
+	jsonlMu.Lock()
+	defer jsonlMu.Unlock()
+
+	if _, err := os.Stdout.Write(append(buf, '\n')); err != nil {
+		log.Print(err)
+	}
+}
+
+// printTAP prints results to stdout in the Test Anything Protocol (version 13): one test point per package ordered
+// by path, which is not ok when the package has suboptimal structs, listed in its YAML diagnostic block. With
+// -audit, there is one test point per analyzed struct instead, which is not ok when its layout is suboptimal.
+func printTAP(results []*betteralign.Result) error {
+	w := bufio.NewWriter(os.Stdout)
+
+	fmt.Fprintln(w, "TAP version 13")
+
+	if auditing() {
+		audits := betteralign.AllAudits(results)
+		fmt.Fprintf(w, "1..%d\n", len(audits))
+
+		for i, sa := range audits {
+			if sa.Optimal {
+				fmt.Fprintf(w, "ok %d - %s.%s\n", i+1, sa.Package, sa.Struct)
+
+				continue
+			}
+
+			fmt.Fprintf(w, "not ok %d - %s.%s\n", i+1, sa.Package, sa.Struct)
+			fmt.Fprintf(w, "  ---\n  message: %s\n  at: %s\n  size: %d\n  optimal_size: %d\n  ...\n",
+				strconv.Quote(fmt.Sprintf("struct of size %d could be %d", sa.Size, sa.OptimalSize)),
+				strconv.Quote(sa.Pos.String()), sa.Size, sa.OptimalSize)
+		}
+
+		return w.Flush()
+	}
+
+	findings := betteralign.AllFindings(results)
+	betteralign.SortByPosition(findings)
+
+	byPkg := make(map[string][]betteralign.Finding)
+	for _, f := range findings {
+		byPkg[f.Package] = append(byPkg[f.Package], f)
+	}
+
+	pkgs := betteralign.Summarize(results).Packages
+	fmt.Fprintf(w, "1..%d\n", len(pkgs))
+
+	for i, ps := range pkgs {
+		if ps.Suboptimal == 0 {
+			fmt.Fprintf(w, "ok %d - %s\n", i+1, ps.Package)
+
+			continue
+		}
+
+		fmt.Fprintf(w, "not ok %d - %s\n", i+1, ps.Package)
+		fmt.Fprintf(w, "  ---\n  message: %s\n  findings:\n",
+			strconv.Quote(fmt.Sprintf("%d structs suboptimal, %d bytes saved", ps.Suboptimal, ps.BytesSaved)))
+
+		for _, f := range byPkg[ps.Package] {
+			fmt.Fprintf(w, "    - %s\n", strconv.Quote(fmt.Sprintf("%v: %s", f.Pos, firstLine(f.CodedMessage()))))
+		}
+
+		fmt.Fprintln(w, "  ...")
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/dkorunic/betteralign"
+	"golang.org/x/tools/go/analysis"
+)
+
+// limitJobs bounds the number of packages analyzed at the same time by a and all analyzers it requires to n, and
+// the number of fixed files written at the same time to n. The checker runs every package in its own goroutine, so
+// otherwise only GOMAXPROCS bounds parallelism.
+func limitJobs(a *analysis.Analyzer, n int) {
+	betteralign.SetWriteConcurrency(n)
+
+	sem := make(chan struct{}, n)
+	seen := make(map[*analysis.Analyzer]bool)
+
+	var limit func(a *analysis.Analyzer)
+	limit = func(a *analysis.Analyzer) {
+		if seen[a] {
+			return
+		}
+
+		seen[a] = true
+
+		// dependencies of a package are analyzed before its own run starts, so holding a slot can't deadlock
+		run := a.Run
+		a.Run = func(pass *analysis.Pass) (any, error) {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			return run(pass)
+		}
+
+		for _, req := range a.Requires {
+			limit(req)
+		}
+	}
+
+	limit(a)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// Flags of the singlechecker driver betteralign used to be built on, kept so existing scripts and Makefiles keep
+// working.
+var (
+	debugFlags   string
+	buildTags    string
+	printFlags   bool
+	legacySource bool
+	legacyAll    bool
+)
+
+var errDebugFlag = errors.New(`expected a subset of "fpstv"`)
+
+// registerLegacyFlags registers the flags of singlechecker drivers: -fix and -v as aliases of -apply and -verbose,
+// -debug, -flags and -tags working as before, and -source and -all without effect.
+func registerLegacyFlags(a *analysis.Analyzer) {
+	if f := a.Flags.Lookup("apply"); f != nil {
+		flag.Var(f.Value, "fix", "alias of -apply")
+	}
+
+	if f := a.Flags.Lookup("verbose"); f != nil {
+		flag.Var(f.Value, "v", "alias of -verbose")
+	}
+
+	flag.StringVar(&debugFlags, "debug", "",
+		`debug flags, any subset of "fpstv": v and t log like -debug_log, p analyzes one package at a time, `+
+			"f and s have no effect")
+	flag.BoolVar(&printFlags, "flags", false, "print analyzer flags in JSON and exit")
+	flag.StringVar(&buildTags, "tags", "", "comma-separated list of build tags passed to package loading")
+	flag.BoolVar(&legacySource, "source", false, "no effect (deprecated)")
+	flag.BoolVar(&legacyAll, "all", false, "no effect (deprecated)")
+}
+
+// applyLegacyFlags applies -debug to a and warns about deprecated flags used.
+func applyLegacyFlags(a *analysis.Analyzer) error {
+	if legacySource || legacyAll {
+		log.Print("-source and -all have no effect and are deprecated")
+	}
+
+	for _, c := range debugFlags {
+		switch c {
+		case 'v', 't':
+			if err := a.Flags.Set("debug_log", "true"); err != nil {
+				return err
+			}
+		case 'p':
+			if jobs == 0 {
+				jobs = 1
+			}
+		case 'f', 's':
+		default:
+			return fmt.Errorf("-debug %q: %w", debugFlags, errDebugFlag)
+		}
+	}
+
+	return nil
+}
+
+// printFlagsJSON prints all flags to stdout in the JSON format of singlechecker drivers, as read by tools wrapping
+// analyzers, e.g. go vet -vettool.
+func printFlagsJSON() error {
+	type jsonFlag struct {
+		Name  string
+		Usage string
+		Bool  bool
+	}
+
+	var flags []jsonFlag
+
+	flag.VisitAll(func(f *flag.Flag) {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+
+		flags = append(flags, jsonFlag{Name: f.Name, Usage: f.Usage, Bool: ok && b.IsBoolFlag()})
+	})
+
+	buf, err := json.MarshalIndent(flags, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(os.Stdout, strings.TrimSpace(string(buf)))
+
+	return err
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/dkorunic/betteralign"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/checker"
+	"golang.org/x/tools/go/packages"
+)
+
+// LSP constants used by the server.
+const (
+	lspSeverityWarning = 2
+	lspSyncFull        = 1
+	lspMethodNotFound  = -32601
+	lspInvalidParams   = -32602
+)
+
+// lspServer is a minimal language server publishing diagnostics of open documents and offering a code action to
+// reorder struct fields. It speaks JSON-RPC over a stream, as editors do with stdio language servers.
+type lspServer struct {
+	a        *analysis.Analyzer
+	r        *bufio.Reader
+	w        io.Writer
+	docs     map[string][]byte
+	findings map[string][]betteralign.Finding
+}
+
+// lspMessage is a JSON-RPC request, notification or response.
+type lspMessage struct {
+	ID     *json.RawMessage `json:"id,omitempty"`
+	Method string           `json:"method,omitempty"`
+	Params json.RawMessage  `json:"params,omitempty"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspDiagnostic struct {
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+	Code     string   `json:"code,omitempty"`
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+}
+
+type lspTextEdit struct {
+	NewText string   `json:"newText"`
+	Range   lspRange `json:"range"`
+}
+
+type lspCodeAction struct {
+	Edit        map[string]map[string][]lspTextEdit `json:"edit"`
+	Title       string                              `json:"title"`
+	Kind        string                              `json:"kind"`
+	Diagnostics []lspDiagnostic                     `json:"diagnostics,omitempty"`
+}
+
+type lspDocumentParams struct {
+	TextDocument struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+	Range lspRange `json:"range"`
+}
+
+// serveLSP runs the language server on r and w until the client exits.
+func serveLSP(a *analysis.Analyzer, r io.Reader, w io.Writer) int {
+	// editors own unsaved buffers, so never write files
+	if err := a.Flags.Set("apply", "false"); err != nil {
+		log.Print(err)
+	}
+
+	s := &lspServer{
+		a:        a,
+		r:        bufio.NewReader(r),
+		w:        w,
+		docs:     make(map[string][]byte),
+		findings: make(map[string][]betteralign.Finding),
+	}
+
+	for {
+		msg, err := s.read()
+		if err != nil {
+			if err != io.EOF {
+				log.Print(err)
+
+				return 1
+			}
+
+			return 0
+		}
+
+		if msg.Method == "exit" {
+			return 0
+		}
+
+		result, err := s.handle(msg)
+
+		// notifications get no response
+		if msg.ID == nil {
+			if err != nil {
+				log.Printf("%s: %v", msg.Method, err)
+			}
+
+			continue
+		}
+
+		resp := map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": result}
+		if err != nil {
+			code := lspInvalidParams
+			if err == errMethodNotFound {
+				code = lspMethodNotFound
+			}
+
+			resp = map[string]any{"jsonrpc": "2.0", "id": msg.ID, "error": map[string]any{
+				"code":    code,
+				"message": err.Error(),
+			}}
+		}
+
+		if err := s.write(resp); err != nil {
+			log.Print(err)
+
+			return 1
+		}
+	}
+}
+
+var errMethodNotFound = fmt.Errorf("method not found")
+
+// handle dispatches a single message and returns the result of a request.
+func (s *lspServer) handle(msg *lspMessage) (any, error) {
+	var p lspDocumentParams
+
+	if len(msg.Params) > 0 && strings.HasPrefix(msg.Method, "textDocument/") {
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, err
+		}
+	}
+
+	fn := uriToPath(p.TextDocument.URI)
+
+	switch msg.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync": map[string]any{
+					"openClose": true,
+					"change":    lspSyncFull,
+					"save":      map[string]any{"includeText": false},
+				},
+				"codeActionProvider": map[string]any{"codeActionKinds": []string{"quickfix"}},
+			},
+			"serverInfo": map[string]any{"name": "betteralign", "version": GitTag},
+		}, nil
+	case "shutdown":
+		return nil, nil
+	case "textDocument/didOpen":
+		s.docs[fn] = []byte(p.TextDocument.Text)
+
+		return nil, s.analyze(fn)
+	case "textDocument/didChange":
+		if n := len(p.ContentChanges); n > 0 {
+			s.docs[fn] = []byte(p.ContentChanges[n-1].Text)
+		}
+
+		return nil, s.analyze(fn)
+	case "textDocument/didSave":
+		return nil, s.analyze(fn)
+	case "textDocument/didClose":
+		delete(s.docs, fn)
+		delete(s.findings, fn)
+
+		return nil, s.publish(fn, nil)
+	case "textDocument/codeAction":
+		return s.codeActions(fn, p.Range), nil
+	}
+
+	if msg.ID != nil {
+		return nil, errMethodNotFound
+	}
+
+	return nil, nil
+}
+
+// analyze analyzes the package containing file fn, with contents of open documents, and publishes diagnostics of
+// all open documents in it.
+func (s *lspServer) analyze(fn string) error {
+	betteralign.Reset()
+
+	conf := packages.Config{
+		Mode:       packages.LoadSyntax | packages.NeedModule,
+		Tests:      includeTests,
+		Dir:        filepath.Dir(fn),
+		Overlay:    s.docs,
+		BuildFlags: buildFlags(),
+	}
+
+	if needFacts(s.a) {
+		conf.Mode = packages.LoadAllSyntax | packages.NeedModule
+	}
+
+	pkgs, err := packages.Load(&conf, "file="+fn)
+	if err != nil {
+		return err
+	}
+
+	betteralign.SetVariantFiles(variantFiles(pkgs))
+
+	graph, err := checker.Analyze([]*analysis.Analyzer{s.a}, pkgs, nil)
+	if err != nil {
+		return err
+	}
+
+	diags := make(map[string][]lspDiagnostic)
+	findings := make(map[string][]betteralign.Finding)
+
+	for _, pkg := range pkgs {
+		for _, f := range pkg.CompiledGoFiles {
+			if _, ok := s.docs[f]; ok {
+				diags[f] = []lspDiagnostic{}
+			}
+		}
+	}
+
+	for _, act := range graph.Roots {
+		if act.Err != nil {
+			log.Print(act.Err)
+
+			continue
+		}
+
+		for _, d := range act.Diagnostics {
+			start, end := act.Package.Fset.Position(d.Pos), act.Package.Fset.Position(d.End)
+			if !end.IsValid() {
+				end = start
+			}
+
+			src := s.source(start.Filename)
+			diags[start.Filename] = append(diags[start.Filename], lspDiagnostic{
+				Range: lspRange{
+					Start: lspPos(src, start.Line, start.Column),
+					End:   lspPos(src, end.Line, end.Column),
+				},
+				Severity: lspSeverityWarning,
+				Source:   s.a.Name,
+				Message:  d.Message,
+				Code:     d.Category,
+			})
+		}
+
+		if r, ok := act.Result.(*betteralign.Result); ok && r != nil {
+			for _, f := range r.Findings {
+				findings[f.Pos.Filename] = append(findings[f.Pos.Filename], f)
+			}
+		}
+	}
+
+	for f, d := range diags {
+		s.findings[f] = findings[f]
+
+		if err := s.publish(f, d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// codeActions returns actions reordering fields of reported structs in file fn declared within range rng.
+func (s *lspServer) codeActions(fn string, rng lspRange) []lspCodeAction {
+	actions := []lspCodeAction{}
+
+	src, ok := s.docs[fn]
+	if !ok {
+		return actions
+	}
+
+	for _, f := range s.findings[fn] {
+		if f.Pinned != "" || f.Order == nil || f.Pos.Line-1 < rng.Start.Line || f.Pos.Line-1 > rng.End.Line {
+			continue
+		}
+
+		fixed, err := betteralign.ReorderFields(fn, src, f.Pos.Offset, f.Order)
+		if err != nil {
+			log.Print(err)
+
+			continue
+		}
+
+		actions = append(actions, lspCodeAction{
+			Title: "Reorder fields of " + f.Struct,
+			Kind:  "quickfix",
+			Edit: map[string]map[string][]lspTextEdit{"changes": {
+				pathToURI(fn): {{
+					Range:   lspRange{End: lspEnd(src)},
+					NewText: string(fixed),
+				}},
+			}},
+		})
+	}
+
+	return actions
+}
+
+// publish sends diagnostics of file fn to the client.
+func (s *lspServer) publish(fn string, diags []lspDiagnostic) error {
+	if diags == nil {
+		diags = []lspDiagnostic{}
+	}
+
+	return s.write(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "textDocument/publishDiagnostics",
+		"params":  map[string]any{"uri": pathToURI(fn), "diagnostics": diags},
+	})
+}
+
+// source returns contents of file fn, preferring the open document.
+func (s *lspServer) source(fn string) []byte {
+	if src, ok := s.docs[fn]; ok {
+		return src
+	}
+
+	src, _ := os.ReadFile(fn)
+
+	return src
+}
+
+// read reads a single message framed with a Content-Length header.
+func (s *lspServer) read() (*lspMessage, error) {
+	length := -1
+
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+
+		if v, ok := strings.CutPrefix(line, "Content-Length:"); ok {
+			if length, err = strconv.Atoi(strings.TrimSpace(v)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if length < 0 {
+		return nil, fmt.Errorf("missing Content-Length header")
+	}
+
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(s.r, buf); err != nil {
+		return nil, err
+	}
+
+	var msg lspMessage
+	if err := json.Unmarshal(buf, &msg); err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
+
+// write writes a single message framed with a Content-Length header.
+func (s *lspServer) write(v any) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(s.w, "Content-Length: %d\r\n\r\n%s", len(buf), buf)
+
+	return err
+}
+
+// lspPos converts a 1-based line and byte column in src to a 0-based LSP position counting UTF-16 code units.
+func lspPos(src []byte, line, col int) lspPosition {
+	start := 0
+	for l := 1; l < line && start < len(src); l++ {
+		i := strings.IndexByte(string(src[start:]), '\n')
+		if i < 0 {
+			break
+		}
+		start += i + 1
+	}
+
+	end := min(start+max(col-1, 0), len(src))
+
+	chars := 0
+	for b := src[start:end]; len(b) > 0; {
+		r, n := utf8.DecodeRune(b)
+		chars += utf16.RuneLen(r)
+		b = b[n:]
+	}
+
+	return lspPosition{Line: max(line-1, 0), Character: chars}
+}
+
+// lspEnd returns the LSP position of the end of src.
+func lspEnd(src []byte) lspPosition {
+	line := strings.Count(string(src), "\n")
+	last := strings.LastIndexByte(string(src), '\n') + 1
+
+	return lspPos(src, line+1, len(src)-last+1)
+}
+
+// uriToPath returns the file name of a file URI.
+func uriToPath(uri string) string {
+	return filepath.FromSlash(uriToSlash(uri, runtime.GOOS == "windows"))
+}
+
+// uriToSlash returns the file name of a file URI with forward slashes. On windows, the leading slash of drive letter
+// paths (file:///C:/dir) is dropped and hosts name UNC shares (file://server/share).
+func uriToSlash(uri string, windows bool) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+
+	if !windows {
+		return u.Path
+	}
+
+	if u.Host != "" {
+		return "//" + u.Host + u.Path
+	}
+
+	return strings.TrimPrefix(u.Path, "/")
+}
+
+// pathToURI returns the file URI of file name fn.
+func pathToURI(fn string) string {
+	return slashToURI(filepath.ToSlash(fn))
+}
+
+// slashToURI returns the file URI of file name p with forward slashes, percent-encoding characters as needed. Drive
+// letter paths (C:/dir) get a leading slash and UNC paths (//server/share) name the host.
+func slashToURI(p string) string {
+	u := &url.URL{Scheme: "file", Path: p}
+
+	if rest, ok := strings.CutPrefix(p, "//"); ok {
+		host, path, _ := strings.Cut(rest, "/")
+		u.Host, u.Path = host, "/"+path
+	} else if !strings.HasPrefix(p, "/") {
+		u.Path = "/" + p
+	}
+
+	return u.String()
+}
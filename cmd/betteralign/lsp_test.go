@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLSPFraming(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := &lspServer{w: &buf}
+
+	id := json.RawMessage("1")
+	msgs := []*lspMessage{
+		{ID: &id, Method: "initialize", Params: json.RawMessage(`{"rootUri":"file:///src"}`)},
+		{Method: "textDocument/didOpen", Params: json.RawMessage(`{"textDocument":{"text":"// héllo 😀\n"}}`)},
+		{Method: "exit"},
+	}
+
+	for _, msg := range msgs {
+		if err := w.write(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &lspServer{r: bufio.NewReader(&buf)}
+
+	for _, want := range msgs {
+		got, err := r.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(want)
+
+		if !bytes.Equal(gotJSON, wantJSON) {
+			t.Errorf("read %s, want %s", gotJSON, wantJSON)
+		}
+	}
+
+	if _, err := r.read(); err == nil {
+		t.Error("read past the last message")
+	}
+}
+
+func TestLSPReadHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		method string
+		ok     bool
+	}{
+		{"content type", "Content-Type: application/vscode-jsonrpc; charset=utf-8\r\nContent-Length: 17\r\n\r\n" +
+			`{"method":"exit"}`, "exit", true},
+		{"bare newlines", "Content-Length: 17\n\n" + `{"method":"exit"}`, "exit", true},
+		{"missing length", "Content-Type: application/json\r\n\r\n" + `{"method":"exit"}`, "", false},
+		{"invalid length", "Content-Length: x\r\n\r\n" + `{"method":"exit"}`, "", false},
+		{"truncated body", "Content-Length: 30\r\n\r\n" + `{"method":"exit"}`, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := (&lspServer{r: bufio.NewReader(strings.NewReader(tt.input))}).read()
+			if (err == nil) != tt.ok {
+				t.Fatalf("read() error = %v, want ok %t", err, tt.ok)
+			}
+
+			if err == nil && msg.Method != tt.method {
+				t.Errorf("read() method = %q, want %q", msg.Method, tt.method)
+			}
+		})
+	}
+}
+
+func TestLSPPos(t *testing.T) {
+	src := []byte("package a\n\nvar s = \"héllo 😀\" // x\n\tvar t\n")
+
+	// byte column of x on line 3, after a 2-byte é and a 4-byte emoji taking 2 UTF-16 code units
+	third := strings.Split(string(src), "\n")[2]
+	col := strings.IndexByte(third, 'x') + 1
+
+	tests := []struct {
+		name      string
+		line, col int
+		want      lspPosition
+	}{
+		{"start", 1, 1, lspPosition{Line: 0, Character: 0}},
+		{"ascii", 1, 9, lspPosition{Line: 0, Character: 8}},
+		{"empty line", 2, 1, lspPosition{Line: 1, Character: 0}},
+		{"before non-ascii", 3, 11, lspPosition{Line: 2, Character: 10}},
+		{"after two-byte rune", 3, 13, lspPosition{Line: 2, Character: 11}},
+		{"after surrogate pair", 3, col, lspPosition{Line: 2, Character: 22}},
+		{"tab", 4, 2, lspPosition{Line: 3, Character: 1}},
+		{"past the end", 5, 10, lspPosition{Line: 4, Character: 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lspPos(src, tt.line, tt.col); got != tt.want {
+				t.Errorf("lspPos(%d, %d) = %+v, want %+v", tt.line, tt.col, got, tt.want)
+			}
+		})
+	}
+
+	if got, want := lspEnd(src), (lspPosition{Line: 4, Character: 0}); got != want {
+		t.Errorf("lspEnd() = %+v, want %+v", got, want)
+	}
+}
+
+func TestURIConversion(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		uri     string
+		windows bool
+	}{
+		{"unix", "/src/a/a.go", "file:///src/a/a.go", false},
+		{"unix spaces", "/src/my dir/a.go", "file:///src/my%20dir/a.go", false},
+		{"unix reserved", "/src/a#b/100%.go", "file:///src/a%23b/100%25.go", false},
+		{"unix non-ascii", "/src/čćž/a.go", "file:///src/%C4%8D%C4%87%C5%BE/a.go", false},
+		{"drive letter", "C:/Users/a/a.go", "file:///C:/Users/a/a.go", true},
+		{"drive letter spaces", "C:/Program Files/a.go", "file:///C:/Program%20Files/a.go", true},
+		{"unc share", "//server/share/a.go", "file://server/share/a.go", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := slashToURI(tt.path); got != tt.uri {
+				t.Errorf("slashToURI(%q) = %q, want %q", tt.path, got, tt.uri)
+			}
+
+			if got := uriToSlash(tt.uri, tt.windows); got != tt.path {
+				t.Errorf("uriToSlash(%q) = %q, want %q", tt.uri, got, tt.path)
+			}
+		})
+	}
+
+	// editors percent-encode drive letter colons and may lowercase them
+	for uri, want := range map[string]string{
+		"file:///c%3A/Users/a/a.go":  "c:/Users/a/a.go",
+		"file:///C%3a/My%20Dir/a.go": "C:/My Dir/a.go",
+		"untitled:Untitled-1":        "untitled:Untitled-1",
+	} {
+		if got := uriToSlash(uri, true); got != want {
+			t.Errorf("uriToSlash(%q) = %q, want %q", uri, got, want)
+		}
+	}
+}
@@ -7,27 +7,109 @@
 package main
 
 import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+
 	"github.com/KimMachineGun/automemlimit/memlimit"
 	"github.com/dkorunic/betteralign"
 	"go.uber.org/automaxprocs/maxprocs"
-	"golang.org/x/tools/go/analysis/singlechecker"
 )
 
-const maxMemRatio = 0.9
+// defaultMemRatio is the default ratio of the cgroup or system memory set as the Go memory limit.
+const defaultMemRatio = 0.9
+
+// subcommand stands for analyzer and driver flags, so the growing feature set has a coherent command surface while
+// the plain flag interface keeps working.
+type subcommand struct {
+	usage string
+	flags []string
+}
+
+// subcommands map a leading command name to the flags it stands for.
+var subcommands = map[string]subcommand{
+	"check":  {usage: "report suboptimal structs (default)"},
+	"apply":  {usage: "reorder fields of suboptimal structs in place", flags: []string{"-apply"}},
+	"layout": {usage: "print layout of struct types matching a name: layout <type> [packages]"},
+	"bench": {
+		usage: "write a benchmark of a struct type in current and optimal field order: bench <type> [packages]",
+	},
+	"report": {
+		usage: "report suboptimal structs and total waste per package, or findings introduced and fixed between " +
+			"result files: report -baseline old.json -current new.json",
+		flags: []string{"-per_package"},
+	},
+	"version": {usage: "print version and exit", flags: []string{"-V"}},
+	"comment": {
+		usage: "post or update a summary comment with findings on a GitHub pull request instead of failing: " +
+			"comment -repo owner/name -pr N [packages]",
+		flags: []string{"-comment"},
+	},
+	"stats": {
+		usage: "print aggregate padding statistics and top packages by recoverable bytes",
+		flags: []string{"-stats"},
+	},
+	"self-update": {
+		usage: "replace this binary with the latest release",
+		flags: []string{"-self_update"},
+	},
+	"viz":   {usage: "render current and optimal layouts of suboptimal structs as SVG", flags: []string{"-viz=svg"}},
+	"serve": {usage: "serve an HTTP/JSON analysis API on localhost:8080", flags: []string{"-serve=localhost:8080"}},
+	"play":  {usage: "serve a web playground on localhost:8081", flags: []string{"-play=localhost:8081"}},
+}
 
 func main() {
-	_, _ = memlimit.SetGoMemLimitWithOpts(
-		memlimit.WithRatio(maxMemRatio),
-		memlimit.WithProvider(
-			memlimit.ApplyFallback(
-				memlimit.FromCgroup,
-				memlimit.FromSystem,
+	if len(os.Args) > 1 {
+		// layout and bench take the type name as their first argument: betteralign layout <type> [packages]
+		if (os.Args[1] == "layout" || os.Args[1] == "bench") && len(os.Args) > 2 {
+			os.Args = append([]string{os.Args[0], "-" + os.Args[1] + "=" + os.Args[2]}, os.Args[3:]...)
+		} else if cmd, ok := subcommands[os.Args[1]]; ok {
+			os.Args = append(append([]string{os.Args[0]}, cmd.flags...), os.Args[2:]...)
+		}
+
+		if len(os.Args) == 2 && (strings.HasPrefix(os.Args[1], "-layout=") || strings.HasPrefix(os.Args[1], "-bench=")) {
+			os.Args = append(os.Args, ".")
+		}
+	}
+
+	registerFlags(betteralign.Analyzer)
+	flag.Parse()
+
+	if memRatio < 0 || memRatio > 1 {
+		log.Printf("invalid -memlimit_ratio value %v, expected a ratio between 0 and 1", memRatio)
+		os.Exit(1)
+	}
+
+	undo := setLimits()
+
+	exitCode := runDriver(betteralign.Analyzer, flag.Args())
+
+	undo()
+	os.Exit(exitCode)
+}
+
+// setLimits sets the Go memory limit to -memlimit_ratio of the cgroup or system memory and GOMAXPROCS to the cgroup
+// CPU quota, unless -no_auto_limits is used. Detected cgroup limits can make the GC run excessively in some container
+// setups. It returns a function restoring GOMAXPROCS.
+func setLimits() func() {
+	if noAutoLimits {
+		return func() {}
+	}
+
+	if memRatio > 0 {
+		_, _ = memlimit.SetGoMemLimitWithOpts(
+			memlimit.WithRatio(memRatio),
+			memlimit.WithProvider(
+				memlimit.ApplyFallback(
+					memlimit.FromCgroup,
+					memlimit.FromSystem,
+				),
 			),
-		),
-	)
+		)
+	}
 
 	undo, _ := maxprocs.Set()
-	defer undo()
 
-	singlechecker.Main(betteralign.Analyzer)
+	return undo
 }
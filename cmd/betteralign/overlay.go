@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dkorunic/betteralign"
+)
+
+// overlayReplace maps absolute names of files replaced by the -overlay file to absolute names of their replacements.
+var overlayReplace map[string]string
+
+// loadOverlay reads the overlay file fn in the format of go build -overlay, with relative names resolved against
+// the current directory, and returns contents of all replacement files keyed by names of files they replace. The
+// analyzer is set up to read and fix the replacement files.
+func loadOverlay(fn string) (map[string][]byte, error) {
+	buf, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	var o struct {
+		Replace map[string]string
+	}
+
+	if err := json.Unmarshal(buf, &o); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	files := make(map[string][]byte, len(o.Replace))
+	overlayReplace = make(map[string]string, len(o.Replace))
+
+	for name, replacement := range o.Replace {
+		// go/packages overlays only replace contents, so deleting files isn't supported
+		if replacement == "" {
+			return nil, fmt.Errorf("%s: deleting %s is not supported", fn, name)
+		}
+
+		name, err := filepath.Abs(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if replacement, err = filepath.Abs(replacement); err != nil {
+			return nil, err
+		}
+
+		if files[name], err = os.ReadFile(replacement); err != nil {
+			return nil, err
+		}
+
+		overlayReplace[name] = replacement
+	}
+
+	betteralign.SetOverlay(overlayReplace)
+
+	return files, nil
+}
+
+// overlayName returns the name of the file replacing fn in the -overlay file, or fn itself.
+func overlayName(fn string) string {
+	if r, ok := overlayReplace[fn]; ok {
+		return r
+	}
+
+	return fn
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"log"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/dkorunic/betteralign"
+)
+
+// maxSnippetSize limits the size of snippets submitted to the playground.
+const maxSnippetSize = 1 << 20
+
+//go:embed play.html
+var playPage []byte
+
+// playRequest holds a snippet to analyze on target architecture GOARCH, defaulting to the host architecture.
+type playRequest struct {
+	Source string `json:"source"`
+	GOARCH string `json:"goarch"`
+}
+
+// play runs a local web UI on addr, rendering layouts, padding holes and optimal order of pasted struct types.
+func play(addr string) int {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(playPage)
+	})
+	mux.HandleFunc("POST /analyze", handlePlay)
+
+	log.Printf("playground on http://%s/", addr)
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	if err := srv.ListenAndServe(); err != nil {
+		log.Print(err)
+
+		return 1
+	}
+
+	return 0
+}
+
+func handlePlay(w http.ResponseWriter, r *http.Request) {
+	var req playRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSnippetSize)).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if req.GOARCH == "" {
+		req.GOARCH = runtime.GOARCH
+	}
+
+	snippet, err := betteralign.AnalyzeSnippet(req.Source, req.GOARCH)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(snippet); err != nil {
+		log.Print(err)
+	}
+}
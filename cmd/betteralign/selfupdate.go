@@ -0,0 +1,375 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/google/renameio/v2/maybe"
+	"golang.org/x/mod/semver"
+)
+
+const (
+	// releasesURL is the GitHub API endpoint of the latest betteralign release.
+	releasesURL = "https://api.github.com/repos/dkorunic/betteralign/releases/latest"
+	// checksumsName is the name of the release asset holding SHA-256 checksums of all archives.
+	checksumsName = "checksums.txt"
+	// maxDownloadSize limits the size of downloaded release assets.
+	maxDownloadSize = 256 << 20
+)
+
+var (
+	errNoAsset          = errors.New("no release archive for this platform")
+	errNoChecksum       = errors.New("no checksum for release archive")
+	errChecksumMismatch = errors.New("checksum mismatch")
+	errNoBinary         = errors.New("no betteralign binary in release archive")
+	errReleaseTag       = errors.New("release tag is not a semantic version")
+	errDevelBuild       = errors.New("development build of unknown version")
+)
+
+// writeFile writes a file atomically where the platform supports it. It is a variable, so tests can fail writes.
+var writeFile = maybe.WriteFile
+
+// release is the subset of GitHub release metadata used by self-update.
+type release struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// selfUpdate replaces the running binary with the latest GitHub release for this platform, after verifying the
+// release archive against the published SHA-256 checksums.
+func selfUpdate() int {
+	client := &http.Client{Timeout: 5 * time.Minute}
+
+	var rel release
+	if err := fetchJSON(client, releasesURL, &rel); err != nil {
+		log.Printf("checking latest release: %v", err)
+
+		return 1
+	}
+
+	current := currentVersion()
+
+	update, err := needsUpdate(rel.TagName, current)
+
+	switch {
+	case errors.Is(err, errDevelBuild):
+		log.Printf("not updating a development build of unknown version to %s, install a release instead", rel.TagName)
+
+		return 1
+	case err != nil:
+		log.Printf("checking latest release: %v", err)
+
+		return 1
+	case !update:
+		fmt.Printf("betteralign %s is up to date\n", current)
+
+		return 0
+	}
+
+	if err := installRelease(client, &rel); err != nil {
+		log.Printf("updating to %s: %v", rel.TagName, err)
+
+		return 1
+	}
+
+	fmt.Printf("betteralign updated to %s\n", rel.TagName)
+
+	return 0
+}
+
+// currentVersion returns the version of the running binary: its release tag, or the module version of binaries built
+// with go install. It is empty or not a semantic version for development builds.
+func currentVersion() string {
+	info, _ := debug.ReadBuildInfo()
+
+	return buildVersion(GitTag, info)
+}
+
+// buildVersion returns release tag gitTag, or the main module version recorded in build info, which is "(devel)"
+// for builds of a working tree.
+func buildVersion(gitTag string, info *debug.BuildInfo) string {
+	if gitTag != "" {
+		return gitTag
+	}
+
+	if info != nil {
+		return info.Main.Version
+	}
+
+	return ""
+}
+
+// needsUpdate reports whether release tag latest is newer than version current of the running binary, both compared
+// as semantic versions with an optional v prefix. Builds newer than the latest release, e.g. of a release candidate,
+// are not downgraded.
+func needsUpdate(latest, current string) (bool, error) {
+	latestV, currentV := canonicalVersion(latest), canonicalVersion(current)
+
+	if !semver.IsValid(latestV) {
+		return false, fmt.Errorf("%w: %q", errReleaseTag, latest)
+	}
+
+	if !semver.IsValid(currentV) {
+		return false, fmt.Errorf("%w: %q", errDevelBuild, current)
+	}
+
+	return semver.Compare(latestV, currentV) > 0, nil
+}
+
+// canonicalVersion returns version v with the v prefix semantic versions are compared with.
+func canonicalVersion(v string) string {
+	if v == "" || strings.HasPrefix(v, "v") {
+		return v
+	}
+
+	return "v" + v
+}
+
+// installRelease downloads, verifies and installs the release archive of this platform over the running binary.
+func installRelease(client *http.Client, rel *release) error {
+	name := archiveName(runtime.GOOS, runtime.GOARCH, buildSetting("GOARM"))
+
+	var archiveURL, checksumsURL string
+
+	for _, a := range rel.Assets {
+		switch a.Name {
+		case name:
+			archiveURL = a.URL
+		case checksumsName:
+			checksumsURL = a.URL
+		}
+	}
+
+	if archiveURL == "" {
+		return fmt.Errorf("%w: %s", errNoAsset, name)
+	}
+
+	if checksumsURL == "" {
+		return fmt.Errorf("%w: %s", errNoChecksum, name)
+	}
+
+	sums, err := fetch(client, checksumsURL)
+	if err != nil {
+		return err
+	}
+
+	archive, err := fetch(client, archiveURL)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyChecksum(sums, name, archive); err != nil {
+		return err
+	}
+
+	bin, err := archiveBinary(archive, strings.HasSuffix(name, ".zip"))
+	if err != nil {
+		return err
+	}
+
+	return replaceExecutable(bin)
+}
+
+// archiveName returns the release archive name of a platform, following archive name template of .goreleaser.yml.
+// Darwin binaries are released as a single universal binary.
+func archiveName(goos, goarch, goarm string) string {
+	arch := goarch
+
+	switch {
+	case goos == "darwin":
+		arch = "all"
+	case goarch == "amd64":
+		arch = "x86_64"
+	case goarch == "386":
+		arch = "i386"
+	case goarch == "arm":
+		if goarm == "" {
+			goarm = "6"
+		}
+
+		arch += "v" + strings.TrimSuffix(strings.TrimSuffix(goarm, ",softfloat"), ",hardfloat")
+	}
+
+	ext := ".tar.gz"
+	if goos == "windows" {
+		ext = ".zip"
+	}
+
+	return "betteralign_" + strings.ToUpper(goos[:1]) + goos[1:] + "_" + arch + ext
+}
+
+// buildSetting returns the value of build setting key of the running binary, if known.
+func buildSetting(key string) string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == key {
+				return s.Value
+			}
+		}
+	}
+
+	return ""
+}
+
+// verifyChecksum verifies SHA-256 checksum of archive name against checksums file sums in sha256sum format.
+func verifyChecksum(sums []byte, name string, archive []byte) error {
+	sum := sha256.Sum256(archive)
+
+	sc := bufio.NewScanner(bytes.NewReader(sums))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+
+		if !strings.EqualFold(fields[0], hex.EncodeToString(sum[:])) {
+			return fmt.Errorf("%w: %s", errChecksumMismatch, name)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", errNoChecksum, name)
+}
+
+// archiveBinary returns the betteralign binary contained in a gzipped tar or, if isZip is set, zip release archive.
+func archiveBinary(archive []byte, isZip bool) ([]byte, error) {
+	isBinary := func(name string) bool {
+		base := path.Base(name)
+
+		return base == "betteralign" || base == "betteralign.exe"
+	}
+
+	if isZip {
+		zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range zr.File {
+			if !isBinary(f.Name) {
+				continue
+			}
+
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+
+			return io.ReadAll(io.LimitReader(rc, maxDownloadSize))
+		}
+
+		return nil, errNoBinary
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil, errNoBinary
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if h.Typeflag == tar.TypeReg && isBinary(h.Name) {
+			return io.ReadAll(io.LimitReader(tr, maxDownloadSize))
+		}
+	}
+}
+
+// replaceExecutable atomically replaces the running binary with bin. Windows doesn't allow replacing a running
+// binary, so it is moved aside first.
+func replaceExecutable(bin []byte) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+
+	return replaceFile(exe, bin, runtime.GOOS == "windows")
+}
+
+// replaceFile replaces file exe with bin, keeping its mode. With moveAside, exe is moved to a .old file first, and
+// moved back when writing bin fails.
+func replaceFile(exe string, bin []byte, moveAside bool) error {
+	st, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+
+	if !moveAside {
+		return writeFile(exe, bin, st.Mode())
+	}
+
+	old := exe + ".old"
+	_ = os.Remove(old)
+
+	if err := os.Rename(exe, old); err != nil {
+		return err
+	}
+
+	if err := writeFile(exe, bin, st.Mode()); err != nil {
+		return errors.Join(err, os.Rename(old, exe))
+	}
+
+	return nil
+}
+
+// fetch returns the body of url.
+func fetch(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize))
+}
+
+// fetchJSON decodes JSON body of url into v.
+func fetchJSON(client *http.Client, url string, v any) error {
+	buf, err := fetch(client, url)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(buf, v)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+)
+
+func TestBuildVersion(t *testing.T) {
+	tests := []struct {
+		name   string
+		gitTag string
+		info   *debug.BuildInfo
+		want   string
+	}{
+		{"release", "v0.7.0", &debug.BuildInfo{Main: debug.Module{Version: "(devel)"}}, "v0.7.0"},
+		{"go install", "", &debug.BuildInfo{Main: debug.Module{Version: "v0.7.1"}}, "v0.7.1"},
+		{"devel", "", &debug.BuildInfo{Main: debug.Module{Version: "(devel)"}}, "(devel)"},
+		{"no build info", "", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildVersion(tt.gitTag, tt.info); got != tt.want {
+				t.Errorf("buildVersion(%q) = %q, want %q", tt.gitTag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNeedsUpdate(t *testing.T) {
+	tests := []struct {
+		latest  string
+		current string
+		want    bool
+		err     error
+	}{
+		{"v0.7.1", "v0.7.0", true, nil},
+		{"v0.7.0", "v0.7.0", false, nil},
+		{"v0.7.0", "v0.7.1", false, nil},
+		{"v0.10.0", "v0.9.0", true, nil},
+		{"v0.7.0", "0.6.0", true, nil},
+		{"0.7.0", "v0.7.0", false, nil},
+		{"v0.7.0", "v0.7.0-rc.1", true, nil},
+		{"v0.7.0", "v0.8.0-rc.1", false, nil},
+		{"v0.7.0-rc.2", "v0.7.0-rc.1", true, nil},
+		{"v0.7.0", "v0.6.1-0.20241001000000-abcdef123456", true, nil},
+		{"v0.7.0", "(devel)", false, errDevelBuild},
+		{"v0.7.0", "", false, errDevelBuild},
+		{"latest", "v0.7.0", false, errReleaseTag},
+		{"", "v0.7.0", false, errReleaseTag},
+	}
+
+	for _, tt := range tests {
+		got, err := needsUpdate(tt.latest, tt.current)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("needsUpdate(%q, %q) = %t, %v, want %t, %v", tt.latest, tt.current, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	const name = "betteralign_Linux_x86_64.tar.gz"
+
+	archive := []byte("archive")
+	sum := sha256.Sum256(archive)
+	hexSum := hex.EncodeToString(sum[:])
+	other := sha256.Sum256([]byte("other"))
+
+	tests := []struct {
+		name string
+		sums string
+		err  error
+	}{
+		{"match", hexSum + "  " + name + "\n", nil},
+		{"binary mode", hexSum + " *" + name + "\n", nil},
+		{"among others", hex.EncodeToString(other[:]) + "  betteralign_Darwin_all.tar.gz\n" + hexSum + "  " + name + "\n",
+			nil},
+		{"mismatch", hex.EncodeToString(other[:]) + "  " + name + "\n", errChecksumMismatch},
+		{"missing", hexSum + "  betteralign_Darwin_all.tar.gz\n", errNoChecksum},
+		{"empty", "", errNoChecksum},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyChecksum([]byte(tt.sums), name, archive); !errors.Is(err, tt.err) {
+				t.Errorf("verifyChecksum() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestReplaceFile(t *testing.T) {
+	errWrite := errors.New("write failed")
+
+	tests := []struct {
+		name      string
+		moveAside bool
+		fail      bool
+		want      string
+		old       bool
+	}{
+		{"replace", false, false, "new", false},
+		{"replace failed", false, true, "old", false},
+		{"move aside", true, false, "new", true},
+		{"move aside failed", true, true, "old", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(f func(string, []byte, fs.FileMode) error) { writeFile = f }(writeFile)
+
+			if tt.fail {
+				writeFile = func(string, []byte, fs.FileMode) error { return errWrite }
+			}
+
+			exe := filepath.Join(t.TempDir(), "betteralign.exe")
+			if err := os.WriteFile(exe, []byte("old"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+
+			err := replaceFile(exe, []byte("new"), tt.moveAside)
+			if tt.fail != errors.Is(err, errWrite) {
+				t.Fatalf("replaceFile() = %v", err)
+			}
+
+			got, err := os.ReadFile(exe)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("binary is %q, want %q", got, tt.want)
+			}
+
+			if _, err := os.Stat(exe + ".old"); (err == nil) != tt.old {
+				t.Errorf("moved aside binary exists: %t, want %t", err == nil, tt.old)
+			}
+		})
+	}
+}
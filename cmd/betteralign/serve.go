@@ -0,0 +1,492 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/token"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dkorunic/betteralign"
+	"github.com/pmezard/go-difflib/difflib"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/checker"
+	"golang.org/x/tools/go/packages"
+)
+
+const (
+	// maxArchiveSize limits the size of source archives submitted to the server.
+	maxArchiveSize = 256 << 20
+	// maxExtractedSize limits the total size of files extracted from a source archive.
+	maxExtractedSize = 1 << 30
+	// maxArchiveEntries limits the number of files extracted from a source archive.
+	maxArchiveEntries = 100000
+)
+
+var (
+	errUnsafePath    = errors.New("archive entry escapes destination directory")
+	errArchiveSize   = fmt.Errorf("archive extracts to more than %d bytes", maxExtractedSize)
+	errArchiveFiles  = fmt.Errorf("archive has more than %d files", maxArchiveEntries)
+	errRelativeDir   = errors.New("dir must be an absolute path")
+	errOutsideRoot   = errors.New("dir is not below the -serve_root directory")
+	errPattern       = errors.New("patterns must be relative to dir and not leave it")
+	errUnsupportedCT = errors.New("unsupported content type, expected application/json, application/zip or application/gzip")
+)
+
+// serveRequest asks the server to analyze packages in a directory on the server.
+type serveRequest struct {
+	Dir      string   `json:"dir"`
+	Patterns []string `json:"patterns"`
+}
+
+// serveResponse holds diagnostics, findings and unified diff patches reordering reported structs. File names are
+// relative to the analyzed directory.
+type serveResponse struct {
+	Diagnostics []cachedDiagnostic    `json:"diagnostics"`
+	Findings    []betteralign.Finding `json:"findings"`
+	Patches     []servePatch          `json:"patches"`
+}
+
+// servePatch is a unified diff of a single file.
+type servePatch struct {
+	File string `json:"file"`
+	Diff string `json:"diff"`
+}
+
+// server analyzes packages on request. Analyzer state is global, so requests are analyzed one at a time.
+type server struct {
+	a  *analysis.Analyzer
+	mu sync.Mutex
+}
+
+// serve runs an HTTP server on addr until interrupted. POST /v1/analyze accepts either a JSON serveRequest naming
+// a directory on the server, or a zip or gzipped tar source archive analyzed with patterns given by pattern query
+// parameters (./... by default).
+func serve(a *analysis.Analyzer, addr string) int {
+	// patches are returned to clients instead of rewriting files
+	if err := a.Flags.Set("apply", "false"); err != nil {
+		log.Print(err)
+	}
+
+	s := &server{a: a}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("POST /v1/analyze", s.handleAnalyze)
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	log.Printf("serving on %s", addr)
+
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Print(err)
+
+		return 1
+	}
+
+	return 0
+}
+
+func (s *server) handleAnalyze(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxArchiveSize)
+
+	var (
+		dir      string
+		patterns = r.URL.Query()["pattern"]
+	)
+
+	switch ct := r.Header.Get("Content-Type"); {
+	case strings.HasPrefix(ct, "application/json"):
+		var req serveRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		if !filepath.IsAbs(req.Dir) {
+			http.Error(w, errRelativeDir.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		if !belowRoot(req.Dir) {
+			http.Error(w, errOutsideRoot.Error(), http.StatusForbidden)
+
+			return
+		}
+
+		dir, patterns = req.Dir, req.Patterns
+	case strings.HasPrefix(ct, "application/zip"), strings.HasPrefix(ct, "application/gzip"),
+		strings.HasPrefix(ct, "application/x-gzip"):
+		tmp, err := os.MkdirTemp("", "betteralign-serve-")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+		defer os.RemoveAll(tmp)
+
+		extract := extractTarGz
+		if strings.HasPrefix(ct, "application/zip") {
+			extract = extractZip
+		}
+
+		if err := extract(r.Body, tmp); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		dir = tmp
+	default:
+		http.Error(w, errUnsupportedCT.Error(), http.StatusUnsupportedMediaType)
+
+		return
+	}
+
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	for _, p := range patterns {
+		if !localPattern(p) {
+			http.Error(w, fmt.Sprintf("%v: %s", errPattern, p), http.StatusForbidden)
+
+			return
+		}
+	}
+
+	resp, err := s.analyze(dir, patterns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Print(err)
+	}
+}
+
+// belowRoot reports whether directory dir is -serve_root or below it, with symlinks resolved. Without -serve_root no
+// directory is.
+func belowRoot(dir string) bool {
+	if serveRoot == "" {
+		return false
+	}
+
+	root, err := filepath.Abs(serveRoot)
+	if err != nil {
+		return false
+	}
+
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return false
+	}
+
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(root, dir)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// localPattern reports whether package pattern p names packages below the analyzed directory: a relative directory
+// pattern (./... or ./pkg) which doesn't step out of it.
+func localPattern(p string) bool {
+	p = filepath.ToSlash(p)
+	if p != "." && !strings.HasPrefix(p, "./") {
+		return false
+	}
+
+	for _, elem := range strings.Split(p, "/") {
+		if elem == ".." {
+			return false
+		}
+	}
+
+	return true
+}
+
+// analyze analyzes packages matching patterns in dir.
+func (s *server) analyze(dir string, patterns []string) (*serveResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	betteralign.Reset()
+
+	conf := packages.Config{
+		Mode:       packages.LoadSyntax | packages.NeedModule,
+		Tests:      includeTests,
+		Dir:        dir,
+		BuildFlags: buildFlags(),
+	}
+
+	if needFacts(s.a) {
+		conf.Mode = packages.LoadAllSyntax | packages.NeedModule
+	}
+
+	pkgs, err := packages.Load(&conf, patterns...)
+	if err != nil {
+		return nil, err
+	}
+
+	betteralign.SetVariantFiles(variantFiles(pkgs))
+
+	graph, err := checker.Analyze([]*analysis.Analyzer{s.a}, pkgs, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &serveResponse{Diagnostics: []cachedDiagnostic{}, Findings: []betteralign.Finding{}, Patches: []servePatch{}}
+
+	for _, act := range graph.Roots {
+		if act.Err != nil {
+			return nil, act.Err
+		}
+
+		for _, d := range act.Diagnostics {
+			resp.Diagnostics = append(resp.Diagnostics, cachedDiagnostic{
+				Posn:    relPosition(dir, act.Package.Fset.Position(d.Pos)).String(),
+				Message: d.Message,
+				Code:    d.Category,
+			})
+		}
+
+		if r, ok := act.Result.(*betteralign.Result); ok && r != nil {
+			resp.Findings = append(resp.Findings, r.Findings...)
+		}
+	}
+
+	if resp.Patches, err = patches(dir, resp.Findings); err != nil {
+		return nil, err
+	}
+
+	for i := range resp.Findings {
+		resp.Findings[i].Pos = relPosition(dir, resp.Findings[i].Pos)
+	}
+
+	return resp, nil
+}
+
+// relPosition returns position p with file name relative to dir, so that temporary directories of extracted
+// archives are not exposed to clients.
+func relPosition(dir string, p token.Position) token.Position {
+	p.Filename = relName(dir, p.Filename)
+
+	return p
+}
+
+// relName returns slash separated file name fn relative to dir, or fn if it is not within dir.
+func relName(dir, fn string) string {
+	rel, err := filepath.Rel(dir, fn)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return fn
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// patches returns unified diffs of files reordering fields of all findings which are not pinned.
+func patches(dir string, findings []betteralign.Finding) ([]servePatch, error) {
+	byFile := make(map[string][]betteralign.Finding)
+	for _, f := range findings {
+		if f.Pinned == "" && f.Order != nil {
+			byFile[f.Pos.Filename] = append(byFile[f.Pos.Filename], f)
+		}
+	}
+
+	result := []servePatch{}
+
+	for fn, fs := range byFile {
+		orig, err := os.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+
+		orders := make(map[int][]int, len(fs))
+		for _, f := range fs {
+			orders[f.Pos.Offset] = f.Order
+		}
+
+		src, err := betteralign.ReorderStructs(fn, orig, orders)
+		if err != nil {
+			return nil, err
+		}
+
+		name := relName(dir, fn)
+
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(string(orig)),
+			B:        difflib.SplitLines(string(src)),
+			FromFile: "a/" + name,
+			ToFile:   "b/" + name,
+			Context:  3,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, servePatch{File: name, Diff: diff})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].File < result[j].File
+	})
+
+	return result, nil
+}
+
+// extractor writes archive entries into dir, limiting the total size and number of extracted files.
+type extractor struct {
+	dir   string
+	size  int64 // bytes left to extract
+	files int   // files left to extract
+}
+
+// newExtractor returns an extractor into dir limited to maxExtractedSize bytes in maxArchiveEntries files.
+func newExtractor(dir string) *extractor {
+	return &extractor{dir: dir, size: maxExtractedSize, files: maxArchiveEntries}
+}
+
+// extractZip extracts a zip archive read from r into dir.
+func extractZip(r io.Reader, dir string) error {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		return err
+	}
+
+	e := newExtractor(dir)
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+
+		err = e.extractFile(rc, f.Name)
+		rc.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractTarGz extracts a gzipped tar archive read from r into dir.
+func extractTarGz(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	e := newExtractor(dir)
+
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if err := e.extractFile(tr, h.Name); err != nil {
+			return err
+		}
+	}
+}
+
+// extractFile writes archive entry name read from r into the destination directory, refusing absolute names and
+// names escaping it, and files exceeding the limits of the extractor.
+func (e *extractor) extractFile(r io.Reader, name string) error {
+	fn := filepath.Join(e.dir, filepath.FromSlash(name))
+	if path.IsAbs(name) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" ||
+		!strings.HasPrefix(fn, filepath.Clean(e.dir)+string(filepath.Separator)) {
+		return fmt.Errorf("%w: %s", errUnsafePath, name)
+	}
+
+	if e.files == 0 {
+		return errArchiveFiles
+	}
+
+	e.files--
+
+	if err := os.MkdirAll(filepath.Dir(fn), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(f, io.LimitReader(r, e.size+1))
+	if err == nil && n > e.size {
+		err = errArchiveSize
+	}
+
+	if err != nil {
+		f.Close()
+
+		return err
+	}
+
+	e.size -= n
+
+	return f.Close()
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBelowRoot(t *testing.T) {
+	defer func(root string) { serveRoot = root }(serveRoot)
+
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "root")
+	outside := filepath.Join(tmp, "outside")
+
+	for _, dir := range []string{filepath.Join(root, "pkg"), filepath.Join(tmp, "root2"), outside} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Symlink(root, filepath.Join(tmp, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		root string
+		dir  string
+		want bool
+	}{
+		{"no root", "", root, false},
+		{"root", root, root, true},
+		{"below root", root, filepath.Join(root, "pkg"), true},
+		{"parent", root, tmp, false},
+		{"dot dot", root, filepath.Join(root, "..", "outside"), false},
+		{"sibling with root prefix", root, filepath.Join(tmp, "root2"), false},
+		{"missing", root, filepath.Join(root, "missing"), false},
+		{"symlinked root", filepath.Join(tmp, "link"), filepath.Join(root, "pkg"), true},
+		{"dir through symlinked root", root, filepath.Join(tmp, "link", "pkg"), true},
+		{"symlink escaping root", root, filepath.Join(root, "escape"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serveRoot = tt.root
+
+			if got := belowRoot(tt.dir); got != tt.want {
+				t.Errorf("belowRoot(%q) with root %q = %t, want %t", tt.dir, tt.root, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{".", true},
+		{"./...", true},
+		{"./pkg", true},
+		{"./pkg/...", true},
+		{"./pkg/../other", false},
+		{"..", false},
+		{"../...", false},
+		{"./..", false},
+		{"/etc", false},
+		{"pkg", false},
+		{"github.com/dkorunic/betteralign", false},
+		{"std", false},
+	}
+
+	for _, tt := range tests {
+		if got := localPattern(tt.pattern); got != tt.want {
+			t.Errorf("localPattern(%q) = %t, want %t", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestExtractFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		size    int64
+		files   int
+		err     error
+	}{
+		{"file", []string{"a.go"}, 16, 1, nil},
+		{"nested", []string{"pkg/a.go", "pkg/sub/b.go"}, 20, 2, nil},
+		{"dot dot", []string{"../a.go"}, 16, 1, errUnsafePath},
+		{"nested dot dot", []string{"pkg/../../a.go"}, 16, 1, errUnsafePath},
+		{"absolute", []string{"/tmp/a.go"}, 16, 1, errUnsafePath},
+		{"over size", []string{"a.go", "b.go"}, 19, 2, errArchiveSize},
+		{"over files", []string{"a.go", "b.go"}, 16, 1, errArchiveFiles},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			e := &extractor{dir: filepath.Join(dir, "dst"), size: tt.size, files: tt.files}
+
+			var err error
+			for _, name := range tt.entries {
+				if err = e.extractFile(strings.NewReader("package a\n"), name); err != nil {
+					break
+				}
+			}
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("extractFile() = %v, want %v", err, tt.err)
+			}
+
+			if tt.err != nil {
+				if _, err := os.Stat(filepath.Join(dir, "a.go")); err == nil {
+					t.Error("extracted a.go outside of the destination directory")
+				}
+
+				return
+			}
+
+			for _, name := range tt.entries {
+				if _, err := os.Stat(filepath.Join(e.dir, filepath.FromSlash(name))); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
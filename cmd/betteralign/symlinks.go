@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expandSymlinks returns args with an additional ./... style pattern for every symlinked directory found below
+// directory patterns ending with /..., which the go command doesn't follow on its own. Symlinks pointing into an
+// already visited tree or containing one are skipped, which also breaks symlink cycles.
+func expandSymlinks(args []string) []string {
+	var visited []string
+
+	expanded := append([]string(nil), args...)
+
+	var walk func(dir string)
+	walk = func(dir string) {
+		real, err := realPath(dir)
+		if err != nil {
+			log.Print(err)
+
+			return
+		}
+
+		visited = append(visited, real)
+
+		// walk the real directory, as WalkDir doesn't descend into a symlinked root
+		err = filepath.WalkDir(real, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(real, path)
+			if err != nil {
+				return err
+			}
+
+			path = filepath.Join(dir, rel)
+
+			// the go command ignores these directories in ... patterns
+			if rel != "." && (strings.HasPrefix(d.Name(), ".") || strings.HasPrefix(d.Name(), "_") ||
+				d.Name() == "testdata") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			if d.Type()&fs.ModeSymlink == 0 {
+				return nil
+			}
+
+			// dangling symlinks and symlinks to files are not followed
+			target, err := realPath(path)
+			if err != nil {
+				return nil
+			}
+
+			if fi, err := os.Stat(target); err != nil || !fi.IsDir() {
+				return nil
+			}
+
+			for _, v := range visited {
+				if within(target, v) || within(v, target) {
+					log.Printf("skipping symlink %s to %s overlapping already analyzed %s", path, target, v)
+
+					return nil
+				}
+			}
+
+			pattern := filepath.ToSlash(path) + "/..."
+			if !filepath.IsAbs(path) {
+				pattern = "./" + pattern
+			}
+
+			expanded = append(expanded, pattern)
+			walk(path)
+
+			return nil
+		})
+		if err != nil {
+			log.Print(err)
+		}
+	}
+
+	for _, arg := range args {
+		dir, ok := strings.CutSuffix(arg, "/...")
+		if !ok || !(filepath.IsAbs(dir) || dir == "." || strings.HasPrefix(dir, "./") || strings.HasPrefix(dir, "../")) {
+			continue
+		}
+
+		walk(dir)
+	}
+
+	return expanded
+}
+
+// realPath returns the absolute name of path with all symlinks resolved.
+func realPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.EvalSymlinks(abs)
+}
+
+// within reports whether path is dir or below it.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dkorunic/betteralign"
+	"golang.org/x/tools/go/analysis/checker"
+)
+
+// runTiming is the timing breakdown written by -timing: wall times of loading (which includes type-checking, as
+// go/packages type-checks packages concurrently while loading them) and analyzing all packages, followed by per
+// package phases. Cached packages are not analyzed and are left out.
+type runTiming struct {
+	Packages []packageTiming `json:"packages"`
+	Load     time.Duration   `json:"load_ns"`
+	Analyze  time.Duration   `json:"analyze_ns"`
+}
+
+// packageTiming is the time spent on a single package: parsing its files while loading and the analyzer phases.
+type packageTiming struct {
+	Package string `json:"package"`
+	betteralign.Timing
+	Parse time.Duration `json:"parse_ns"`
+}
+
+// parseTimes records time spent parsing each file, as the ParseFile hook of packages.Config.
+type parseTimes struct {
+	files map[string]time.Duration
+	mu    sync.Mutex
+}
+
+// parseFile parses file filename like the default parser of go/packages and records the time it took.
+func (p *parseTimes) parseFile(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+	start := time.Now()
+	f, err := parser.ParseFile(fset, filename, src, parser.AllErrors|parser.ParseComments)
+	d := time.Since(start)
+
+	p.mu.Lock()
+	p.files[filename] += d
+	p.mu.Unlock()
+
+	return f, err
+}
+
+// writeTiming writes the timing breakdown of root packages of graph to file fn as JSON, with packages ordered by
+// path and test variants of a package added to it.
+func writeTiming(fn string, graph *checker.Graph, parse *parseTimes, load, analyze time.Duration) error {
+	byPkg := make(map[string]*packageTiming)
+
+	graph.All()(func(act *checker.Action) bool {
+		r, _ := act.Result.(*betteralign.Result)
+		if !act.IsRoot || r == nil {
+			return true
+		}
+
+		pt, ok := byPkg[r.Package]
+		if !ok {
+			pt = &packageTiming{Package: r.Package}
+			byPkg[r.Package] = pt
+		}
+
+		pt.Add(r.Timing)
+
+		for _, f := range act.Package.CompiledGoFiles {
+			pt.Parse += parse.files[f]
+		}
+
+		return true
+	})
+
+	rt := runTiming{Packages: make([]packageTiming, 0, len(byPkg)), Load: load, Analyze: analyze}
+	for _, pt := range byPkg {
+		rt.Packages = append(rt.Packages, *pt)
+	}
+
+	sort.Slice(rt.Packages, func(i, j int) bool { return rt.Packages[i].Package < rt.Packages[j].Package })
+
+	buf, err := json.MarshalIndent(rt, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fn, buf, 0o644)
+}
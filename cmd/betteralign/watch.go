@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dkorunic/betteralign"
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/packages"
+)
+
+// watchDebounce is how long watch waits for further changes before re-analyzing, as editors often write files in
+// several steps.
+const watchDebounce = 200 * time.Millisecond
+
+// watch analyzes packages matching args and then re-analyzes packages in directories with changed Go files, until
+// interrupted.
+func watch(a *analysis.Analyzer, args []string) int {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Print(err)
+
+		return 1
+	}
+	defer w.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	analyze(a, args, nil)
+	watchDirs(w, args)
+
+	changed := make(map[string]bool)
+
+	var debounce <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return 0
+		case ev, ok := <-w.Events:
+			if !ok {
+				return 0
+			}
+
+			if filepath.Ext(ev.Name) != ".go" || !ev.Has(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) {
+				continue
+			}
+
+			if name, err := filepath.Abs(ev.Name); err == nil {
+				changed[filepath.Dir(name)] = true
+				debounce = time.After(watchDebounce)
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return 0
+			}
+
+			log.Print(err)
+		case <-debounce:
+			dirs := changed
+			changed, debounce = make(map[string]bool), nil
+
+			fmt.Fprintf(os.Stderr, "--- %s changed, re-analyzing\n", strings.Join(slices.Sorted(maps.Keys(dirs)), ", "))
+
+			betteralign.Reset()
+			analyze(a, args, func(pkgs []*packages.Package) []*packages.Package {
+				return packagesInDirs(pkgs, dirs)
+			})
+
+			// pick up new package directories
+			watchDirs(w, args)
+		}
+	}
+}
+
+// watchDirs adds directories of all packages matching args to watcher w.
+func watchDirs(w *fsnotify.Watcher, args []string) {
+	conf := &packages.Config{
+		Mode:       packages.NeedName | packages.NeedFiles,
+		Tests:      includeTests,
+		BuildFlags: buildFlags(),
+		Overlay:    overlayFiles,
+	}
+
+	pkgs, err := packages.Load(conf, args...)
+	if err != nil {
+		log.Print(err)
+
+		return
+	}
+
+	watched := make(map[string]bool)
+	for _, dir := range w.WatchList() {
+		watched[dir] = true
+	}
+
+	for _, pkg := range pkgs {
+		for _, fn := range pkg.GoFiles {
+			if dir := filepath.Dir(fn); !watched[dir] {
+				watched[dir] = true
+
+				if err := w.Add(dir); err != nil {
+					log.Print(err)
+				}
+			}
+		}
+	}
+
+	betteralign.Logger().Debug("watching directories", "directories", len(watched))
+}
+
+// packagesInDirs returns packages of pkgs with files in any of dirs.
+func packagesInDirs(pkgs []*packages.Package, dirs map[string]bool) []*packages.Package {
+	var matched []*packages.Package
+
+	for _, pkg := range pkgs {
+		for _, fn := range pkg.CompiledGoFiles {
+			if dirs[filepath.Dir(fn)] {
+				matched = append(matched, pkg)
+
+				break
+			}
+		}
+	}
+
+	return matched
+}
@@ -0,0 +1,56 @@
+package betteralign
+
+import (
+	"fmt"
+	"go/token"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// Diagnostic codes identify the check reporting a diagnostic. They are stable across releases, so suppressions,
+// baselines and documentation can refer to them. Codes are given as the diagnostic category, the Code of findings
+// and as a prefix of diagnostic messages.
+const (
+	// CodeSize reports a struct whose size is reduced by reordering its fields.
+	CodeSize = "BA001"
+	// CodePointerBytes reports a struct whose pointer bytes scanned by the GC are reduced by reordering its fields.
+	CodePointerBytes = "BA002"
+	// CodeMaxSize reports a struct larger than the max_size threshold.
+	CodeMaxSize = "BA003"
+	// CodeAssert reports a type whose size violates its betteralign:assert directive.
+	CodeAssert = "BA004"
+	// CodeDirective reports a malformed betteralign directive.
+	CodeDirective = "BA005"
+	// CodeSIMD reports a field passed to an assembly function at an offset which is not 16-byte aligned.
+	CodeSIMD = "BA006"
+	// CodeSplit reports a large struct whose rarely used fields could be moved behind a pointer.
+	CodeSplit = "BA007"
+	// CodeSoA reports a struct whose arrays would take less memory in a struct of arrays layout.
+	CodeSoA = "BA008"
+	// CodeVerify reports a struct whose fix would not converge to the optimal layout.
+	CodeVerify = "BA009"
+)
+
+// reportf reports a diagnostic with the given code at pos.
+func reportf(pass *analysis.Pass, code string, pos token.Pos, format string, args ...any) {
+	pass.Report(analysis.Diagnostic{
+		Pos:      pos,
+		Category: code,
+		Message:  code + ": " + fmt.Sprintf(format, args...),
+	})
+}
+
+// ignoredCode reports whether a betteralign:ignore comment suppresses code, or any code when it is empty. A comment
+// without codes suppresses all of them, while e.g. betteralign:ignore BA002 only suppresses pointer bytes findings.
+func ignoredCode(comment, code string) bool {
+	_, args, _ := strings.Cut(comment, ignoreStruct)
+
+	codes := strings.FieldsFunc(args, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+	if code == "" || len(codes) == 0 || !strings.HasPrefix(codes[0], "BA") {
+		return true
+	}
+
+	return slices.Contains(codes, code)
+}
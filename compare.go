@@ -0,0 +1,155 @@
+package betteralign
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"unicode"
+)
+
+// Comparison is the difference between findings of a baseline run and a current run.
+type Comparison struct {
+	Introduced []Finding `json:"introduced"`
+	Fixed      []Finding `json:"fixed"`
+}
+
+// ReadFindings reads findings written by a previous run, either as a JSON array, such as printed by -json with
+// -sort or -top, or as JSON Lines, such as printed by -format=jsonl.
+func ReadFindings(r io.Reader) ([]Finding, error) {
+	br := bufio.NewReader(r)
+
+	// skip leading whitespace to tell an array from a stream of objects
+	for {
+		b, err := br.Peek(1)
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if !unicode.IsSpace(rune(b[0])) {
+			break
+		}
+
+		_, _ = br.ReadByte()
+	}
+
+	dec := json.NewDecoder(br)
+
+	if b, _ := br.Peek(1); b[0] == '[' {
+		var findings []Finding
+		if err := dec.Decode(&findings); err != nil {
+			return nil, err
+		}
+
+		return findings, nil
+	}
+
+	var findings []Finding
+
+	for {
+		var f Finding
+		if err := dec.Decode(&f); errors.Is(err, io.EOF) {
+			return findings, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		findings = append(findings, f)
+	}
+}
+
+var (
+	baselineOnce   sync.Once
+	baselineMu     sync.Mutex
+	baselineCounts map[findingKey]int
+)
+
+// findingKey identifies a finding across runs by its package and struct name, since positions shift as code is
+// edited and file paths differ between checkouts.
+type findingKey struct {
+	pkg, name string
+}
+
+// CompareFindings returns findings of current without a counterpart in baseline as introduced, and findings of
+// baseline without a counterpart in current as fixed. Findings are matched by package and struct name, and both
+// lists are sorted by position.
+func CompareFindings(baseline, current []Finding) Comparison {
+	var c Comparison
+
+	counts := make(map[findingKey]int)
+	for _, f := range baseline {
+		counts[findingKey{f.Package, f.Struct}]++
+	}
+
+	for _, f := range current {
+		k := findingKey{f.Package, f.Struct}
+		if counts[k] > 0 {
+			counts[k]--
+
+			continue
+		}
+
+		c.Introduced = append(c.Introduced, f)
+	}
+
+	for i := len(baseline) - 1; i >= 0; i-- {
+		f := baseline[i]
+		if k := (findingKey{f.Package, f.Struct}); counts[k] > 0 {
+			counts[k]--
+			c.Fixed = append(c.Fixed, f)
+		}
+	}
+
+	SortByPosition(c.Introduced)
+	SortByPosition(c.Fixed)
+
+	return c
+}
+
+// inBaseline reports whether a finding of struct name of package pkg is recorded in the baseline file, so that it is
+// suppressed. Every baseline finding suppresses a single struct, so structs added later under the same name are
+// still reported. The baseline is read once per run.
+func inBaseline(pkg, name string) bool {
+	if baselineFile == "" {
+		return false
+	}
+
+	baselineMu.Lock()
+	defer baselineMu.Unlock()
+
+	baselineOnce.Do(func() {
+		f, err := os.Open(baselineFile)
+		if err != nil {
+			ReportError(StageBaseline, baselineFile, fmt.Errorf("%v: %w", ErrReadBaseline, err))
+
+			return
+		}
+		defer f.Close()
+
+		findings, err := ReadFindings(f)
+		if err != nil {
+			ReportError(StageBaseline, baselineFile, fmt.Errorf("%v: %w", ErrReadBaseline, err))
+
+			return
+		}
+
+		baselineCounts = make(map[findingKey]int, len(findings))
+		for _, f := range findings {
+			baselineCounts[findingKey{f.Package, f.Struct}]++
+		}
+	})
+
+	k := findingKey{pkg, name}
+	if baselineCounts[k] == 0 {
+		return false
+	}
+
+	baselineCounts[k]--
+
+	return true
+}
@@ -0,0 +1,62 @@
+package betteralign
+
+import (
+	"fmt"
+	"runtime"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// SetFlag sets analyzer flag name, as given on the command line of betteralign without the leading dash, to value.
+// It lets programs combining Analyzer with other analyzers, such as multichecker based ones where the flag becomes
+// -betteralign.name, configure it without a command line, e.g. SetFlag("test_files", "true"). Fixes are applied
+// with the apply flag rather than -fix, since fixes are written by the analyzer itself. Drivers parsing the command
+// line afterwards override values given on it. Flag values are package state rather than per Analyzer, so analyzers
+// initialized with InitAnalyzer share them and a process runs betteralign with a single configuration.
+func SetFlag(name, value string) error {
+	if Analyzer.Flags.Lookup(name) == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownFlag, name)
+	}
+
+	if err := Analyzer.Flags.Set(name, value); err != nil {
+		return fmt.Errorf("flag %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// SetWriteConcurrency bounds the number of fixed files printed and written at the same time, shared by all packages,
+// to n, or to GOMAXPROCS when n is not positive. Drivers call it before analysis.
+func SetWriteConcurrency(n int) {
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+
+	applySem = make(chan struct{}, n)
+}
+
+// SetFacts makes FactsAnalyzer export layout facts of struct types when enabled. Drivers running analyzers with
+// facts on all dependencies, which then need their syntax loaded too, reuse layouts of imported packages instead of
+// recomputing them; go vet tools get them passed between units. Drivers call it before analysis.
+func SetFacts(enabled bool) {
+	FactsAnalyzer.FactTypes = nil
+	if enabled {
+		FactsAnalyzer.FactTypes = []analysis.Fact{new(StructFact)}
+	}
+}
+
+// SetOverlay makes the analyzer read and fix files replacing others, keyed by absolute names of the replaced files,
+// as with the Replace map of the go build -overlay file. Drivers loading packages with these replacements call it
+// before analysis, so fixes are applied to the replacement files which contents were analyzed.
+func SetOverlay(replace map[string]string) {
+	overlay = replace
+}
+
+// overlayFile returns the name of the file replacing fn in the overlay, or fn itself.
+func overlayFile(fn string) string {
+	if r, ok := overlay[fn]; ok {
+		return r
+	}
+
+	return fn
+}
@@ -0,0 +1,135 @@
+package betteralign
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"slices"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// conversion is a conversion between two distinct struct types sharing their field sequence, e.g. Other(t),
+// (*Other)(&t) or (*Other)(unsafe.Pointer(&t)). Reordering only one side of it breaks the conversion: explicit
+// conversions no longer compile and unsafe ones silently reinterpret memory.
+type conversion struct {
+	from, to *types.TypeName
+	pos      token.Pos
+	unsafe   bool
+}
+
+// findLayoutConversion returns the conversion between layout-compatible struct types made by call, if any.
+func findLayoutConversion(pass *analysis.Pass, call *ast.CallExpr) (conversion, bool) {
+	if len(call.Args) != 1 {
+		return conversion{}, false
+	}
+
+	if tv, ok := pass.TypesInfo.Types[call.Fun]; !ok || !tv.IsType() {
+		return conversion{}, false
+	}
+
+	to, arg := pass.TypesInfo.TypeOf(call.Fun), call.Args[0]
+
+	unsafe := isUnsafePointer(pass.TypesInfo.TypeOf(arg))
+	if unsafe {
+		arg = unwrapPointerConversion(pass.TypesInfo, arg)
+	}
+
+	from := pass.TypesInfo.TypeOf(arg)
+	if from == nil {
+		return conversion{}, false
+	}
+
+	// unsafe conversions only go through pointers, explicit ones are between values or pointers to them
+	fromPtr, fromIsPtr := types.Unalias(from).(*types.Pointer)
+	toPtr, toIsPtr := types.Unalias(to).(*types.Pointer)
+
+	switch {
+	case fromIsPtr && toIsPtr:
+		from, to = fromPtr.Elem(), toPtr.Elem()
+	case unsafe || fromIsPtr || toIsPtr:
+		return conversion{}, false
+	}
+
+	fromObj, toObj := namedTypeName(from), namedTypeName(to)
+	if fromObj == nil || toObj == nil || fromObj == toObj {
+		return conversion{}, false
+	}
+
+	fromStr, ok := from.Underlying().(*types.Struct)
+	if !ok || fromStr.NumFields() < 2 {
+		return conversion{}, false
+	}
+
+	if !types.IdenticalIgnoreTags(fromStr, to.Underlying()) {
+		return conversion{}, false
+	}
+
+	return conversion{from: fromObj, to: toObj, pos: call.Pos(), unsafe: unsafe}, true
+}
+
+// reason returns the pin reason of conversion c for the given side of it.
+func (c conversion) reason(obj *types.TypeName) string {
+	via := ""
+	if c.unsafe {
+		via = " via unsafe.Pointer"
+	}
+
+	if obj == c.from {
+		return fmt.Sprintf("converted to %s%s, which relies on the same field order", c.to.Name(), via)
+	}
+
+	return fmt.Sprintf("converted from %s%s, which relies on the same field order", c.from.Name(), via)
+}
+
+// pinConversions pins both sides of conversions between layout-compatible struct types. With reorder_converted flag
+// both sides are reordered instead, as long as both are declared in the package and get the same optimal order.
+func pinConversions(pass *analysis.Pass, pinned pinnedTypes, convs []conversion) {
+	var nodes map[*types.TypeName]*ast.StructType
+	if reorderConverted {
+		nodes = make(map[*types.TypeName]*ast.StructType)
+		for s, obj := range structTypeNames(pass) {
+			nodes[obj] = s
+		}
+	}
+
+	for _, c := range convs {
+		if reorderConverted && sameOptimalOrder(pass, nodes[c.from], nodes[c.to]) {
+			continue
+		}
+
+		pinned.pin(pass, c.from, c.pos, c.reason(c.from))
+		pinned.pin(pass, c.to, c.pos, c.reason(c.to))
+	}
+}
+
+// sameOptimalOrder reports whether both struct declarations are reordered the same way, including their mutex
+// groups.
+func sameOptimalOrder(pass *analysis.Pass, a, b *ast.StructType) bool {
+	if a == nil || b == nil {
+		return false
+	}
+
+	s := newGCSizes(pass)
+
+	order := func(node *ast.StructType) []int {
+		typ, ok := pass.TypesInfo.TypeOf(node).(*types.Struct)
+		if !ok {
+			return nil
+		}
+
+		var groups [][]int
+		if keepMutexGroups {
+			groups = mutexGroups(pass.Fset, node, typ)
+		}
+
+		_, indexes := optimalGroupedOrder(typ, s, groups)
+
+		return indexes
+	}
+
+	orderA := order(a)
+
+	return orderA != nil && slices.Equal(orderA, order(b))
+}
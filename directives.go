@@ -0,0 +1,74 @@
+package betteralign
+
+import (
+	"go/ast"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+const (
+	ignoreFileDirective    = "//betteralign:ignore-file"
+	checkFileDirective     = "//betteralign:check-file"
+	ignorePackageDirective = "//betteralign:ignore-package"
+	checkPackageDirective  = "//betteralign:check-package"
+)
+
+// fileDirective is a file or package level opt-in or opt-out of checking and fixing.
+type fileDirective int
+
+const (
+	directiveNone fileDirective = iota
+	// directiveIgnore skips the file regardless of flags.
+	directiveIgnore
+	// directiveCheck checks and fixes the file even if it is a test or generated file, ignored by git or excluded by
+	// path flags.
+	directiveCheck
+)
+
+// findFileDirectives returns the directives of all package files, read from comments above their package clause.
+// A betteralign:ignore-package or betteralign:check-package directive in any file applies to all files of the
+// package, while betteralign:ignore-file and betteralign:check-file directives override it for their own file.
+func findFileDirectives(pass *analysis.Pass) map[string]fileDirective {
+	var pkg fileDirective
+
+	files := make(map[string]fileDirective, len(pass.Files))
+
+	for _, f := range pass.Files {
+		fn := pass.Fset.File(f.Pos()).Name()
+
+		for _, cg := range f.Comments {
+			if cg.Pos() > f.Package {
+				break
+			}
+
+			for _, c := range cg.List {
+				switch directiveName(c) {
+				case ignoreFileDirective:
+					files[fn] = directiveIgnore
+				case checkFileDirective:
+					files[fn] = directiveCheck
+				case ignorePackageDirective:
+					pkg = directiveIgnore
+				case checkPackageDirective:
+					pkg = directiveCheck
+				}
+			}
+		}
+	}
+
+	for _, f := range pass.Files {
+		if fn := pass.Fset.File(f.Pos()).Name(); files[fn] == directiveNone {
+			files[fn] = pkg
+		}
+	}
+
+	return files
+}
+
+// directiveName returns the directive of comment c without arguments, e.g. a reason following it.
+func directiveName(c *ast.Comment) string {
+	name, _, _ := strings.Cut(c.Text, " ")
+
+	return name
+}
@@ -0,0 +1,82 @@
+package betteralign
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Stages of operational errors, naming the step which failed.
+const (
+	StageLoad        = "load"
+	StageAnalyze     = "analyze"
+	StagePreFilter   = "prefilter"
+	StageDecorate    = "decorate"
+	StageApply       = "apply"
+	StageAssert      = "assert"
+	StageLayout      = "layout"
+	StageViz         = "viz"
+	StageBench       = "bench"
+	StageOptimized   = "optimized"
+	StageGitDiff     = "git_diff"
+	StageHeapProfile = "heap_profile"
+	StagePlan        = "plan"
+	StageBaseline    = "baseline"
+	StageMessage     = "message"
+)
+
+// OperationalError is an error which kept betteralign from analyzing or fixing some code, as opposed to a finding
+// about the code itself. Path is a file, a position within a file, a directory or a package path.
+type OperationalError struct {
+	Path  string `json:"path"`
+	Stage string `json:"stage"`
+	Error string `json:"error"`
+}
+
+// String formats the error as printed to stderr.
+func (e OperationalError) String() string {
+	return fmt.Sprintf("%s: %s: %s", e.Path, e.Stage, e.Error)
+}
+
+var (
+	opErrorsMu sync.Mutex
+	opErrors   []OperationalError
+)
+
+// ReportError records an operational error of stage for path and prints it to stderr.
+func ReportError(stage, path string, err error) {
+	recordError(OperationalError{Path: path, Stage: stage, Error: err.Error()})
+}
+
+func recordError(e OperationalError) {
+	opErrorsMu.Lock()
+	defer opErrorsMu.Unlock()
+
+	opErrors = append(opErrors, e)
+
+	fmt.Fprintln(os.Stderr, e)
+}
+
+// OperationalErrors returns operational errors recorded since the last Reset, ordered by path and stage.
+func OperationalErrors() []OperationalError {
+	opErrorsMu.Lock()
+	defer opErrorsMu.Unlock()
+
+	errs := append([]OperationalError(nil), opErrors...)
+
+	sortErrors(errs)
+
+	return errs
+}
+
+// sortErrors orders errs by path and stage, keeping the order of errors of the same step.
+func sortErrors(errs []OperationalError) {
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].Path != errs[j].Path {
+			return errs[i].Path < errs[j].Path
+		}
+
+		return errs[i].Stage < errs[j].Stage
+	})
+}
@@ -0,0 +1,159 @@
+package betteralign
+
+import (
+	"fmt"
+	"go/types"
+	"reflect"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// StructFact records the layout of a named struct type, so that analysis of dependent packages reuses it instead of
+// recomputing sizes and pointer data from its fields.
+type StructFact struct {
+	// Order is the optimal field order, nil when fields are already in optimal order.
+	Order          []int
+	Size           int64
+	Align          int64
+	PtrData        int64
+	OptimalSize    int64
+	OptimalPtrData int64
+}
+
+func (*StructFact) AFact() {}
+
+// Optimal reports whether the struct fields are already in optimal order.
+func (f *StructFact) Optimal() bool {
+	return f.Order == nil
+}
+
+func (f *StructFact) String() string {
+	if f.Optimal() {
+		return fmt.Sprintf("optimal, size %d", f.Size)
+	}
+
+	return fmt.Sprintf("optimal order %v, size %d could be %d", f.Order, f.Size, f.OptimalSize)
+}
+
+// structFacts maps struct types of a package and its dependencies to their layout facts.
+type structFacts map[*types.TypeName]*StructFact
+
+// factsResult is the result of FactsAnalyzer: layout facts of struct types of a package and its dependencies,
+// alignment pragmas of the package and, with simd, its fields passed to assembly functions.
+type factsResult struct {
+	facts  structFacts
+	aligns map[types.Object]int64
+	simd   map[*types.Var]string
+}
+
+// FactsAnalyzer exports a StructFact for every named struct type of a package once enabled with SetFacts. It has no
+// side effects, so drivers supporting facts can run it on all dependencies and reuse its results.
+var FactsAnalyzer = &analysis.Analyzer{
+	Name:       "betteralignfacts",
+	Doc:        "export layout facts of named struct types",
+	Run:        runFacts,
+	ResultType: reflect.TypeOf((*factsResult)(nil)),
+	// facts of structs whose layout doesn't depend on type errors are still exported
+	RunDespiteErrors: true,
+}
+
+func runFacts(pass *analysis.Pass) (interface{}, error) {
+	facts := make(structFacts)
+
+	for _, f := range pass.AllObjectFacts() {
+		if obj, ok := f.Object.(*types.TypeName); ok {
+			facts[obj] = f.Fact.(*StructFact)
+		}
+	}
+
+	s := platformSizes(pass)
+	s.facts = facts
+
+	aligns := findAlignDirectives(pass.Files, pass.TypesInfo)
+
+	// fields passed to assembly functions keep 16-byte aligned offsets when reordered
+	var simdFields map[*types.Var]string
+	if simd {
+		simdFields = findSIMDFields(pass.Files, pass.TypesInfo)
+
+		for v := range simdFields {
+			if aligns == nil {
+				aligns = make(map[types.Object]int64)
+			}
+
+			aligns[v] = max(aligns[v], simdAlign)
+		}
+	}
+
+	s.setAligns(aligns)
+
+	scope := pass.Pkg.Scope()
+	for _, name := range scope.Names() {
+		obj, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || obj.IsAlias() {
+			continue
+		}
+
+		named, ok := obj.Type().(*types.Named)
+		if !ok || named.TypeParams().Len() > 0 {
+			continue
+		}
+
+		str, ok := named.Underlying().(*types.Struct)
+		if !ok || unresolvedField(str) != nil {
+			continue
+		}
+
+		optimal, indexes := optimalOrder(str, s)
+
+		fact := &StructFact{
+			Size:           s.Sizeof(str),
+			Align:          s.Alignof(str),
+			PtrData:        s.ptrdata(str),
+			OptimalSize:    s.Sizeof(optimal),
+			OptimalPtrData: s.ptrdata(optimal),
+		}
+
+		if fact.Size != fact.OptimalSize || fact.PtrData != fact.OptimalPtrData {
+			fact.Order = indexes
+		}
+
+		if len(pass.Analyzer.FactTypes) > 0 {
+			pass.ExportObjectFact(obj, fact)
+		}
+		facts[obj] = fact
+	}
+
+	return &factsResult{facts: facts, aligns: aligns, simd: simdFields}, nil
+}
+
+// newGCSizes returns sizes of the pass target platform, reusing layout facts of struct types when available.
+func newGCSizes(pass *analysis.Pass) *gcSizes {
+	s := platformSizes(pass)
+
+	if res, ok := pass.ResultOf[FactsAnalyzer].(*factsResult); ok {
+		s.facts = res.facts
+		s.setAligns(res.aligns)
+	}
+
+	return s
+}
+
+// platformSizes returns sizes of the pass target platform, with word size and maximum alignment overridden by the
+// wordsize and maxalign flags.
+func platformSizes(pass *analysis.Pass) *gcSizes {
+	s := &gcSizes{
+		WordSize: pass.TypesSizes.Sizeof(unsafePointerTyp),
+		MaxAlign: pass.TypesSizes.Alignof(unsafePointerTyp),
+	}
+
+	if wordSizeOverride > 0 {
+		s.WordSize = int64(wordSizeOverride)
+	}
+
+	if maxAlignOverride > 0 {
+		s.MaxAlign = int64(maxAlignOverride)
+	}
+
+	return s
+}
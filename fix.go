@@ -0,0 +1,105 @@
+package betteralign
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+
+	"github.com/sirkon/dst"
+	"github.com/sirkon/dst/decorator"
+)
+
+// reorderFields sorts fields of struct node according to the optimal order of field indexes.
+func reorderFields(node *dst.StructType, indexes []int) {
+	flat := flattenFields(node)
+
+	// Sort fields according to the optimal order.
+	reordered := make([]*dst.Field, 0, len(indexes))
+	for _, index := range indexes {
+		if f := flat[index]; f != nil {
+			reordered = append(reordered, f)
+		}
+	}
+
+	node.Fields.List = reordered
+}
+
+// flattenFields returns one item per field of struct node, with nil for additional names of multi-named fields.
+//
+// Flatten the ast node since it could have multiple field names per list item while
+// *types.Struct only have one item per field.
+// TODO: Preserve multi-named fields instead of flattening.
+func flattenFields(node *dst.StructType) []*dst.Field {
+	flat := make([]*dst.Field, 0, len(node.Fields.List))
+	for _, f := range node.Fields.List {
+		flat = append(flat, f)
+		if len(f.Names) == 0 {
+			continue
+		}
+
+		for range f.Names[1:] {
+			flat = append(flat, nil)
+		}
+	}
+
+	return flat
+}
+
+// ReorderFields returns source src of file filename with fields of the struct type starting at byte offset sorted
+// into order, as given by Finding.Order, retaining comments. It lets editor integrations fix unsaved buffers.
+func ReorderFields(filename string, src []byte, offset int, order []int) ([]byte, error) {
+	return ReorderStructs(filename, src, map[int][]int{offset: order})
+}
+
+// ReorderStructs is like ReorderFields, reordering fields of all struct types keyed by their starting byte offset
+// in a single pass.
+func ReorderStructs(filename string, src []byte, orders map[int][]int) ([]byte, error) {
+	fset := token.NewFileSet()
+
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := decorator.NewDecorator(fset)
+
+	dFile, err := dec.DecorateFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[int]*ast.StructType, len(orders))
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		if s, ok := n.(*ast.StructType); ok {
+			if offset := fset.Position(s.Pos()).Offset; orders[offset] != nil {
+				nodes[offset] = s
+			}
+		}
+
+		return true
+	})
+
+	for offset, order := range orders {
+		node, ok := nodes[offset]
+		if !ok {
+			return nil, fmt.Errorf("%w at offset %d", ErrStructNotFound, offset)
+		}
+
+		dNode := dec.Dst.Nodes[node].(*dst.StructType)
+		if len(flattenFields(dNode)) != len(order) {
+			return nil, ErrFieldOrder
+		}
+
+		reorderFields(dNode, order)
+	}
+
+	var buf bytes.Buffer
+	if err := decorator.Fprint(&buf, dFile); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
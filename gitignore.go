@@ -0,0 +1,89 @@
+package betteralign
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	ignoredMu  sync.Mutex
+	gitTops    map[string]string
+	gitIgnored map[string]map[string]bool
+)
+
+// GitIgnored reports whether file fn is ignored by git, through .gitignore, .git/info/exclude or the global excludes
+// file of its work tree. Ignored files are listed once per work tree. It always returns false when no_gitignore is
+// used or fn is not in a git work tree.
+func GitIgnored(fn string) bool {
+	if noGitIgnore {
+		return false
+	}
+
+	fn = realName(fn)
+
+	ignoredMu.Lock()
+	defer ignoredMu.Unlock()
+
+	if gitTops == nil {
+		gitTops, gitIgnored = make(map[string]string), make(map[string]map[string]bool)
+	}
+
+	dir := filepath.Dir(fn)
+
+	top, ok := gitTops[dir]
+	if !ok {
+		if out, err := gitOutput(dir, "rev-parse", "--show-toplevel"); err == nil {
+			top = strings.TrimSpace(out)
+		}
+
+		gitTops[dir] = top
+	}
+
+	if top == "" {
+		return false
+	}
+
+	ignored, ok := gitIgnored[top]
+	if !ok {
+		ignored = listIgnored(top)
+		gitIgnored[top] = ignored
+	}
+
+	rel, err := filepath.Rel(top, normalPath(fn))
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+
+	// ignored directories are listed as a whole, so check the file and all of its parent directories
+	for rel = filepath.ToSlash(rel); ; rel = rel[:strings.LastIndexByte(rel, '/')] {
+		if ignored[rel] {
+			return true
+		}
+
+		if !strings.Contains(rel, "/") {
+			return false
+		}
+	}
+}
+
+// listIgnored lists untracked files and directories of git work tree top ignored by git, relative to top. It returns
+// nothing when git fails.
+func listIgnored(top string) map[string]bool {
+	ignored := make(map[string]bool)
+
+	out, err := gitOutput(top, "ls-files", "--others", "--ignored", "--exclude-standard", "--directory", "-z")
+	if err != nil {
+		Logger().Debug("unable to list files ignored by git", "dir", top, "error", err)
+
+		return ignored
+	}
+
+	for _, name := range strings.Split(out, "\x00") {
+		if name = strings.TrimSuffix(name, "/"); name != "" {
+			ignored[name] = true
+		}
+	}
+
+	return ignored
+}
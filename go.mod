@@ -6,9 +6,14 @@ toolchain go1.23.1
 
 require (
 	github.com/KimMachineGun/automemlimit v0.7.0
+	github.com/fsnotify/fsnotify v1.10.1
+	github.com/google/pprof v0.0.0-20241210010833-40e02aabc2ad
 	github.com/google/renameio/v2 v2.0.0
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/sirkon/dst v0.26.4
 	go.uber.org/automaxprocs v1.6.0
+	golang.org/x/mod v0.22.0
+	golang.org/x/sys v0.29.0
 	golang.org/x/tools v0.29.0
 	gotest.tools/v3 v3.5.1
 )
@@ -17,6 +22,5 @@ require (
 	github.com/google/go-cmp v0.6.0 // indirect
 	github.com/pbnjay/memory v0.0.0-20210728143218-7b4eea64cf58 // indirect
 	github.com/stretchr/testify v1.8.4 // indirect
-	golang.org/x/mod v0.22.0 // indirect
 	golang.org/x/sync v0.10.0 // indirect
 )
@@ -0,0 +1,39 @@
+package betteralign
+
+import (
+	"go/build"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	gorootOnce sync.Once
+	gorootDir  string
+)
+
+// InGoroot reports whether file fn belongs to the GOROOT of the go command, such as sources of the standard library.
+// Such files are analyzed read-only: fixes are never applied to them.
+func InGoroot(fn string) bool {
+	gorootOnce.Do(func() {
+		// the go command knows its GOROOT even when this binary was built with -trimpath
+		if out, err := exec.Command("go", "env", "GOROOT").Output(); err == nil {
+			gorootDir = strings.TrimSpace(string(out))
+		} else {
+			gorootDir = build.Default.GOROOT
+		}
+
+		if gorootDir != "" {
+			gorootDir = realName(gorootDir)
+		}
+	})
+
+	if gorootDir == "" {
+		return false
+	}
+
+	rel, err := filepath.Rel(gorootDir, normalPath(realName(fn)))
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
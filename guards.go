@@ -0,0 +1,243 @@
+package betteralign
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"regexp"
+
+	"github.com/sirkon/dst"
+)
+
+var (
+	// guardedBy matches comments of fields naming the mutex guarding them.
+	guardedBy = regexp.MustCompile(`(?i)\b(?:guarded|protected) by (\w+)`)
+	// guardsFollowing matches comments of mutexes guarding the fields following them up to the next blank line.
+	guardsFollowing = regexp.MustCompile(`(?i)\b(?:guards|protects)\b`)
+)
+
+// isMutex reports whether T is sync.Mutex or sync.RWMutex.
+func isMutex(T types.Type) bool {
+	named, ok := T.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil || named.Obj().Pkg().Path() != "sync" {
+		return false
+	}
+
+	return named.Obj().Name() == "Mutex" || named.Obj().Name() == "RWMutex"
+}
+
+// mutexGroups returns groups of field indexes of struct typ declared by node, each a sync.Mutex or sync.RWMutex field
+// followed by the fields it guards: fields commented as "guarded by mu" or "protected by mu", and, when the comment
+// of the mutex says that it guards or protects, fields following it up to the next blank line.
+func mutexGroups(fset *token.FileSet, node *ast.StructType, typ *types.Struct) [][]int {
+	if typ.NumFields() == 0 {
+		return nil
+	}
+
+	type astField struct {
+		field *ast.Field
+		first int
+	}
+
+	var fields []astField
+
+	index := 0
+	for _, f := range node.Fields.List {
+		fields = append(fields, astField{f, index})
+		index += max(len(f.Names), 1)
+	}
+
+	if index != typ.NumFields() {
+		return nil
+	}
+
+	comment := func(f *ast.Field) string {
+		return f.Doc.Text() + " " + f.Comment.Text()
+	}
+
+	mutexes := make(map[string]int)
+	for _, f := range fields {
+		if isMutex(typ.Field(f.first).Type()) {
+			mutexes[typ.Field(f.first).Name()] = f.first
+		}
+	}
+
+	if len(mutexes) == 0 {
+		return nil
+	}
+
+	guard := make(map[int]int)
+
+	// explicitly named mutexes take precedence over blank line delimited sections
+	for _, f := range fields {
+		m := guardedBy.FindStringSubmatch(comment(f.field))
+		if m == nil {
+			continue
+		}
+
+		if mu, ok := mutexes[m[1]]; ok && mu != f.first {
+			for i := 0; i < max(len(f.field.Names), 1); i++ {
+				guard[f.first+i] = mu
+			}
+		}
+	}
+
+	for k, f := range fields {
+		if !isMutex(typ.Field(f.first).Type()) || !guardsFollowing.MatchString(comment(f.field)) {
+			continue
+		}
+
+		for n, next := range fields[k+1:] {
+			if blankLineBetween(fset, fields[k+n].field, next.field) || isMutex(typ.Field(next.first).Type()) {
+				break
+			}
+
+			for i := 0; i < max(len(next.field.Names), 1); i++ {
+				if _, ok := guard[next.first+i]; !ok {
+					guard[next.first+i] = f.first
+				}
+			}
+		}
+	}
+
+	members := make(map[int][]int)
+	for i := 0; i < typ.NumFields(); i++ {
+		if mu, ok := guard[i]; ok {
+			members[mu] = append(members[mu], i)
+		}
+	}
+
+	var groups [][]int
+	for _, f := range fields {
+		if guarded := members[f.first]; len(guarded) > 0 {
+			groups = append(groups, append([]int{f.first}, guarded...))
+		}
+	}
+
+	return groups
+}
+
+// blankLineBetween reports whether field f, including its doc comment, is separated from the preceding field prev,
+// including its trailing comment, by a blank line.
+func blankLineBetween(fset *token.FileSet, prev, f *ast.Field) bool {
+	end := prev.End()
+	if prev.Comment != nil {
+		end = prev.Comment.End()
+	}
+
+	start := f.Pos()
+	if f.Doc != nil {
+		start = f.Doc.Pos()
+	}
+
+	return fset.PositionFor(start, false).Line > fset.PositionFor(end, false).Line+1
+}
+
+// optimalGroupedOrder is optimalOrder keeping every group of field indexes together: the first field of the group,
+// followed by the remaining fields in their optimal order. Groups are ordered as a whole, sized as a struct of their
+// fields.
+func optimalGroupedOrder(str *types.Struct, sizes *gcSizes, groups [][]int) (*types.Struct, []int) {
+	if len(groups) == 0 {
+		return optimalOrder(str, sizes)
+	}
+
+	grouped := make(map[int][]int)
+	member := make(map[int]bool)
+
+	for _, g := range groups {
+		rest := make([]*types.Var, 0, len(g)-1)
+		for _, i := range g[1:] {
+			rest = append(rest, str.Field(i))
+		}
+
+		_, order := optimalOrder(types.NewStruct(rest, nil), sizes)
+
+		unit := []int{g[0]}
+		for _, o := range order {
+			unit = append(unit, g[1+o])
+		}
+
+		grouped[g[0]] = unit
+
+		for _, i := range g {
+			member[i] = true
+		}
+	}
+
+	// every unit is a field of a struct ordered by the ungrouped optimizer: a group is a nested struct
+	var (
+		units  [][]int
+		fields []*types.Var
+	)
+
+	for i := 0; i < str.NumFields(); i++ {
+		switch unit, ok := grouped[i]; {
+		case ok:
+			vars := make([]*types.Var, len(unit))
+			for k, u := range unit {
+				vars[k] = str.Field(u)
+			}
+
+			// groups are blank fields, as only blank field names may repeat
+			units = append(units, unit)
+			fields = append(fields, types.NewField(token.NoPos, nil, "_", types.NewStruct(vars, nil), false))
+		case !member[i]:
+			units = append(units, []int{i})
+			fields = append(fields, str.Field(i))
+		}
+	}
+
+	_, order := optimalOrder(types.NewStruct(fields, nil), sizes)
+
+	var (
+		vars    []*types.Var
+		indexes []int
+	)
+
+	for _, o := range order {
+		for _, i := range units[o] {
+			vars = append(vars, str.Field(i))
+			indexes = append(indexes, i)
+		}
+	}
+
+	return sizes.alignLike(types.NewStruct(vars, nil), str), indexes
+}
+
+// separateGroups puts fields of each group, given by field indexes of struct node before its fields were
+// reordered, on consecutive lines, with blank lines before and after the group. Mutexes guarding the fields
+// following them up to a blank line thus keep guarding the same fields when the rewritten source is analyzed again.
+func separateGroups(node *dst.StructType, flat []*dst.Field, groups [][]int) {
+	group := make(map[*dst.Field]int)
+	first := make(map[*dst.Field]bool)
+
+	for g, indexes := range groups {
+		for k, i := range indexes {
+			if f := flat[i]; f != nil {
+				group[f] = g + 1
+				first[f] = k == 0
+			}
+		}
+	}
+
+	for k, f := range node.Fields.List {
+		// blank lines are kept before fields only, as a field ending a group may have been followed by one
+		f.Decs.After = dst.None
+
+		// a blank line separating a field moved first would follow the opening brace
+		if k == 0 {
+			f.Decs.Before = dst.NewLine
+
+			continue
+		}
+
+		prev := group[node.Fields.List[k-1]]
+
+		switch g := group[f]; {
+		case g != 0 && !first[f]:
+			f.Decs.Before = dst.NewLine
+		case g != 0 || prev != 0:
+			f.Decs.Before = dst.EmptyLine
+		}
+	}
+}
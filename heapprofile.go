@@ -0,0 +1,120 @@
+package betteralign
+
+import (
+	"fmt"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/pprof/profile"
+)
+
+// heapSample accumulates allocations attributed to a single source line.
+type heapSample struct {
+	bytes   int64
+	objects int64
+}
+
+var (
+	heapProfileOnce  sync.Once
+	heapProfileLines map[string]heapSample
+)
+
+// heapAllocations returns allocated bytes and objects the heap profile attributes to the given allocation sites of
+// package pkgPath. The profile is loaded once per run; load errors are reported and result in no allocations.
+func heapAllocations(fset *token.FileSet, pkgPath string, sites []token.Pos) (int64, int64) {
+	heapProfileOnce.Do(func() {
+		var err error
+		if heapProfileLines, err = loadHeapProfile(heapProfile); err != nil {
+			ReportError(StageHeapProfile, heapProfile, fmt.Errorf("%v: %w", ErrReadProfile, err))
+		}
+	})
+
+	var total heapSample
+
+	seen := make(map[string]bool)
+	for _, pos := range sites {
+		p := fset.Position(pos)
+
+		key := heapLineKey(p.Filename, int64(p.Line))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		s, ok := heapProfileLines[key]
+		if !ok {
+			// binaries built with -trimpath record file names as the package path followed by the base name
+			s = heapProfileLines[heapLineKey(path.Join(pkgPath, filepath.Base(p.Filename)), int64(p.Line))]
+		}
+
+		total.bytes += s.bytes
+		total.objects += s.objects
+	}
+
+	return total.bytes, total.objects
+}
+
+// heapLineKey identifies a source line by its file name as recorded in the profile.
+func heapLineKey(filename string, line int64) string {
+	return fmt.Sprintf("%s:%d", filepath.ToSlash(filename), line)
+}
+
+// loadHeapProfile reads a (gzipped) pprof heap profile and sums allocated bytes and objects per source line of the
+// innermost non-runtime frame of every sample.
+func loadHeapProfile(fn string) (map[string]heapSample, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p, err := profile.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedProfile, err)
+	}
+
+	bytesIdx, objectsIdx := -1, -1
+	for i, st := range p.SampleType {
+		switch st.Type {
+		case "alloc_space":
+			bytesIdx = i
+		case "alloc_objects":
+			objectsIdx = i
+		}
+	}
+
+	if bytesIdx < 0 || objectsIdx < 0 {
+		return nil, fmt.Errorf("%w: not a heap profile", ErrMalformedProfile)
+	}
+
+	lines := make(map[string]heapSample)
+
+	for _, s := range p.Sample {
+		if bytesIdx >= len(s.Value) || objectsIdx >= len(s.Value) {
+			continue
+		}
+
+	frames:
+		for _, loc := range s.Location {
+			for _, l := range loc.Line {
+				if l.Function == nil || strings.HasPrefix(l.Function.Name, "runtime.") {
+					continue
+				}
+
+				key := heapLineKey(l.Function.Filename, l.Line)
+				hs := lines[key]
+				hs.bytes += s.Value[bytesIdx]
+				hs.objects += s.Value[objectsIdx]
+				lines[key] = hs
+
+				break frames
+			}
+		}
+	}
+
+	return lines, nil
+}
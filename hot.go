@@ -0,0 +1,202 @@
+package betteralign
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// hotElems is the element count from which slices, arrays and maps of a struct make it hot.
+const hotElems = 1024
+
+// Reasons for considering a struct hot, that is, likely allocated, copied or scanned often enough for its layout
+// to matter.
+const (
+	hotPool = "used in sync.Pool"
+	hotLoop = "allocated in a loop"
+	hotElem = "element of a large slice, array or map"
+	hotChan = "channel element type"
+)
+
+// findHotTypes returns reasons, joined by commas, for considering local named types hot: values put into or taken
+// out of a sync.Pool, allocated within loops, used as elements of slices, arrays or maps with at least hotElems
+// elements, or sent over channels by value.
+func findHotTypes(pass *analysis.Pass, arrayLengths map[*types.TypeName]int64) map[*types.TypeName]string {
+	reasons := make(map[*types.TypeName]map[string]bool)
+
+	mark := func(t types.Type, reason string) {
+		obj := namedTypeName(t)
+		if obj == nil || obj.Pkg() != pass.Pkg {
+			return
+		}
+
+		if reasons[obj] == nil {
+			reasons[obj] = make(map[string]bool)
+		}
+
+		reasons[obj][reason] = true
+	}
+
+	for obj, n := range arrayLengths {
+		if n >= hotElems {
+			mark(obj.Type(), hotElem)
+		}
+	}
+
+	for expr, tv := range pass.TypesInfo.Types {
+		switch t := types.Unalias(tv.Type).(type) {
+		case *types.Chan:
+			if _, ok := types.Unalias(t.Elem()).(*types.Pointer); !ok {
+				mark(t.Elem(), hotChan)
+			}
+		case *types.Map:
+			if call, ok := expr.(*ast.CallExpr); ok && len(call.Args) > 1 && isBuiltin(pass.TypesInfo, call, "make") {
+				if v := pass.TypesInfo.Types[call.Args[1]].Value; v != nil && v.Kind() == constant.Int {
+					if n, ok := constant.Int64Val(v); ok && n >= hotElems {
+						mark(t.Elem(), hotElem)
+					}
+				}
+			}
+		}
+	}
+
+	for _, f := range pass.Files {
+		var stack []ast.Node
+
+		ast.Inspect(f, func(n ast.Node) bool {
+			if n == nil {
+				stack = stack[:len(stack)-1]
+
+				return true
+			}
+
+			stack = append(stack, n)
+
+			switch n := n.(type) {
+			case *ast.TypeAssertExpr:
+				// pool.Get().(*T)
+				if call, ok := ast.Unparen(n.X).(*ast.CallExpr); ok && n.Type != nil && isPoolMethod(pass, call, "Get") {
+					mark(pass.TypesInfo.TypeOf(n.Type), hotPool)
+				}
+			case *ast.CallExpr:
+				// pool.Put(v)
+				if isPoolMethod(pass, n, "Put") && len(n.Args) == 1 {
+					if t := pass.TypesInfo.TypeOf(n.Args[0]); t != nil {
+						if _, ok := t.Underlying().(*types.Interface); !ok {
+							mark(t, hotPool)
+						}
+					}
+				}
+			}
+
+			t := allocType(pass.TypesInfo, n)
+			if t == nil {
+				return true
+			}
+
+			// allocations directly within a loop or the New function of a sync.Pool of the enclosing function
+		walk:
+			for i := len(stack) - 2; i >= 0; i-- {
+				switch s := stack[i].(type) {
+				case *ast.ForStmt, *ast.RangeStmt:
+					mark(t, hotLoop)
+
+					break walk
+				case *ast.FuncLit:
+					if isPoolNew(pass, stack[:i], s) {
+						mark(t, hotPool)
+					}
+
+					break walk
+				case *ast.FuncDecl:
+					break walk
+				}
+			}
+
+			return true
+		})
+	}
+
+	hot := make(map[*types.TypeName]string, len(reasons))
+
+	for obj, set := range reasons {
+		list := make([]string, 0, len(set))
+		for reason := range set {
+			list = append(list, reason)
+		}
+
+		sort.Strings(list)
+
+		hot[obj] = strings.Join(list, ", ")
+	}
+
+	return hot
+}
+
+// isPoolMethod reports whether call calls method name of sync.Pool.
+func isPoolMethod(pass *analysis.Pass, call *ast.CallExpr, name string) bool {
+	sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != name {
+		return false
+	}
+
+	fn, ok := pass.TypesInfo.Uses[sel.Sel].(*types.Func)
+	if !ok {
+		return false
+	}
+
+	recv := fn.Type().(*types.Signature).Recv()
+
+	return recv != nil && isSyncPool(recv.Type())
+}
+
+// isPoolNew reports whether function literal lit, with its ancestors given by stack, is the New function of a
+// sync.Pool composite literal or is assigned to the New field of a sync.Pool.
+func isPoolNew(pass *analysis.Pass, stack []ast.Node, lit *ast.FuncLit) bool {
+	if len(stack) == 0 {
+		return false
+	}
+
+	switch parent := stack[len(stack)-1].(type) {
+	case *ast.KeyValueExpr:
+		key, ok := parent.Key.(*ast.Ident)
+		if !ok || key.Name != "New" || parent.Value != lit || len(stack) < 2 {
+			return false
+		}
+
+		cl, ok := stack[len(stack)-2].(*ast.CompositeLit)
+
+		return ok && isSyncPool(pass.TypesInfo.TypeOf(cl))
+	case *ast.AssignStmt:
+		for i, rhs := range parent.Rhs {
+			if rhs != lit || i >= len(parent.Lhs) {
+				continue
+			}
+
+			sel, ok := parent.Lhs[i].(*ast.SelectorExpr)
+
+			return ok && sel.Sel.Name == "New" && isSyncPool(pass.TypesInfo.TypeOf(sel.X))
+		}
+	}
+
+	return false
+}
+
+// isSyncPool reports whether T is sync.Pool or a pointer to it.
+func isSyncPool(T types.Type) bool {
+	if T == nil {
+		return false
+	}
+
+	if ptr, ok := types.Unalias(T).(*types.Pointer); ok {
+		T = ptr.Elem()
+	}
+
+	named, ok := types.Unalias(T).(*types.Named)
+
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "sync" && named.Obj().Name() == "Pool"
+}
@@ -0,0 +1,143 @@
+package betteralign
+
+import (
+	"bytes"
+	"fmt"
+	"go/types"
+	"io"
+	"sync"
+	"text/tabwriter"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// fieldLayout describes the placement of a single struct field in memory.
+type fieldLayout struct {
+	Name    string
+	Type    string
+	Offset  int64
+	Size    int64
+	Align   int64
+	Padding int64
+	PtrData int64
+}
+
+// layout returns placement of all fields of typ, where Padding is the number of unused bytes following each field,
+// including the trailing struct padding after the last field.
+func (s *gcSizes) layout(typ *types.Struct) []fieldLayout {
+	nf := typ.NumFields()
+	fields := make([]fieldLayout, nf)
+
+	var o int64
+	for i := 0; i < nf; i++ {
+		f := typ.Field(i)
+		ft := f.Type()
+		a, sz := s.fieldAlign(f), s.Sizeof(ft)
+		if i == nf-1 && sz == 0 && o != 0 {
+			sz = 1
+		}
+
+		o = align(o, a)
+		if i > 0 {
+			prev := &fields[i-1]
+			prev.Padding = o - prev.Offset - prev.Size
+		}
+
+		fields[i] = fieldLayout{
+			Name:    f.Name(),
+			Type:    types.TypeString(ft, types.RelativeTo(f.Pkg())),
+			Offset:  o,
+			Size:    sz,
+			Align:   a,
+			PtrData: s.ptrdata(ft),
+		}
+		o += sz
+	}
+
+	if nf > 0 {
+		last := &fields[nf-1]
+		last.Padding = s.Sizeof(typ) - last.Offset - last.Size
+	}
+
+	return fields
+}
+
+// formatLayoutTable renders current and optimal struct layouts as a compact table suitable for a diagnostic.
+func formatLayoutTable(current, optimal []fieldLayout) string {
+	var buf bytes.Buffer
+
+	w := tabwriter.NewWriter(&buf, 0, 0, 1, ' ', 0)
+	for _, l := range []struct {
+		title  string
+		fields []fieldLayout
+	}{{"current", current}, {"optimal", optimal}} {
+		fmt.Fprintf(w, "\n%s layout:\tfield\toffset\tsize\tpadding", l.title)
+		for _, f := range l.fields {
+			fmt.Fprintf(w, "\n\t%s %s\t%d\t%d\t%d", f.Name, f.Type, f.Offset, f.Size, f.Padding)
+		}
+	}
+	_ = w.Flush()
+
+	return buf.String()
+}
+
+// explainPadding names every padding hole of the layout together with the alignment requirement causing it.
+func explainPadding(fields []fieldLayout, structAlign int64) []string {
+	var holes []string
+
+	for i, f := range fields {
+		if f.Padding == 0 {
+			continue
+		}
+
+		if i+1 < len(fields) {
+			next := fields[i+1]
+			holes = append(holes, fmt.Sprintf("%d bytes after %s because next field %s requires %d-byte alignment",
+				f.Padding, f.Name, next.Name, next.Align))
+		} else {
+			holes = append(holes, fmt.Sprintf("%d bytes after %s because struct size must be a multiple of %d",
+				f.Padding, f.Name, structAlign))
+		}
+	}
+
+	return holes
+}
+
+// layoutMu serializes layout output of packages analyzed concurrently.
+var layoutMu sync.Mutex
+
+// printLayouts writes layouts of all struct types in the package matching name, given either as a bare type name or
+// qualified with the package path (example.com/pkg.Type), to w.
+func printLayouts(w io.Writer, pass *analysis.Pass, name string) {
+	s := newGCSizes(pass)
+
+	scope := pass.Pkg.Scope()
+	for _, n := range scope.Names() {
+		obj, ok := scope.Lookup(n).(*types.TypeName)
+		if !ok || (n != name && pass.Pkg.Path()+"."+n != name) {
+			continue
+		}
+
+		typ, ok := obj.Type().Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+
+		var buf bytes.Buffer
+
+		fmt.Fprintf(&buf, "%s.%s: size %d, align %d, pointer bytes %d\n", pass.Pkg.Path(), n, s.Sizeof(typ),
+			s.Alignof(typ), s.ptrdata(typ))
+
+		tw := tabwriter.NewWriter(&buf, 0, 0, 1, ' ', 0)
+		fmt.Fprintf(tw, "\tfield\ttype\toffset\tsize\talign\tpadding\tpointer bytes\n")
+		for _, f := range s.layout(typ) {
+			fmt.Fprintf(tw, "\t%s\t%s\t%d\t%d\t%d\t%d\t%d\n", f.Name, f.Type, f.Offset, f.Size, f.Align, f.Padding,
+				f.PtrData)
+		}
+		_ = tw.Flush()
+
+		layoutMu.Lock()
+		_, _ = w.Write(buf.Bytes())
+		layoutMu.Unlock()
+	}
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package betteralign
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// isLockedFile reports whether err is caused by another process, such as an antivirus or an editor, holding the
+// file open.
+func isLockedFile(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION) || errors.Is(err, windows.ERROR_LOCK_VIOLATION) ||
+		errors.Is(err, windows.ERROR_ACCESS_DENIED)
+}
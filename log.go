@@ -0,0 +1,39 @@
+package betteralign
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"log/slog"
+	"os"
+)
+
+// Logger returns the stderr logger at the level selected by verbose and debug flags. Warnings are always logged.
+func Logger() *slog.Logger {
+	level := slog.LevelWarn
+
+	switch {
+	case debug:
+		level = slog.LevelDebug
+	case verbose:
+		level = slog.LevelInfo
+	}
+
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+}
+
+// auditf explains to stderr why a file or struct was skipped, when verbose reporting is enabled.
+func auditf(fset *token.FileSet, pos token.Pos, format string, args ...interface{}) {
+	if !verbose && !debug {
+		return
+	}
+
+	Logger().Info(fmt.Sprintf(format, args...), "pos", fset.Position(pos).String())
+}
+
+// auditFile explains why file of node is skipped, once per file rather than for every node in it.
+func auditFile(fset *token.FileSet, node ast.Node, reason string) {
+	if f, ok := node.(*ast.File); ok {
+		auditf(fset, f.Package, "skipping %s", reason)
+	}
+}
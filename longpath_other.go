@@ -0,0 +1,13 @@
+//go:build !windows
+
+package betteralign
+
+// normalPath returns file name fn, as only Windows has long path prefixes.
+func normalPath(fn string) string {
+	return fn
+}
+
+// longPath returns file name fn, as only Windows limits path lengths of file system calls.
+func longPath(fn string) string {
+	return fn
+}
@@ -0,0 +1,42 @@
+//go:build windows
+
+package betteralign
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+const (
+	longPathPrefix = `\\?\`
+	longUNCPrefix  = `\\?\UNC\`
+)
+
+// normalPath returns file name fn without the \\?\ long path prefix, so it can be relativized against and matched
+// with ordinary paths. \\?\UNC\server\share paths become \\server\share paths.
+func normalPath(fn string) string {
+	switch {
+	case strings.HasPrefix(fn, longUNCPrefix):
+		return `\\` + fn[len(longUNCPrefix):]
+	case strings.HasPrefix(fn, longPathPrefix):
+		return fn[len(longPathPrefix):]
+	}
+
+	return fn
+}
+
+// longPath returns absolute file name fn with the \\?\ long path prefix, lifting the MAX_PATH limit of file system
+// calls in deep trees, including on UNC shares. Relative names are returned as they are.
+func longPath(fn string) string {
+	fn = normalPath(fn)
+	if !filepath.IsAbs(fn) {
+		return fn
+	}
+
+	fn = filepath.Clean(fn)
+	if strings.HasPrefix(fn, `\\`) {
+		return longUNCPrefix + fn[2:]
+	}
+
+	return longPathPrefix + fn
+}
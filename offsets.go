@@ -0,0 +1,117 @@
+package betteralign
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/sirkon/dst"
+)
+
+// offsetComment matches an offset comment written by offset_comments, alone or following another trailing comment.
+var offsetComment = regexp.MustCompile(`\s*// offset \d+, size \d+$`)
+
+// hasOffsetComments reports whether any field of struct node has an offset comment of a previous run.
+func hasOffsetComments(node *ast.StructType) bool {
+	for _, f := range node.Fields.List {
+		if f.Comment == nil {
+			continue
+		}
+
+		for _, c := range f.Comment.List {
+			if offsetComment.MatchString(c.Text) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// fieldStarts maps fields of struct node to the index of their first name among the fields of its type.
+func fieldStarts(node *dst.StructType) map[*dst.Field]int {
+	starts := make(map[*dst.Field]int, len(node.Fields.List))
+
+	for i, f := range flattenFields(node) {
+		if f != nil {
+			starts[f] = i
+		}
+	}
+
+	return starts
+}
+
+// annotateOffsets sets a trailing "// offset N, size M" comment on every field of struct node, replacing offset
+// comments of previous runs. Fields of node may have been reordered since starts was taken, while typ has fields
+// in their original order. Multi-named fields get the offset of their first name and the size of all names. It
+// reports whether any comment changed.
+func annotateOffsets(node *dst.StructType, typ *types.Struct, starts map[*dst.Field]int, s *gcSizes) bool {
+	var fields []*types.Var
+
+	for _, f := range node.Fields.List {
+		for i := 0; i < max(len(f.Names), 1); i++ {
+			fields = append(fields, typ.Field(starts[f]+i))
+		}
+	}
+
+	layout := s.layout(types.NewStruct(fields, nil))
+
+	var changed bool
+
+	k := 0
+	for _, f := range node.Fields.List {
+		first, last := layout[k], layout[k+max(len(f.Names), 1)-1]
+		k += max(len(f.Names), 1)
+
+		comment := fmt.Sprintf("// offset %d, size %d", first.Offset, last.Offset+last.Size-first.Offset)
+
+		end := f.Decs.End.All()
+
+		var kept []string
+
+		for _, c := range end {
+			if c = offsetComment.ReplaceAllString(c, ""); c != "" {
+				kept = append(kept, c)
+			}
+		}
+
+		// a line comment ends the line, so the offset is appended to a trailing line comment
+		if n := len(kept); n > 0 && strings.HasPrefix(kept[n-1], "//") {
+			kept[n-1] += " " + comment
+		} else {
+			kept = append(kept, comment)
+		}
+
+		if !slices.Equal(kept, end) {
+			f.Decs.End.Replace(kept...)
+
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// refreshOffsets updates offset comments of previous runs in already optimal struct node, whose field sizes may
+// have changed since, adding its file to fixOps when they did.
+func refreshOffsets(node *ast.StructType, typ *types.Struct, lazy *lazyFile, fixOps map[string]*dst.File, fn string,
+	s *gcSizes,
+) {
+	dFile, err := lazy.decorate()
+	if err != nil {
+		return
+	}
+
+	dNode := lazy.dec.Dst.Nodes[node].(*dst.StructType)
+
+	if hasIgnoreComment(dNode.Fields, "") {
+		return
+	}
+
+	if annotateOffsets(dNode, typ, fieldStarts(dNode), s) {
+		fixOps[fn] = dFile
+	}
+}
@@ -0,0 +1,213 @@
+package betteralign
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/renameio/v2/maybe"
+	"github.com/sirkon/dst"
+)
+
+// Output receives files rewritten by apply, letting embedders capture them in memory, write them to a different
+// root or feed them to a VCS API instead of rewriting files in place. WriteFile may be called concurrently.
+type Output interface {
+	// WriteFile stores rewritten contents data of file name, whose original permissions are perm.
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// ApplyHook is called with original and rewritten contents of every file before it is written, letting embedders
+// route changes through their own review or commit pipelines. Returning ErrSkipWrite skips writing the file, when
+// the hook handled the change itself, and any other error is reported as failure to write it. It may be called
+// concurrently.
+type ApplyHook func(path string, original, rewritten []byte) error
+
+// FindingHandler is called with every finding as soon as it is reported, letting drivers stream findings while
+// analysis progresses. It may be called concurrently.
+type FindingHandler func(Finding)
+
+var (
+	outputMu       sync.RWMutex
+	output         Output = DiskOutput{}
+	applyHook      ApplyHook
+	findingHandler FindingHandler
+)
+
+// SetApplyHook sets the hook called before writing rewritten files, or removes it when hook is nil.
+func SetApplyHook(hook ApplyHook) {
+	outputMu.Lock()
+	applyHook = hook
+	outputMu.Unlock()
+}
+
+// SetFindingHandler sets the handler called with every finding, or removes it when handler is nil.
+func SetFindingHandler(handler FindingHandler) {
+	outputMu.Lock()
+	findingHandler = handler
+	outputMu.Unlock()
+}
+
+// addFinding records finding f in result r and passes it to the finding handler, if any.
+func addFinding(r *Result, f Finding) {
+	r.Findings = append(r.Findings, f)
+
+	outputMu.RLock()
+	handler := findingHandler
+	outputMu.RUnlock()
+
+	if handler != nil {
+		handler(f)
+	}
+}
+
+// SetOutput sets the output of files rewritten by apply, DiskOutput by default.
+func SetOutput(o Output) {
+	outputMu.Lock()
+	output = o
+	outputMu.Unlock()
+}
+
+// DiskOutput rewrites files in place atomically, retrying while they are locked by other processes and keeping
+// their modification times when preserve_mtime is used.
+type DiskOutput struct{}
+
+// WriteFile implements Output.
+func (DiskOutput) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	var mtime time.Time
+
+	// deep trees exceed MAX_PATH on Windows
+	name = longPath(name)
+
+	if preserveMtime {
+		st, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+
+		mtime = st.ModTime()
+	}
+
+	if err := writeFileRetry(name, data, perm); err != nil {
+		return err
+	}
+
+	// the atomic rename leaves a new file, so the original modification time is restored afterwards
+	if preserveMtime {
+		return os.Chtimes(name, time.Time{}, mtime)
+	}
+
+	return nil
+}
+
+// DirOutput writes rewritten files below directory Root, at their absolute paths with any volume name removed,
+// leaving original files untouched.
+type DirOutput struct {
+	Root string
+}
+
+// WriteFile implements Output.
+func (o DirOutput) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	abs, err := filepath.Abs(normalPath(name))
+	if err != nil {
+		return err
+	}
+
+	fn := longPath(filepath.Join(o.Root, abs[len(filepath.VolumeName(abs)):]))
+	if err := os.MkdirAll(filepath.Dir(fn), 0o755); err != nil {
+		return err
+	}
+
+	return maybe.WriteFile(fn, data, perm)
+}
+
+// MemOutput captures rewritten files in memory, keyed by file name.
+type MemOutput struct {
+	files map[string][]byte
+	mu    sync.Mutex
+}
+
+// WriteFile implements Output.
+func (o *MemOutput) WriteFile(name string, data []byte, _ fs.FileMode) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.files == nil {
+		o.files = make(map[string][]byte)
+	}
+
+	o.files[name] = data
+
+	return nil
+}
+
+// Files returns captured files keyed by file name.
+func (o *MemOutput) Files() map[string][]byte {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	files := make(map[string][]byte, len(o.files))
+	for name, data := range o.files {
+		files[name] = data
+	}
+
+	return files
+}
+
+// writeFileRetry atomically writes buf to file fn, retrying with exponential backoff while the file is locked by
+// another process.
+func writeFileRetry(fn string, buf []byte, perm os.FileMode) error {
+	for attempt := 0; ; attempt++ {
+		err := maybe.WriteFile(fn, buf, perm)
+		if err == nil || attempt == applyRetries || !isLockedFile(err) {
+			return err
+		}
+
+		Logger().Debug("file locked, retrying", "file", fn, "attempt", attempt+1, "error", err)
+		time.Sleep(applyBackoff << attempt)
+	}
+}
+
+// dryRunMu serializes dry run output of packages analyzed concurrently.
+var dryRunMu sync.Mutex
+
+// printDryRun writes a line per file which would be fixed to w, with the number of structs and bytes affected.
+func printDryRun(w io.Writer, result *Result, files map[string]*dst.File) {
+	type fileStats struct {
+		structs         int
+		saved, ptrSaved int64
+	}
+
+	stats := make(map[string]*fileStats, len(files))
+	for fn := range files {
+		stats[fn] = &fileStats{}
+	}
+
+	for _, f := range result.Findings {
+		if st, ok := stats[f.Pos.Filename]; ok && f.Pinned == "" {
+			st.structs++
+			st.saved += f.Saved()
+			st.ptrSaved += f.PtrSaved()
+		}
+	}
+
+	names := make([]string, 0, len(stats))
+	for fn := range stats {
+		names = append(names, fn)
+	}
+
+	sort.Strings(names)
+
+	dryRunMu.Lock()
+	defer dryRunMu.Unlock()
+
+	for _, fn := range names {
+		st := stats[fn]
+		fmt.Fprintf(w, "%s: would fix %d structs, %d bytes saved, %d pointer bytes saved\n", fn, st.structs,
+			st.saved, st.ptrSaved)
+	}
+}
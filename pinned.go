@@ -0,0 +1,486 @@
+package betteralign
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// pinReason describes why the field order of a type has to be preserved and where that was detected.
+type pinReason struct {
+	reason string
+	pos    token.Pos
+}
+
+// pinnedTypes holds types declared in the analyzed package whose field order is semantically significant, so
+// reordering them would change runtime behavior.
+type pinnedTypes map[*types.TypeName]pinReason
+
+// pin records obj as pinned, keeping the first reason found for it. Types declared outside of the analyzed package
+// are never rewritten and are ignored.
+func (p pinnedTypes) pin(pass *analysis.Pass, obj *types.TypeName, pos token.Pos, reason string) {
+	if obj == nil || obj.Pkg() != pass.Pkg {
+		return
+	}
+
+	if _, ok := p[obj]; ok {
+		return
+	}
+
+	p[obj] = pinReason{reason: reason, pos: pos}
+}
+
+// message returns the explanation appended to diagnostics of a pinned type.
+func (r pinReason) message(fset *token.FileSet) string {
+	position := fset.Position(r.pos)
+
+	return fmt.Sprintf("not reordered: %s at %s:%d", r.reason, filepath.Base(position.Filename), position.Line)
+}
+
+// findPinnedTypes walks all package files and looks for code depending on the declared field order of local types.
+func findPinnedTypes(pass *analysis.Pass) pinnedTypes {
+	pinned := make(pinnedTypes)
+
+	// Track simple local variable initializations so that reflect values stored in a variable can be traced back
+	// to the type they were created from.
+	inits := make(map[types.Object]ast.Expr)
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.AssignStmt:
+				if n.Tok != token.DEFINE || len(n.Lhs) != len(n.Rhs) {
+					return true
+				}
+				for i, lhs := range n.Lhs {
+					if id, ok := lhs.(*ast.Ident); ok {
+						if obj := pass.TypesInfo.Defs[id]; obj != nil {
+							inits[obj] = n.Rhs[i]
+						}
+					}
+				}
+			case *ast.ValueSpec:
+				if len(n.Names) != len(n.Values) {
+					return true
+				}
+				for i, id := range n.Names {
+					if obj := pass.TypesInfo.Defs[id]; obj != nil {
+						inits[obj] = n.Values[i]
+					}
+				}
+			}
+
+			return true
+		})
+	}
+
+	var convs []conversion
+
+	// unsafe.Pointer operands of conversions between layout-compatible types, pinned with the conversion
+	converted := make(map[ast.Expr]bool)
+
+	for _, f := range pass.Files {
+		findCgoTypes(pass, pinned, f)
+
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+
+			findIndexedFieldAccess(pass, pinned, inits, call)
+
+			if c, ok := findLayoutConversion(pass, call); ok {
+				convs = append(convs, c)
+				converted[ast.Unparen(call.Args[0])] = true
+			} else if !converted[call] {
+				findUnsafeConversion(pass, pinned, call)
+			}
+
+			if !reorderBinary {
+				findBinaryEncoding(pass, pinned, call)
+			}
+
+			if !reorderGob {
+				findCodecUsage(pass, pinned, call, gobFuncs)
+			}
+
+			findCodecUsage(pass, pinned, call, codecFuncs)
+			findSyscallUsage(pass, pinned, call)
+
+			return true
+		})
+	}
+
+	pinConversions(pass, pinned, convs)
+
+	return pinned
+}
+
+// findIndexedFieldAccess pins types whose fields are accessed by a constant index through reflect (Value.Field,
+// Type.Field, FieldByIndex) or whose field offsets are taken with unsafe.Offsetof.
+func findIndexedFieldAccess(pass *analysis.Pass, pinned pinnedTypes, inits map[types.Object]ast.Expr,
+	call *ast.CallExpr,
+) {
+	if isBuiltin(pass.TypesInfo, call, "Offsetof") && len(call.Args) == 1 {
+		if sel, ok := ast.Unparen(call.Args[0]).(*ast.SelectorExpr); ok {
+			if selection := pass.TypesInfo.Selections[sel]; selection != nil {
+				pinned.pin(pass, namedTypeName(selection.Recv()), call.Pos(), "field offset taken by unsafe.Offsetof")
+			}
+		}
+
+		return
+	}
+
+	fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+	if !ok || !isReflectMethod(fn) || len(call.Args) != 1 {
+		return
+	}
+
+	sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr)
+	if !ok {
+		return
+	}
+
+	switch fn.Name() {
+	case "Field":
+		if tv, ok := pass.TypesInfo.Types[call.Args[0]]; !ok || tv.Value == nil {
+			return
+		}
+	case "FieldByIndex":
+		if _, ok := ast.Unparen(call.Args[0]).(*ast.CompositeLit); !ok {
+			return
+		}
+	default:
+		return
+	}
+
+	pinned.pin(pass, reflectedType(pass.TypesInfo, inits, sel.X, 0), call.Pos(),
+		fmt.Sprintf("field accessed by index via reflect %s", fn.Name()))
+}
+
+// gobFuncs are encoding/gob entry points whose arguments are considered to have a persisted, order-dependent
+// encoding.
+var gobFuncs = []string{
+	"encoding/gob.Register",
+	"encoding/gob.RegisterName",
+	"encoding/gob.Encoder.Encode",
+	"encoding/gob.Decoder.Decode",
+}
+
+// findCodecUsage pins types passed as arguments to any of the given functions, named either as
+// "import/path.Func" or "import/path.Type.Method".
+func findCodecUsage(pass *analysis.Pass, pinned pinnedTypes, call *ast.CallExpr, funcs []string) {
+	if len(funcs) == 0 {
+		return
+	}
+
+	fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+	if !ok || fn.Pkg() == nil {
+		return
+	}
+
+	name := qualifiedFuncName(fn)
+	for _, f := range funcs {
+		if f != name {
+			continue
+		}
+
+		for _, arg := range call.Args {
+			pinned.pinLayout(pass, pass.TypesInfo.TypeOf(arg), call.Pos(),
+				fmt.Sprintf("encoded with %s", name[strings.LastIndex(name, "/")+1:]))
+		}
+
+		return
+	}
+}
+
+// qualifiedFuncName returns the fully qualified name of a function or method, e.g. "encoding/gob.Encoder.Encode".
+func qualifiedFuncName(fn *types.Func) string {
+	if sig, ok := fn.Type().(*types.Signature); ok && sig.Recv() != nil {
+		if obj := namedTypeName(sig.Recv().Type()); obj != nil {
+			return fmt.Sprintf("%s.%s.%s", fn.Pkg().Path(), obj.Name(), fn.Name())
+		}
+	}
+
+	return fmt.Sprintf("%s.%s", fn.Pkg().Path(), fn.Name())
+}
+
+// syscallPkgs are packages whose functions pass their arguments to the kernel, which fixes the struct layout.
+var syscallPkgs = map[string]bool{
+	"syscall":                  true,
+	"golang.org/x/sys/unix":    true,
+	"golang.org/x/sys/windows": true,
+	"golang.org/x/sys/plan9":   true,
+}
+
+// findSyscallUsage pins types passed to syscall, ioctl, setsockopt, netlink and other kernel interfacing functions.
+func findSyscallUsage(pass *analysis.Pass, pinned pinnedTypes, call *ast.CallExpr) {
+	fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+	if !ok || fn.Pkg() == nil || !syscallPkgs[fn.Pkg().Path()] {
+		return
+	}
+
+	for _, arg := range call.Args {
+		pinned.pinLayout(pass, pass.TypesInfo.TypeOf(unwrapPointerConversion(pass.TypesInfo, arg)), call.Pos(),
+			fmt.Sprintf("passed to %s.%s", fn.Pkg().Name(), fn.Name()))
+	}
+}
+
+// unwrapPointerConversion strips uintptr and unsafe.Pointer conversions, e.g. uintptr(unsafe.Pointer(&t)), from
+// expr and returns the converted operand.
+func unwrapPointerConversion(info *types.Info, expr ast.Expr) ast.Expr {
+	for {
+		call, ok := ast.Unparen(expr).(*ast.CallExpr)
+		if !ok || len(call.Args) != 1 {
+			return expr
+		}
+
+		tv, ok := info.Types[call.Fun]
+		if !ok || !tv.IsType() {
+			return expr
+		}
+
+		b, ok := types.Unalias(tv.Type).(*types.Basic)
+		if !ok || (b.Kind() != types.Uintptr && b.Kind() != types.UnsafePointer) {
+			return expr
+		}
+
+		expr = call.Args[0]
+	}
+}
+
+// findUnsafeConversion pins types converted to or from unsafe.Pointer, as such casts (including casts to cgo
+// types) rely on the layout matching another definition.
+func findUnsafeConversion(pass *analysis.Pass, pinned pinnedTypes, call *ast.CallExpr) {
+	if len(call.Args) != 1 {
+		return
+	}
+
+	if tv, ok := pass.TypesInfo.Types[call.Fun]; !ok || !tv.IsType() {
+		return
+	}
+
+	to, from := pass.TypesInfo.TypeOf(call.Fun), pass.TypesInfo.TypeOf(call.Args[0])
+
+	switch {
+	case isUnsafePointer(to):
+		pinned.pinLayout(pass, from, call.Pos(), "converted to unsafe.Pointer")
+	case isUnsafePointer(from):
+		pinned.pinLayout(pass, to, call.Pos(), "converted from unsafe.Pointer")
+	}
+}
+
+// findCgoTypes pins all struct types declared in files processed by cgo, as they usually mirror C definitions.
+func findCgoTypes(pass *analysis.Pass, pinned pinnedTypes, f *ast.File) {
+	pos := cgoImportPos(f)
+	if !pos.IsValid() {
+		return
+	}
+
+	for _, decl := range f.Decls {
+		g, ok := decl.(*ast.GenDecl)
+		if !ok || g.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range g.Specs {
+			if obj, ok := pass.TypesInfo.Defs[spec.(*ast.TypeSpec).Name].(*types.TypeName); ok {
+				pinned.pinLayout(pass, obj.Type(), pos, "declared in a cgo file")
+			}
+		}
+	}
+}
+
+// cgoImportPos returns the position of the "C" pseudo-package import, or of the first cgo-rewritten identifier
+// (_Ctype_, _Cfunc_ etc.) when the file has already been processed by cgo.
+func cgoImportPos(f *ast.File) token.Pos {
+	for _, imp := range f.Imports {
+		if imp.Path.Value == `"C"` {
+			return imp.Pos()
+		}
+	}
+
+	return cgoRewritePos(f)
+}
+
+// isUnsafePointer reports whether t is unsafe.Pointer.
+func isUnsafePointer(t types.Type) bool {
+	b, ok := types.Unalias(t).(*types.Basic)
+
+	return ok && b.Kind() == types.UnsafePointer
+}
+
+// binaryDataArgs maps encoding/binary functions to the index of their data argument.
+var binaryDataArgs = map[string]int{
+	"Read":   2,
+	"Write":  2,
+	"Size":   0,
+	"Encode": 2,
+	"Decode": 2,
+	"Append": 2,
+}
+
+// findBinaryEncoding pins types passed to encoding/binary functions, since their field order defines the wire
+// format.
+func findBinaryEncoding(pass *analysis.Pass, pinned pinnedTypes, call *ast.CallExpr) {
+	fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != "encoding/binary" || isMethod(fn) {
+		return
+	}
+
+	idx, ok := binaryDataArgs[fn.Name()]
+	if !ok || idx >= len(call.Args) {
+		return
+	}
+
+	pinned.pinLayout(pass, pass.TypesInfo.TypeOf(call.Args[idx]), call.Pos(),
+		fmt.Sprintf("serialized with binary.%s", fn.Name()))
+}
+
+// pinLayout pins the struct type referenced by t (through pointers, slices and arrays) together with all local
+// struct types nested in it, as the whole memory layout is significant.
+func (p pinnedTypes) pinLayout(pass *analysis.Pass, t types.Type, pos token.Pos, reason string) {
+	p.pinNested(pass, t, pos, reason, make(map[*types.TypeName]bool))
+}
+
+// pinNested pins like pinLayout, visiting every named type once to stop at recursive types. Types pinned before, e.g.
+// by unsafe.Offsetof on their own fields only, are still descended into, as their nested types may not be pinned.
+func (p pinnedTypes) pinNested(pass *analysis.Pass, t types.Type, pos token.Pos, reason string,
+	visited map[*types.TypeName]bool,
+) {
+	for t != nil {
+		switch u := types.Unalias(t).(type) {
+		case *types.Pointer:
+			t = u.Elem()
+		case *types.Slice:
+			t = u.Elem()
+		case *types.Array:
+			t = u.Elem()
+		case *types.Named:
+			obj := u.Origin().Obj()
+			if visited[obj] || obj.Pkg() != pass.Pkg {
+				return
+			}
+			visited[obj] = true
+
+			st, ok := u.Underlying().(*types.Struct)
+			if !ok {
+				return
+			}
+
+			p.pin(pass, obj, pos, reason)
+
+			for i := 0; i < st.NumFields(); i++ {
+				p.pinNested(pass, st.Field(i).Type(), pos, reason, visited)
+			}
+
+			return
+		case *types.Struct:
+			for i := 0; i < u.NumFields(); i++ {
+				p.pinNested(pass, u.Field(i).Type(), pos, reason, visited)
+			}
+
+			return
+		default:
+			return
+		}
+	}
+}
+
+// maxReflectDepth bounds how many variable assignments and method calls are followed by reflectedType.
+const maxReflectDepth = 8
+
+// reflectedType returns the named type a reflect.Value or reflect.Type expression was derived from, following
+// reflect.ValueOf, reflect.TypeOf, reflect.TypeFor, reflect.Indirect, Elem/Type calls and local variables
+// initialized from such expressions.
+func reflectedType(info *types.Info, inits map[types.Object]ast.Expr, expr ast.Expr, depth int) *types.TypeName {
+	if depth > maxReflectDepth {
+		return nil
+	}
+
+	switch e := ast.Unparen(expr).(type) {
+	case *ast.Ident:
+		if init, ok := inits[info.Uses[e]]; ok {
+			return reflectedType(info, inits, init, depth+1)
+		}
+	case *ast.CallExpr:
+		fn, ok := typeutil.Callee(info, e).(*types.Func)
+		if !ok || fn.Pkg() == nil || fn.Pkg().Path() != "reflect" {
+			return nil
+		}
+
+		switch fn.Name() {
+		case "ValueOf", "TypeOf":
+			if len(e.Args) == 1 && !isReflectMethod(fn) {
+				return namedTypeName(info.TypeOf(e.Args[0]))
+			}
+		case "TypeFor":
+			if inst, ok := ast.Unparen(e.Fun).(*ast.IndexExpr); ok {
+				return namedTypeName(info.TypeOf(inst.Index))
+			}
+		case "Indirect":
+			if len(e.Args) == 1 {
+				return reflectedType(info, inits, e.Args[0], depth+1)
+			}
+		case "Elem", "Type":
+			if sel, ok := ast.Unparen(e.Fun).(*ast.SelectorExpr); ok && isReflectMethod(fn) {
+				return reflectedType(info, inits, sel.X, depth+1)
+			}
+		}
+	}
+
+	return nil
+}
+
+// isReflectMethod reports whether fn is a method of reflect.Value or reflect.Type.
+func isReflectMethod(fn *types.Func) bool {
+	return fn.Pkg() != nil && fn.Pkg().Path() == "reflect" && isMethod(fn)
+}
+
+// isMethod reports whether fn has a receiver.
+func isMethod(fn *types.Func) bool {
+	sig, ok := fn.Type().(*types.Signature)
+
+	return ok && sig.Recv() != nil
+}
+
+// isBuiltin reports whether call invokes the named builtin function, including the unsafe package builtins.
+func isBuiltin(info *types.Info, call *ast.CallExpr, name string) bool {
+	var id *ast.Ident
+
+	switch fun := ast.Unparen(call.Fun).(type) {
+	case *ast.Ident:
+		id = fun
+	case *ast.SelectorExpr:
+		id = fun.Sel
+	default:
+		return false
+	}
+
+	b, ok := info.Uses[id].(*types.Builtin)
+
+	return ok && b.Name() == name
+}
+
+// namedTypeName returns the declaring type name of t, dereferencing a pointer if needed.
+func namedTypeName(t types.Type) *types.TypeName {
+	if t == nil {
+		return nil
+	}
+
+	if ptr, ok := types.Unalias(t).(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+
+	if named, ok := types.Unalias(t).(*types.Named); ok {
+		return named.Origin().Obj()
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package betteralign
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+)
+
+// PlanEntry describes the fix of a single struct, as recorded with plan: the file and byte offsets of the struct
+// type, the original and new order of field indexes, and the source of the struct type before and after the fix.
+type PlanEntry struct {
+	File          string `json:"file"`
+	Package       string `json:"package"`
+	Struct        string `json:"struct"`
+	Original      string `json:"original"`
+	Rewritten     string `json:"rewritten"`
+	OriginalOrder []int  `json:"original_order"`
+	Order         []int  `json:"order"`
+	Start         int    `json:"start"`
+	End           int    `json:"end"`
+}
+
+// newPlanEntry returns the plan of reordering fields of the struct type of file fn spanning bytes start to end
+// into order. The rewritten source is taken from the same file with only this struct reordered.
+func newPlanEntry(fn string, start, end int, order []int) (PlanEntry, error) {
+	src, err := os.ReadFile(overlayFile(fn))
+	if err != nil {
+		return PlanEntry{}, err
+	}
+
+	fixed, err := ReorderFields(fn, src, start, order)
+	if err != nil {
+		return PlanEntry{}, err
+	}
+
+	// printing may reformat the file, so the struct is found by its index among struct types of the file
+	fset, structs, err := structTypes(fn, src)
+	if err != nil {
+		return PlanEntry{}, err
+	}
+
+	fixedFset, fixedStructs, err := structTypes(fn, fixed)
+	if err != nil {
+		return PlanEntry{}, err
+	}
+
+	var rewritten string
+
+	for i, s := range structs {
+		if fset.Position(s.Pos()).Offset == start && i < len(fixedStructs) {
+			f := fixedStructs[i]
+			rewritten = string(fixed[fixedFset.Position(f.Pos()).Offset:fixedFset.Position(f.End()).Offset])
+		}
+	}
+
+	if rewritten == "" {
+		return PlanEntry{}, ErrStructNotFound
+	}
+
+	original := make([]int, len(order))
+	for i := range original {
+		original[i] = i
+	}
+
+	return PlanEntry{
+		File:          fn,
+		Original:      string(src[start:end]),
+		Rewritten:     rewritten,
+		OriginalOrder: original,
+		Order:         order,
+		Start:         start,
+		End:           end,
+	}, nil
+}
+
+// structTypes parses source src of file fn and returns its struct types in source order.
+func structTypes(fn string, src []byte) (*token.FileSet, []*ast.StructType, error) {
+	fset := token.NewFileSet()
+
+	f, err := parser.ParseFile(fset, fn, src, parser.ParseComments)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var structs []*ast.StructType
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		if s, ok := n.(*ast.StructType); ok {
+			structs = append(structs, s)
+		}
+
+		return true
+	})
+
+	return fset, structs, nil
+}
+
+// AllPlans returns fix plans recorded with plan of all results, ordered by file and offset.
+func AllPlans(results []*Result) []PlanEntry {
+	var plans []PlanEntry
+
+	for _, r := range results {
+		if r != nil {
+			plans = append(plans, r.Plan...)
+		}
+	}
+
+	sort.SliceStable(plans, func(i, j int) bool {
+		if plans[i].File != plans[j].File {
+			return plans[i].File < plans[j].File
+		}
+
+		return plans[i].Start < plans[j].Start
+	})
+
+	return plans
+}
@@ -0,0 +1,407 @@
+package betteralign
+
+import (
+	"bufio"
+	"fmt"
+	"go/token"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Finding describes a single struct reported by the analyzer.
+type Finding struct {
+	Package         string         `json:"package"`
+	Struct          string         `json:"struct"`
+	Message         string         `json:"message"`
+	Code            string         `json:"code"`
+	Pinned          string         `json:"pinned,omitempty"`
+	Hot             string         `json:"hot,omitempty"`
+	Order           []int          `json:"order,omitempty"`
+	Aliases         []string       `json:"aliases,omitempty"`
+	Pos             token.Position `json:"pos"`
+	Size            int64          `json:"size"`
+	OptimalSize     int64          `json:"optimal_size"`
+	PtrBytes        int64          `json:"ptr_bytes"`
+	OptimalPtrBytes int64          `json:"optimal_ptr_bytes"`
+	AllocSites      int            `json:"alloc_sites,omitempty"`
+	HeapBytes       int64          `json:"heap_bytes,omitempty"`
+	HeapObjects     int64          `json:"heap_objects,omitempty"`
+}
+
+// Impact returns an estimated impact score of the finding: bytes saved (or pointer bytes saved, if the size does
+// not change) weighted by the number of static allocation sites of the struct.
+func (f Finding) Impact() int64 {
+	return max(f.Saved(), f.PtrSaved()) * int64(max(f.AllocSites, 1))
+}
+
+// CodedMessage returns the message prefixed with the diagnostic code, as reported in diagnostics. Findings of result
+// files written before codes were introduced have no code and return the bare message.
+func (f Finding) CodedMessage() string {
+	if f.Code == "" {
+		return f.Message
+	}
+
+	return f.Code + ": " + f.Message
+}
+
+// Saved returns the number of bytes saved by reordering the struct.
+func (f Finding) Saved() int64 {
+	return max(f.Size-f.OptimalSize, 0)
+}
+
+// PtrSaved returns the number of pointer bytes saved by reordering the struct.
+func (f Finding) PtrSaved() int64 {
+	return max(f.PtrBytes-f.OptimalPtrBytes, 0)
+}
+
+// Result is the per-package result of the analyzer, available to drivers through analysis results.
+type Result struct {
+	Package  string
+	Findings []Finding
+	Audit    []StructAudit
+	Plan     []PlanEntry
+	Timing   Timing
+	Analyzed int
+}
+
+// StructAudit is the layout of an analyzed struct, optimal or not, as recorded with audit.
+type StructAudit struct {
+	Package         string         `json:"package"`
+	Struct          string         `json:"struct"`
+	Pos             token.Position `json:"pos"`
+	Size            int64          `json:"size"`
+	Align           int64          `json:"align"`
+	PtrBytes        int64          `json:"ptr_bytes"`
+	Padding         int64          `json:"padding"`
+	OptimalSize     int64          `json:"optimal_size"`
+	OptimalPtrBytes int64          `json:"optimal_ptr_bytes"`
+	Optimal         bool           `json:"optimal"`
+}
+
+// AllAudits returns struct layouts recorded with audit of all results, sorted by source position.
+func AllAudits(results []*Result) []StructAudit {
+	var audits []StructAudit
+
+	for _, r := range results {
+		if r != nil {
+			audits = append(audits, r.Audit...)
+		}
+	}
+
+	sort.SliceStable(audits, func(i, j int) bool {
+		return positionLess(audits[i].Pos, audits[j].Pos)
+	})
+
+	return audits
+}
+
+// PackageSummary aggregates results of a single package, or of the whole run.
+type PackageSummary struct {
+	Package       string `json:"package,omitempty"`
+	Analyzed      int    `json:"analyzed"`
+	Suboptimal    int    `json:"suboptimal"`
+	BytesSaved    int64  `json:"bytes_saved"`
+	PtrBytesSaved int64  `json:"ptr_bytes_saved"`
+}
+
+// Summary aggregates results of a whole run, with totals and per package breakdown sorted by package path.
+type Summary struct {
+	Packages []PackageSummary `json:"packages"`
+	PackageSummary
+}
+
+// add accumulates result r into the summary.
+func (s *PackageSummary) add(r *Result) {
+	s.Analyzed += r.Analyzed
+	s.Suboptimal += len(r.Findings)
+
+	for _, f := range r.Findings {
+		s.BytesSaved += f.Saved()
+		s.PtrBytesSaved += f.PtrSaved()
+	}
+}
+
+// Summarize aggregates per-package results, merging results of package variants sharing the same path.
+func Summarize(results []*Result) Summary {
+	var s Summary
+
+	byPkg := make(map[string]*PackageSummary)
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+
+		ps, ok := byPkg[r.Package]
+		if !ok {
+			ps = &PackageSummary{Package: r.Package}
+			byPkg[r.Package] = ps
+		}
+
+		ps.add(r)
+		s.PackageSummary.add(r)
+	}
+
+	for _, ps := range byPkg {
+		s.Packages = append(s.Packages, *ps)
+	}
+
+	sort.Slice(s.Packages, func(i, j int) bool {
+		return s.Packages[i].Package < s.Packages[j].Package
+	})
+
+	return s
+}
+
+// Badge is a shields.io endpoint badge, see https://shields.io/badges/endpoint-badge.
+type Badge struct {
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+// Badge returns a badge showing total bytes saved of the summary as struct padding waste: bright green without any
+// waste, yellow below 1KiB and orange above.
+func (s Summary) Badge() Badge {
+	color := "orange"
+
+	switch {
+	case s.BytesSaved == 0:
+		color = "brightgreen"
+	case s.BytesSaved < 1024:
+		color = "yellow"
+	}
+
+	return Badge{
+		SchemaVersion: 1,
+		Label:         "struct padding waste",
+		Message:       formatBytesSep(s.BytesSaved, " "),
+		Color:         color,
+	}
+}
+
+// String returns a one line description of the summary counters.
+func (s PackageSummary) String() string {
+	return fmt.Sprintf("%d structs analyzed, %d suboptimal, %d bytes saved, %d pointer bytes saved",
+		s.Analyzed, s.Suboptimal, s.BytesSaved, s.PtrBytesSaved)
+}
+
+// WriteText writes a human readable summary with a line per package followed by the totals.
+func (s Summary) WriteText(w io.Writer) error {
+	for _, ps := range s.Packages {
+		if _, err := fmt.Fprintf(w, "%s: %v\n", ps.Package, ps); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "total: %v\n", s.PackageSummary)
+
+	return err
+}
+
+// metricLabel escapes backslashes, double quotes and newlines of label value v for the Prometheus text format.
+var metricLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteMetrics writes the summary in the Prometheus text exposition format, as read by the node_exporter textfile
+// collector: gauges of analyzed and suboptimal structs and of bytes and pointer bytes wasted, labeled by package.
+func (s Summary) WriteMetrics(w io.Writer) error {
+	metrics := []struct {
+		value      func(PackageSummary) int64
+		name, help string
+	}{
+		{func(ps PackageSummary) int64 { return int64(ps.Analyzed) }, "betteralign_structs_analyzed",
+			"Number of analyzed structs."},
+		{func(ps PackageSummary) int64 { return int64(ps.Suboptimal) }, "betteralign_structs_suboptimal",
+			"Number of structs with a suboptimal field order."},
+		{func(ps PackageSummary) int64 { return ps.BytesSaved }, "betteralign_bytes_wasted_total",
+			"Bytes saved by reordering fields of suboptimal structs."},
+		{func(ps PackageSummary) int64 { return ps.PtrBytesSaved }, "betteralign_pointer_bytes_wasted_total",
+			"Pointer bytes saved by reordering fields of suboptimal structs."},
+	}
+
+	bw := bufio.NewWriter(w)
+
+	for _, m := range metrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+
+		for _, ps := range s.Packages {
+			fmt.Fprintf(bw, "%s{package=\"%s\"} %d\n", m.name, metricLabel.Replace(ps.Package), m.value(ps))
+		}
+	}
+
+	return bw.Flush()
+}
+
+// WasteBucket counts suboptimal structs saving between Min and Max bytes, inclusive. Max is 0 for the open-ended
+// last bucket.
+type WasteBucket struct {
+	Min     int64 `json:"min"`
+	Max     int64 `json:"max,omitempty"`
+	Structs int   `json:"structs"`
+}
+
+// String returns the range of the bucket, e.g. 9-16 or 65+.
+func (b WasteBucket) String() string {
+	if b.Max == 0 {
+		return fmt.Sprintf("%d+", b.Min)
+	}
+
+	return fmt.Sprintf("%d-%d", b.Min, b.Max)
+}
+
+// WasteHistogram returns numbers of findings of all results by bytes saved, in buckets of 1-8, 9-16, 17-64 and 65+
+// bytes. Findings saving only pointer bytes are not counted.
+func WasteHistogram(results []*Result) []WasteBucket {
+	buckets := []WasteBucket{{Min: 1, Max: 8}, {Min: 9, Max: 16}, {Min: 17, Max: 64}, {Min: 65}}
+
+	for _, f := range AllFindings(results) {
+		saved := f.Saved()
+		if saved == 0 {
+			continue
+		}
+
+		for i := range buckets {
+			if saved >= buckets[i].Min && (buckets[i].Max == 0 || saved <= buckets[i].Max) {
+				buckets[i].Structs++
+
+				break
+			}
+		}
+	}
+
+	return buckets
+}
+
+// WriteHistogram writes a text histogram of buckets with a bar per bucket, scaled to the largest bucket.
+func WriteHistogram(w io.Writer, buckets []WasteBucket) error {
+	const width = 40
+
+	most := 0
+	for _, b := range buckets {
+		most = max(most, b.Structs)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "bytes saved\tstructs")
+
+	for _, b := range buckets {
+		fmt.Fprintf(tw, "%v\t%d", b, b.Structs)
+
+		if b.Structs > 0 {
+			fmt.Fprintf(tw, "\t%s", strings.Repeat("#", (b.Structs*width+most-1)/most))
+		}
+
+		fmt.Fprintln(tw)
+	}
+
+	return tw.Flush()
+}
+
+// SortBySavings sorts findings by saved bytes, then saved pointer bytes, in descending order. Ties are ordered by
+// position to keep output stable.
+func SortBySavings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		fi, fj := &findings[i], &findings[j]
+
+		if fi.Saved() != fj.Saved() {
+			return fi.Saved() > fj.Saved()
+		}
+
+		if fi.PtrSaved() != fj.PtrSaved() {
+			return fi.PtrSaved() > fj.PtrSaved()
+		}
+
+		return positionLess(fi.Pos, fj.Pos)
+	})
+}
+
+// SortByPosition sorts findings by file name, line and column.
+func SortByPosition(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		return positionLess(findings[i].Pos, findings[j].Pos)
+	})
+}
+
+// TopFindings returns at most n findings of all results with the largest savings, sorted in descending order. All
+// findings are returned when n is not positive.
+func TopFindings(results []*Result, n int) []Finding {
+	findings := AllFindings(results)
+	SortBySavings(findings)
+
+	return truncateFindings(findings, n)
+}
+
+// TopHeapFindings returns at most n findings of all results with the most heap profile allocated bytes, sorted in
+// descending order. All findings are returned when n is not positive.
+func TopHeapFindings(results []*Result, n int) []Finding {
+	findings := AllFindings(results)
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		fi, fj := &findings[i], &findings[j]
+
+		if fi.HeapBytes != fj.HeapBytes {
+			return fi.HeapBytes > fj.HeapBytes
+		}
+
+		return positionLess(fi.Pos, fj.Pos)
+	})
+
+	return truncateFindings(findings, n)
+}
+
+// AllFindings returns findings of all results.
+func AllFindings(results []*Result) []Finding {
+	var findings []Finding
+	for _, r := range results {
+		if r != nil {
+			findings = append(findings, r.Findings...)
+		}
+	}
+
+	return findings
+}
+
+// truncateFindings returns at most n findings, or all of them when n is not positive.
+func truncateFindings(findings []Finding, n int) []Finding {
+	if n > 0 && len(findings) > n {
+		return findings[:n]
+	}
+
+	return findings
+}
+
+// positionLess orders positions by file name, line and column.
+func positionLess(a, b token.Position) bool {
+	if a.Filename != b.Filename {
+		return a.Filename < b.Filename
+	}
+
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+
+	return a.Column < b.Column
+}
+
+// ByWaste returns packages with at least one suboptimal struct, ordered by bytes saved, then pointer bytes saved,
+// in descending order.
+func (s Summary) ByWaste() []PackageSummary {
+	var pkgs []PackageSummary
+	for _, ps := range s.Packages {
+		if ps.Suboptimal > 0 {
+			pkgs = append(pkgs, ps)
+		}
+	}
+
+	sort.SliceStable(pkgs, func(i, j int) bool {
+		if pkgs[i].BytesSaved != pkgs[j].BytesSaved {
+			return pkgs[i].BytesSaved > pkgs[j].BytesSaved
+		}
+
+		return pkgs[i].PtrBytesSaved > pkgs[j].PtrBytesSaved
+	})
+
+	return pkgs
+}
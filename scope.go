@@ -0,0 +1,79 @@
+package betteralign
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// fileScope holds the only files checked and fixed, or nil when all files are.
+var fileScope map[string]bool
+
+// SetFileScope restricts checking and fixing to files, given as absolute names with symlinks resolved, while their
+// packages are still type-checked in full for correct sizes. A nil set lifts the restriction. Drivers call it
+// before analysis, e.g. for //go:generate betteralign -apply -scope=file $GOFILE.
+func SetFileScope(files map[string]bool) {
+	fileScope = files
+}
+
+// variantFiles holds non-test files of packages analyzed both as foo and as its test variant foo [foo.test].
+var variantFiles map[string]bool
+
+// SetVariantFiles makes passes over test variants of packages, such as foo [foo.test], skip files, given as absolute
+// names, which the driver analyzes in the package without tests as well. Every struct of them is then reported and
+// rewritten once, by the same package whatever the order of analysis. Drivers loading packages with tests call it
+// before analysis.
+func SetVariantFiles(files map[string]bool) {
+	variantFiles = files
+}
+
+// isTestVariant reports whether the package of pass is compiled with its _test.go files.
+func isTestVariant(pass *analysis.Pass) bool {
+	for _, f := range pass.Files {
+		if strings.HasSuffix(pass.Fset.File(f.Pos()).Name(), "_test.go") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// outOfScope reports whether file fn is excluded by SetFileScope.
+func outOfScope(fn string) bool {
+	return fileScope != nil && !fileScope[realName(fn)]
+}
+
+// inFixScope reports whether fixes of file fn are applied, i.e. whether no fix_scope patterns are given or its
+// directory matches one. Patterns are package patterns relative to the working directory, where ./dir/... matches
+// dir and all directories below it.
+func inFixScope(fn string) bool {
+	if len(fixScope) == 0 {
+		return true
+	}
+
+	dir := filepath.Dir(realName(normalPath(fn)))
+
+	for _, pattern := range fixScope {
+		root, recursive := strings.CutSuffix(filepath.ToSlash(pattern), "/...")
+		if root == "..." {
+			root, recursive = ".", true
+		}
+
+		abs, err := filepath.Abs(filepath.FromSlash(root))
+		if err != nil {
+			continue
+		}
+
+		rel, err := filepath.Rel(realName(abs), dir)
+		if err != nil {
+			continue
+		}
+
+		if rel == "." || recursive && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,170 @@
+package betteralign
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/renameio/v2/maybe"
+)
+
+const optimizedFileName = "betteralign_optimized.go"
+
+// sibling is a suboptimal named struct type with the optimal order of its fields.
+type sibling struct {
+	obj     *types.TypeName
+	typ     *types.Struct
+	indexes []int
+}
+
+// fieldDecls returns declarations of fields of typ, one per line, in the order given by indexes. Types are
+// qualified relative to pkg and packages they refer to are recorded in imports by path.
+func fieldDecls(typ *types.Struct, indexes []int, pkg *types.Package, imports map[string]string) string {
+	qualifier := func(p *types.Package) string {
+		if p == pkg {
+			return ""
+		}
+
+		imports[p.Path()] = p.Name()
+
+		return p.Name()
+	}
+
+	var buf bytes.Buffer
+
+	for _, i := range indexes {
+		f := typ.Field(i)
+
+		if f.Embedded() {
+			fmt.Fprintf(&buf, "\t%s", types.TypeString(f.Type(), qualifier))
+		} else {
+			fmt.Fprintf(&buf, "\t%s %s", f.Name(), types.TypeString(f.Type(), qualifier))
+		}
+
+		if tag := typ.Tag(i); tag != "" {
+			if strings.Contains(tag, "`") {
+				fmt.Fprintf(&buf, " %s", strconv.Quote(tag))
+			} else {
+				fmt.Fprintf(&buf, " `%s`", tag)
+			}
+		}
+
+		fmt.Fprintln(&buf)
+	}
+
+	return buf.String()
+}
+
+// containsLock reports whether values of T contain a lock, a type with pointer receiver Lock and Unlock methods
+// such as sync.Mutex or the noCopy guards of sync/atomic types, which vet forbids to copy.
+func containsLock(T types.Type, visiting map[types.Type]bool) bool {
+	if visiting[T] {
+		return false
+	}
+
+	visiting[T] = true
+
+	if _, ok := T.Underlying().(*types.Interface); !ok {
+		ms := types.NewMethodSet(types.NewPointer(T))
+		if ms.Lookup(nil, "Lock") != nil && ms.Lookup(nil, "Unlock") != nil {
+			return true
+		}
+	}
+
+	switch t := T.Underlying().(type) {
+	case *types.Array:
+		return containsLock(t.Elem(), visiting)
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if containsLock(t.Field(i).Type(), visiting) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// writeImports writes an import declaration of all imports, sorted by path.
+func writeImports(buf *bytes.Buffer, imports map[string]string) {
+	if len(imports) == 0 {
+		return
+	}
+
+	paths := make([]string, 0, len(imports))
+	for path := range imports {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	fmt.Fprintf(buf, "import (\n")
+
+	for _, path := range paths {
+		fmt.Fprintf(buf, "\t%q\n", path)
+	}
+
+	fmt.Fprintf(buf, ")\n\n")
+}
+
+// writeOptimizedFile writes a TypeOptimized sibling type with optimal field order of every struct of siblings,
+// together with functions converting values to and from the original type, into optimizedFileName in dir. This
+// lets users adopt optimal layouts of types whose declarations can't be touched, such as generated types. Fields
+// containing locks are left zero by the conversions.
+func writeOptimizedFile(dir string, pkg *types.Package, siblings []sibling) error {
+	imports := make(map[string]string)
+
+	var decls bytes.Buffer
+
+	for _, s := range siblings {
+		name := s.obj.Name()
+		optimized := name + "Optimized"
+
+		fmt.Fprintf(&decls, "// %s is %s with fields in optimal order.\n", optimized, name)
+		fmt.Fprintf(&decls, "type %s struct {\n%s}\n\n", optimized, fieldDecls(s.typ, s.indexes, pkg, imports))
+
+		var assigns bytes.Buffer
+
+		for _, i := range s.indexes {
+			f := s.typ.Field(i)
+
+			switch {
+			case f.Name() == "_":
+				// blank fields can't be referenced and stay zero
+			case containsLock(f.Type(), make(map[types.Type]bool)):
+				fmt.Fprintf(&assigns, "\t\t// %s contains a lock, which must not be copied\n", f.Name())
+			default:
+				fmt.Fprintf(&assigns, "\t\t%s: v.%s,\n", f.Name(), f.Name())
+			}
+		}
+
+		fmt.Fprintf(&decls, "// New%s converts v to %s.\n", optimized, optimized)
+		fmt.Fprintf(&decls, "func New%s(v *%s) *%s {\n\treturn &%s{\n%s\t}\n}\n\n", optimized, name, optimized,
+			optimized, assigns.Bytes())
+		fmt.Fprintf(&decls, "// To%s converts v back to %s.\n", name, name)
+		fmt.Fprintf(&decls, "func (v *%s) To%s() *%s {\n\treturn &%s{\n%s\t}\n}\n\n", optimized, name, name, name,
+			assigns.Bytes())
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "// Code generated by betteralign. DO NOT EDIT.\n\npackage %s\n\n", pkg.Name())
+	writeImports(&buf, imports)
+	buf.Write(decls.Bytes())
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if err := maybe.WriteFile(longPath(filepath.Join(dir, optimizedFileName)), src, 0o644); err != nil {
+		return fmt.Errorf("%v: %w", ErrWriteFile, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package betteralign
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// simdAlign is the alignment expected by SIMD instructions operating on 128-bit vectors.
+const simdAlign = 16
+
+// findSIMDFields returns struct fields whose address is passed to assembly functions, which are functions of the
+// package declared without a body, mapped to the name of such a function. Addresses are taken as &v.f, &v.f[0],
+// v.f[:] or conversions of these, such as unsafe.Pointer(&v.f).
+func findSIMDFields(files []*ast.File, info *types.Info) map[*types.Var]string {
+	asm := make(map[types.Object]bool)
+
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok && fd.Body == nil {
+				asm[info.Defs[fd.Name]] = true
+			}
+		}
+	}
+
+	if len(asm) == 0 {
+		return nil
+	}
+
+	fields := make(map[*types.Var]string)
+
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+
+			var id *ast.Ident
+
+			switch fun := ast.Unparen(call.Fun).(type) {
+			case *ast.Ident:
+				id = fun
+			case *ast.SelectorExpr:
+				id = fun.Sel
+			default:
+				return true
+			}
+
+			if obj := info.Uses[id]; obj == nil || !asm[obj] {
+				return true
+			}
+
+			for _, arg := range call.Args {
+				if v := addressedField(info, arg); v != nil {
+					fields[v] = id.Name
+				}
+			}
+
+			return true
+		})
+	}
+
+	return fields
+}
+
+// addressedField returns the struct field whose address expression e evaluates to, or nil.
+func addressedField(info *types.Info, e ast.Expr) *types.Var {
+	var addressed bool
+
+	for {
+		switch x := ast.Unparen(e).(type) {
+		case *ast.CallExpr:
+			// conversions such as unsafe.Pointer(&v.f)
+			if tv, ok := info.Types[x.Fun]; !ok || !tv.IsType() || len(x.Args) != 1 {
+				return nil
+			}
+
+			e = x.Args[0]
+		case *ast.UnaryExpr:
+			if x.Op != token.AND {
+				return nil
+			}
+
+			addressed = true
+			e = x.X
+		case *ast.SliceExpr:
+			if x.Low != nil && !isZero(info, x.Low) {
+				return nil
+			}
+
+			addressed = true
+			e = x.X
+		case *ast.IndexExpr:
+			if !addressed || !isZero(info, x.Index) {
+				return nil
+			}
+
+			e = x.X
+		case *ast.SelectorExpr:
+			sel, ok := info.Selections[x]
+			if !ok || sel.Kind() != types.FieldVal || !addressed {
+				return nil
+			}
+
+			return sel.Obj().(*types.Var)
+		default:
+			return nil
+		}
+	}
+}
+
+// isZero reports whether e is the constant 0.
+func isZero(info *types.Info, e ast.Expr) bool {
+	v := info.Types[e].Value
+
+	return v != nil && v.Kind() == constant.Int && constant.Sign(v) == 0
+}
+
+// checkSIMD reports fields of struct typ passed to assembly functions whose offset in the layout of the target
+// platform is not a multiple of simdAlign, as SIMD instructions of such functions may expect 16-byte alignment.
+func checkSIMD(pass *analysis.Pass, typ *types.Struct, name string, fields map[*types.Var]string) {
+	if len(fields) == 0 {
+		return
+	}
+
+	vars := make([]*types.Var, typ.NumFields())
+	for i := range vars {
+		vars[i] = typ.Field(i)
+	}
+
+	offsets := pass.TypesSizes.Offsetsof(vars)
+
+	for i, v := range vars {
+		fn, ok := fields[v]
+		if !ok || offsets[i]%simdAlign == 0 {
+			continue
+		}
+
+		reportf(pass, CodeSIMD, v.Pos(), "field %s of struct %s at offset %d is passed to assembly function %s, which may "+
+			"expect %d-byte alignment", v.Name(), name, offsets[i], fn, simdAlign)
+	}
+}
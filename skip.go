@@ -0,0 +1,46 @@
+package betteralign
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// skipMarker is the name of a marker file excluding its directory and all of its subdirectories from analysis.
+const skipMarker = ".betteralign-skip"
+
+var (
+	skipMu   sync.Mutex
+	skipDirs map[string]string
+)
+
+// skipMarkerDir returns the directory of file fn or the closest of its parent directories holding a
+// .betteralign-skip marker file, or an empty string if there is none. Lookups are cached per directory.
+func skipMarkerDir(fn string) string {
+	skipMu.Lock()
+	defer skipMu.Unlock()
+
+	if skipDirs == nil {
+		skipDirs = make(map[string]string)
+	}
+
+	return markedDir(filepath.Dir(fn))
+}
+
+// markedDir is skipMarkerDir of a directory, with skipMu held.
+func markedDir(dir string) string {
+	if marked, ok := skipDirs[dir]; ok {
+		return marked
+	}
+
+	var marked string
+	if _, err := os.Stat(filepath.Join(dir, skipMarker)); err == nil {
+		marked = dir
+	} else if parent := filepath.Dir(dir); parent != dir {
+		marked = markedDir(parent)
+	}
+
+	skipDirs[dir] = marked
+
+	return marked
+}
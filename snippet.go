@@ -0,0 +1,143 @@
+package betteralign
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"regexp"
+	"strings"
+)
+
+const (
+	// snippetPackage is the package clause prepended to snippets without one, keeping their line numbers.
+	snippetPackage = "package snippet; "
+	// snippetPackagePrinted is snippetPackage as printed with reordered source.
+	snippetPackagePrinted = "package snippet\n\n"
+)
+
+// rePackageClause matches a package clause at the start of a line.
+var rePackageClause = regexp.MustCompile(`(?m)^\s*package\s+\w+`)
+
+// SnippetStruct describes current and optimal layouts of a struct type declared in a snippet.
+type SnippetStruct struct {
+	Name            string              `json:"name"`
+	SVG             string              `json:"svg"`
+	Current         []StructLayoutField `json:"current"`
+	Optimal         []StructLayoutField `json:"optimal"`
+	Order           []int               `json:"order"`
+	Holes           []string            `json:"holes,omitempty"`
+	Size            int64               `json:"size"`
+	OptimalSize     int64               `json:"optimal_size"`
+	PtrBytes        int64               `json:"ptr_bytes"`
+	OptimalPtrBytes int64               `json:"optimal_ptr_bytes"`
+	Align           int64               `json:"align"`
+}
+
+// Snippet is the result of AnalyzeSnippet: layouts of all struct types and the source with suboptimal structs
+// reordered.
+type Snippet struct {
+	Source  string          `json:"source"`
+	Structs []SnippetStruct `json:"structs"`
+	Errors  []string        `json:"errors,omitempty"`
+}
+
+// AnalyzeSnippet returns layouts of all struct types declared in Go source src on architecture goarch, as used by
+// playgrounds and editor extensions. The package clause may be omitted. Type errors, such as unresolved imports,
+// are collected in Snippet.Errors and fields of unknown types are laid out as a word.
+func AnalyzeSnippet(src, goarch string) (*Snippet, error) {
+	sizes := types.SizesFor("gc", goarch)
+	if sizes == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownArch, goarch)
+	}
+
+	prefix, printed := "", ""
+	if !rePackageClause.MatchString(src) {
+		prefix, printed = snippetPackage, snippetPackagePrinted
+	}
+
+	fset := token.NewFileSet()
+
+	f, err := parser.ParseFile(fset, "snippet.go", prefix+src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Snippet{Source: src, Structs: []SnippetStruct{}}
+
+	info := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue), Defs: make(map[*ast.Ident]types.Object)}
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error: func(err error) {
+			result.Errors = append(result.Errors, err.Error())
+		},
+	}
+
+	// type errors are reported through conf.Error
+	_, _ = conf.Check(f.Name.Name, fset, []*ast.File{f}, info)
+
+	s := &gcSizes{WordSize: sizes.Sizeof(unsafePointerTyp), MaxAlign: sizes.Alignof(unsafePointerTyp)}
+	s.setAligns(findAlignDirectives([]*ast.File{f}, info))
+
+	names := make(map[*ast.StructType]string)
+	orders := make(map[int][]int)
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.TypeSpec:
+			if st, ok := n.Type.(*ast.StructType); ok {
+				names[st] = n.Name.Name
+			}
+		case *ast.StructType:
+			typ, ok := info.Types[n].Type.(*types.Struct)
+			if !ok {
+				return true
+			}
+
+			name, ok := names[n]
+			if !ok {
+				name = fmt.Sprintf("struct at line %d", fset.Position(n.Pos()).Line)
+			}
+
+			optimal, indexes := optimalOrder(typ, s)
+			current, optimalLayout := s.layout(typ), s.layout(optimal)
+
+			st := SnippetStruct{
+				Name:            name,
+				SVG:             string(renderSVG(name, s.WordSize, current, optimalLayout)),
+				Current:         toStructLayout(current),
+				Optimal:         toStructLayout(optimalLayout),
+				Order:           indexes,
+				Holes:           explainPadding(current, s.Alignof(typ)),
+				Size:            s.Sizeof(typ),
+				OptimalSize:     s.Sizeof(optimal),
+				PtrBytes:        s.ptrdata(typ),
+				OptimalPtrBytes: s.ptrdata(optimal),
+				Align:           s.Alignof(typ),
+			}
+			result.Structs = append(result.Structs, st)
+
+			if st.Size != st.OptimalSize || st.PtrBytes != st.OptimalPtrBytes {
+				orders[fset.Position(n.Pos()).Offset] = indexes
+			}
+		}
+
+		return true
+	})
+
+	if len(orders) == 0 {
+		return result, nil
+	}
+
+	fixed, err := ReorderStructs("snippet.go", []byte(prefix+src), orders)
+	if err != nil {
+		return nil, err
+	}
+
+	// snippets without a package clause are returned without the one prepended for parsing
+	result.Source = strings.TrimPrefix(string(fixed), printed)
+
+	return result, nil
+}
@@ -0,0 +1,44 @@
+package betteralign
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// checkStructOfArrays estimates memory and GC scan savings of laying out n elements of pointer-heavy struct typ as
+// a struct of arrays (one slice per field) instead of an array of structs. The report is informational only.
+func checkStructOfArrays(pass *analysis.Pass, node *ast.StructType, typ *types.Struct, name string, n int64) {
+	s := newGCSizes(pass)
+	wordSize := s.WordSize
+
+	ptrs := s.ptrdata(typ)
+	if n < soaLen || ptrs == 0 || typ.NumFields() < 2 {
+		return
+	}
+
+	sz := s.Sizeof(typ)
+	aos, aosScan := n*sz, (n-1)*sz+ptrs
+
+	// every field gets its own slice header
+	soa, soaScan := int64(typ.NumFields())*3*wordSize, int64(0)
+
+	for i := 0; i < typ.NumFields(); i++ {
+		ft := typ.Field(i).Type()
+		fsz := s.Sizeof(ft)
+
+		soa += n * fsz
+		if fptrs := s.ptrdata(ft); fptrs > 0 {
+			soaScan += (n-1)*fsz + fptrs
+		}
+	}
+
+	if soa >= aos && soaScan >= aosScan {
+		return
+	}
+
+	reportf(pass, CodeSoA, node.Pos(), "struct %s in %d-element arrays: struct of arrays layout would take %s instead of %s "+
+		"and GC would scan %s instead of %s", name, n, formatBytes(soa), formatBytes(aos), formatBytes(soaScan),
+		formatBytes(aosScan))
+}
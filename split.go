@@ -0,0 +1,75 @@
+package betteralign
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// coldUseRatio is the fraction of uses of the most used field at or below which a field is considered cold.
+const coldUseRatio = 4
+
+// findFieldUses counts references to struct fields in the package, such as selectors and keyed composite literals.
+func findFieldUses(pass *analysis.Pass) map[*types.Var]int {
+	uses := make(map[*types.Var]int)
+
+	for _, obj := range pass.TypesInfo.Uses {
+		if v, ok := obj.(*types.Var); ok && v.IsField() {
+			uses[v]++
+		}
+	}
+
+	return uses
+}
+
+// checkHotCold suggests moving big and rarely used fields of struct typ behind a pointer when it is larger than the
+// split_size threshold, which helps when padding isn't the real problem.
+func checkHotCold(pass *analysis.Pass, node *ast.StructType, typ *types.Struct, name string, uses map[*types.Var]int) {
+	s := newGCSizes(pass)
+	wordSize := s.WordSize
+
+	sz := s.Sizeof(typ)
+	if sz <= splitSize {
+		return
+	}
+
+	maxUses := 0
+	for i := 0; i < typ.NumFields(); i++ {
+		maxUses = max(maxUses, uses[typ.Field(i)])
+	}
+
+	// without any field usage there is nothing to tell hot and cold fields apart
+	if maxUses == 0 {
+		return
+	}
+
+	var (
+		cold    []string
+		coldRaw int64
+	)
+
+	for i := 0; i < typ.NumFields(); i++ {
+		f := typ.Field(i)
+
+		fsz := s.Sizeof(f.Type())
+		if n := uses[f]; n*coldUseRatio <= maxUses && fsz >= 2*wordSize {
+			plural := "s"
+			if n == 1 {
+				plural = ""
+			}
+
+			cold = append(cold, fmt.Sprintf("%s (%d bytes, %d use%s)", f.Name(), fsz, n, plural))
+			coldRaw += fsz
+		}
+	}
+
+	if len(cold) == 0 || coldRaw <= wordSize {
+		return
+	}
+
+	reportf(pass, CodeSplit, node.Pos(), "struct %s of size %d: consider moving rarely used fields %s behind a pointer to save "+
+		"up to %d bytes", name, sz, strings.Join(cold, ", "), coldRaw-wordSize)
+}
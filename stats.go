@@ -0,0 +1,107 @@
+package betteralign
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// PackageStats aggregates layouts of all structs of a single package, or of the whole run, as recorded with audit.
+type PackageStats struct {
+	Package          string `json:"package,omitempty"`
+	Structs          int    `json:"structs"`
+	Suboptimal       int    `json:"suboptimal"`
+	Bytes            int64  `json:"bytes"`
+	PaddingBytes     int64  `json:"padding_bytes"`
+	RecoverableBytes int64  `json:"recoverable_bytes"`
+}
+
+// Stats are aggregate padding statistics of a run: totals over all analyzed structs followed by packages with the
+// most bytes recoverable by reordering.
+type Stats struct {
+	TopPackages []PackageStats `json:"top_packages"`
+	PackageStats
+}
+
+// add accumulates struct layout sa into the stats.
+func (s *PackageStats) add(sa StructAudit) {
+	s.Structs++
+	s.Bytes += sa.Size
+	s.PaddingBytes += sa.Padding
+
+	if !sa.Optimal {
+		s.Suboptimal++
+		s.RecoverableBytes += max(sa.Size-sa.OptimalSize, 0)
+	}
+}
+
+// percent returns n as a percentage of total, or 0 if total is 0.
+func percent(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return 100 * float64(n) / float64(total)
+}
+
+// String returns a one line description of the stats counters.
+func (s PackageStats) String() string {
+	return fmt.Sprintf("%d structs, %d suboptimal, %s total, %s padding (%.1f%%), %s recoverable by reordering "+
+		"(%.1f%% of total, %.1f%% of padding)", s.Structs, s.Suboptimal, formatBytes(s.Bytes),
+		formatBytes(s.PaddingBytes), percent(s.PaddingBytes, s.Bytes), formatBytes(s.RecoverableBytes),
+		percent(s.RecoverableBytes, s.Bytes), percent(s.RecoverableBytes, s.PaddingBytes))
+}
+
+// ComputeStats aggregates struct layouts recorded with audit of all results. Packages with recoverable bytes are
+// ordered by them, most first, and only the top n are kept, or all of them if n is not positive.
+func ComputeStats(results []*Result, n int) Stats {
+	var s Stats
+
+	byPkg := make(map[string]*PackageStats)
+
+	for _, sa := range AllAudits(results) {
+		ps, ok := byPkg[sa.Package]
+		if !ok {
+			ps = &PackageStats{Package: sa.Package}
+			byPkg[sa.Package] = ps
+		}
+
+		ps.add(sa)
+		s.PackageStats.add(sa)
+	}
+
+	for _, ps := range byPkg {
+		if ps.RecoverableBytes > 0 {
+			s.TopPackages = append(s.TopPackages, *ps)
+		}
+	}
+
+	sort.Slice(s.TopPackages, func(i, j int) bool {
+		if s.TopPackages[i].RecoverableBytes != s.TopPackages[j].RecoverableBytes {
+			return s.TopPackages[i].RecoverableBytes > s.TopPackages[j].RecoverableBytes
+		}
+
+		return s.TopPackages[i].Package < s.TopPackages[j].Package
+	})
+
+	if n > 0 && len(s.TopPackages) > n {
+		s.TopPackages = s.TopPackages[:n]
+	}
+
+	return s
+}
+
+// WriteText writes the totals followed by a line per top package.
+func (s Stats) WriteText(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "total: %v\n", s.PackageStats); err != nil {
+		return err
+	}
+
+	for _, ps := range s.TopPackages {
+		if _, err := fmt.Fprintf(w, "%s: %v\n", ps.Package, ps); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
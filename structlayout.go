@@ -0,0 +1,77 @@
+package betteralign
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StructLayoutField is a single entry of honnef.co/go/tools/structlayout JSON output, consumed by
+// structlayout-pretty, structlayout-svg and structlayout-optimize.
+type StructLayoutField struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Start     int64  `json:"start"`
+	End       int64  `json:"end"`
+	Size      int64  `json:"size"`
+	Align     int64  `json:"align"`
+	IsPadding bool   `json:"is_padding"`
+}
+
+// toStructLayout converts field layouts to structlayout entries, emitting padding holes as separate entries.
+func toStructLayout(fields []fieldLayout) []StructLayoutField {
+	out := make([]StructLayoutField, 0, len(fields))
+
+	for _, f := range fields {
+		out = append(out, StructLayoutField{
+			Name:  f.Name,
+			Type:  f.Type,
+			Start: f.Offset,
+			End:   f.Offset + f.Size,
+			Size:  f.Size,
+			Align: f.Align,
+		})
+
+		if f.Padding > 0 {
+			out = append(out, StructLayoutField{
+				Name:      "padding",
+				Start:     f.Offset + f.Size,
+				End:       f.Offset + f.Size + f.Padding,
+				Size:      f.Padding,
+				Align:     1,
+				IsPadding: true,
+			})
+		}
+	}
+
+	return out
+}
+
+// writeStructLayouts stores current and optimal layouts of a struct into dir as <pkg>.<Type>.json and
+// <pkg>.<Type>.optimal.json, where slashes in the package path are replaced by underscores.
+func writeStructLayouts(dir, pkgPath, name string, current, optimal []fieldLayout) error {
+	base := layoutBaseName(dir, pkgPath, name)
+
+	for fn, fields := range map[string][]fieldLayout{
+		base + ".json":         current,
+		base + ".optimal.json": optimal,
+	} {
+		buf, err := json.Marshal(toStructLayout(fields))
+		if err != nil {
+			return fmt.Errorf("%v: %w", ErrWriteLayout, err)
+		}
+
+		if err := os.WriteFile(fn, buf, 0o644); err != nil {
+			return fmt.Errorf("%v: %w", ErrWriteLayout, err)
+		}
+	}
+
+	return nil
+}
+
+// layoutBaseName returns the file name prefix used for per-struct layout output files.
+func layoutBaseName(dir, pkgPath, name string) string {
+	return filepath.Join(dir, strings.ReplaceAll(pkgPath, "/", "_")+"."+name)
+}
@@ -0,0 +1,38 @@
+package betteralign
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	realWdOnce sync.Once
+	wd, realWd string
+)
+
+// symlinkTarget returns the real name of file fn and true when fn is reached through a symlink, either being one
+// itself or through a symlinked directory. Symlinks above the working directory don't count, so that working in a
+// symlinked directory (such as /tmp on macOS) doesn't make every file a symlink.
+func symlinkTarget(fn string) (string, bool) {
+	realWdOnce.Do(func() {
+		var err error
+		if wd, err = os.Getwd(); err == nil {
+			if realWd, err = filepath.EvalSymlinks(wd); err != nil {
+				realWd = wd
+			}
+		}
+	})
+
+	real, err := filepath.EvalSymlinks(fn)
+	if err != nil || wd == "" {
+		return fn, false
+	}
+
+	rel, err := filepath.Rel(wd, normalPath(fn))
+	if err != nil {
+		return fn, false
+	}
+
+	return real, filepath.Join(realWd, rel) != real
+}
@@ -0,0 +1,29 @@
+package alias
+
+type Bad struct { // want "struct of size 12 could be 8"
+	x byte
+	y int32
+	z byte
+}
+
+type Alias = Bad
+
+type Chain = Alias
+
+type Literal = struct { // want "struct of size 12 could be 8"
+	x byte
+	y int32
+	z byte
+}
+
+type LiteralAlias = Literal
+
+type (
+	Good struct {
+		y int32
+		x byte
+		z byte
+	}
+
+	GoodAlias = Good
+)
@@ -0,0 +1,36 @@
+package align
+
+type Field struct { // want "struct of size 32 could be 16"
+	a bool
+	//go:align 16
+	c int64
+	b bool
+}
+
+// Line has the size of a cache line, regardless of its field order.
+//
+//go:align 64
+type Line struct {
+	a bool
+	b int64
+	c bool
+}
+
+type Outer struct { // want "struct of size 192 could be 128"
+	x bool
+	l Line
+	y bool
+}
+
+type Project struct { // want "struct of size 16 could be 8"
+	a bool
+	b int32 //betteralign:align 8
+	c bool
+}
+
+type Invalid struct { // want "struct of size 24 could be 16"
+	a bool
+	//go:align 3
+	b int64
+	c bool
+}
@@ -0,0 +1,29 @@
+package array
+
+type Pixel struct { // want "struct of size 24 could be 16; 8 bytes/element × 1048576-element array = 8MiB"
+	r bool
+	v int64
+	g bool
+}
+
+type Cell struct { // want "struct of size 12 could be 8; 4 bytes/element × 1536-element array = 6KiB"
+	a bool
+	b int32
+	c bool
+}
+
+type Lone struct { // want "struct of size 12 could be 8"
+	a bool
+	b int32
+	c bool
+}
+
+var grid [1536]Cell
+
+func frame() []Pixel {
+	return make([]Pixel, 0, 1<<20)
+}
+
+func one() []Lone {
+	return make([]Lone, 1)
+}
@@ -0,0 +1,45 @@
+package assert
+
+//betteralign:assert size=16
+type Exact struct {
+	a int64
+	b int64
+}
+
+//betteralign:assert size=8
+type Grown struct { // want "Grown has size 16, asserted size 8"
+	a int64
+	b int64
+}
+
+type Bounded struct { //betteralign:assert maxsize=16
+	a int64
+	b int32
+}
+
+//betteralign:assert maxsize=16
+type Oversized struct { // want "Oversized has size 24, exceeding asserted maximum size 16"
+	a int64
+	b int64
+	c int64
+}
+
+type (
+	// Grouped has size 8.
+	//betteralign:assert size=4
+	Grouped struct { // want "Grouped has size 8, asserted size 4"
+		a int64
+	}
+)
+
+//betteralign:assert size=16
+type Suboptimal struct { // want "struct of size 24 could be 16" "Suboptimal has size 24, asserted size 16"
+	a bool
+	b int64
+	c bool
+}
+
+//betteralign:assert bytes=8 // want "malformed betteralign:assert directive: invalid argument \"bytes=8\""
+type Malformed struct {
+	a int64
+}
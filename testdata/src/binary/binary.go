@@ -0,0 +1,17 @@
+package binary
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+type Record struct { // want "struct of size 12 could be 8"
+	A byte
+	B uint32
+	C byte
+}
+
+func encode(r Record) {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, r)
+}
@@ -0,0 +1,13 @@
+package cgogen
+
+type Mirror struct {
+	a byte
+	b CInt
+	c byte
+}
+
+type Plain struct { // want "struct of size 12 could be 8"
+	a byte
+	b uint32
+	c byte
+}
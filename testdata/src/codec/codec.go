@@ -0,0 +1,31 @@
+package codec
+
+type Codec struct{}
+
+func (Codec) Marshal(v any) []byte { return nil }
+
+func Store(v any) {}
+
+type Marshaled struct { // want "struct of size 12 could be 8; not reordered: encoded with codec.Codec.Marshal at codec.go:28"
+	a byte
+	b uint32
+	c byte
+}
+
+type Stored struct { // want "struct of size 12 could be 8; not reordered: encoded with codec.Store at codec.go:29"
+	a byte
+	b uint32
+	c byte
+}
+
+type Plain struct { // want "struct of size 12 could be 8"
+	a byte
+	b uint32
+	c byte
+}
+
+func use() {
+	_ = Codec{}.Marshal(Marshaled{})
+	Store(&Stored{})
+	_ = Plain{}
+}
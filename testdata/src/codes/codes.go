@@ -0,0 +1,33 @@
+package codes
+
+type Size struct { // want "^BA001: 8 bytes saved: struct of size 24 could be 16$"
+	a bool
+	b int64
+	c bool
+}
+
+type Pointers struct { // want "^BA002: 8 bytes saved: struct with 16 pointer bytes could be 8$"
+	n int64
+	p *int
+}
+
+type IgnoredSize struct { // betteralign:ignore BA001
+	a bool
+	b int64
+	c bool
+}
+
+type IgnoredOther struct { // betteralign:ignore BA002 // want "^BA001: "
+	a bool
+	b int64
+	c bool
+}
+
+type IgnoredAll struct { // betteralign:ignore
+	n int64
+	p *int
+}
+
+type Big struct { // want "^BA003: struct Big of size 64 exceeds maximum size 32$"
+	a [64]byte
+}
@@ -0,0 +1,38 @@
+package convert
+
+import "unsafe"
+
+type Wire struct { // want "struct of size 24 could be 16; not reordered: converted to Mirror, which relies on the same field order at convert.go:17"
+	a byte
+	b int64
+	c byte
+}
+
+type Mirror struct { // want "struct of size 24 could be 16; not reordered: converted from Wire, which relies on the same field order at convert.go:17"
+	a byte
+	b int64
+	c byte
+}
+
+func toMirror(w Wire) Mirror { return Mirror(w) }
+
+type Raw struct { // want "struct of size 24 could be 16; not reordered: converted to View via unsafe.Pointer, which relies on the same field order at convert.go:31"
+	a bool
+	b uint64
+	c bool
+}
+
+type View struct { // want "struct of size 24 could be 16; not reordered: converted from Raw via unsafe.Pointer, which relies on the same field order at convert.go:31"
+	a bool
+	b uint64
+	c bool
+}
+
+func view(r *Raw) *View { return (*View)(unsafe.Pointer(r)) }
+
+type Different struct { // want "struct of size 24 could be 16$"
+	a bool
+	b uint64
+	c bool
+	d bool
+}
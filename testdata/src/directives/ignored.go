@@ -0,0 +1,10 @@
+// Package layout mirrors an external format.
+//
+//betteralign:ignore-file layout mirrors an external format
+package directives
+
+type Ignored struct {
+	a bool
+	b int64
+	c bool
+}
@@ -0,0 +1,9 @@
+//betteralign:check-file
+
+package pkg
+
+type Checked struct { // want "struct of size 24 could be 16"
+	a bool
+	b int64
+	c bool
+}
@@ -0,0 +1,4 @@
+// Package pkg is excluded as a whole.
+//
+//betteralign:ignore-package
+package pkg
@@ -0,0 +1,7 @@
+package pkg
+
+type Ignored struct {
+	a bool
+	b int64
+	c bool
+}
@@ -0,0 +1,12 @@
+package explain
+
+type Bad struct { // want "struct of size 24 could be 16; padding: 7 bytes after Flags because next field Count requires 8-byte alignment, 7 bytes after Done because struct size must be a multiple of 8"
+	Flags byte
+	Count int64
+	Done  bool
+}
+
+type Pointers struct { // want "struct with 16 pointer bytes could be 8$"
+	Count int64
+	Name  *string
+}
@@ -0,0 +1,13 @@
+package dep
+
+type Loose struct { // want Loose:"optimal order \\[1 0 2\\], size 24 could be 16"
+	a bool
+	b int64
+	c bool
+}
+
+type Tight struct { // want Tight:"optimal, size 16"
+	b int64
+	a bool
+	c bool
+}
@@ -0,0 +1,20 @@
+package facts
+
+import "facts/dep"
+
+type Outer struct { // want Outer:"optimal order \\[1 0 2\\], size 40 could be 32"
+	a bool
+	l dep.Loose
+	b bool
+}
+
+type Inner struct { // want Inner:"optimal, size 40"
+	l dep.Loose
+	t dep.Tight
+}
+
+type Alias = Inner
+
+type Generic[T any] struct {
+	v T
+}
@@ -0,0 +1,9 @@
+// DO NOT MODIFY — produced by wirestub from wire.yaml.
+
+package gencomment
+
+type Produced struct {
+	a bool
+	b int64
+	c bool
+}
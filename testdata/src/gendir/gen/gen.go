@@ -0,0 +1,7 @@
+package gen
+
+type Generated struct {
+	a bool
+	b int64
+	c bool
+}
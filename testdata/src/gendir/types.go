@@ -0,0 +1,7 @@
+package gendir
+
+type Plain struct { // want "struct of size 24 could be 16"
+	a bool
+	b int64
+	c bool
+}
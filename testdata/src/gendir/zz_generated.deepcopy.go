@@ -0,0 +1,7 @@
+package gendir
+
+type deepCopy struct {
+	a bool
+	b int64
+	c bool
+}
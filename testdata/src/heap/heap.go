@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+type Hot struct { // want `4 bytes saved: struct of size 12 could be 8; heap profile: [1-9]\d* bytes in [1-9]\d* objects`
+	a byte
+	b uint32
+	c byte
+}
+
+type Cold struct { // want "4 bytes saved: struct of size 12 could be 8; heap profile: 0 bytes in 0 objects"
+	a byte
+	b uint32
+	c byte
+}
+
+var sink []*Hot
+
+func main() {
+	runtime.MemProfileRate = 1
+
+	for i := 0; i < 1024; i++ {
+		sink = append(sink, &Hot{})
+	}
+
+	f, err := os.Create(os.Args[1])
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	runtime.GC()
+	_ = pprof.WriteHeapProfile(f)
+	_ = Cold{}
+}
@@ -0,0 +1,72 @@
+package hot
+
+import "sync"
+
+type Pooled struct { // want "struct of size 24 could be 16; hot: used in sync.Pool"
+	a bool
+	b int64
+	c bool
+}
+
+var pool = sync.Pool{
+	New: func() any {
+		return &Pooled{}
+	},
+}
+
+type Looped struct { // want "struct of size 24 could be 16; hot: allocated in a loop"
+	a bool
+	b int64
+	c bool
+}
+
+func loop(n int) []*Looped {
+	var l []*Looped
+	for i := 0; i < n; i++ {
+		l = append(l, &Looped{})
+	}
+
+	return l
+}
+
+type Element struct { // want "struct of size 24 could be 16; hot: element of a large slice, array or map"
+	a bool
+	b int64
+	c bool
+}
+
+var elements = make(map[string]Element, 4096)
+
+type Sent struct { // want "struct of size 24 could be 16; hot: channel element type"
+	a bool
+	b int64
+	c bool
+}
+
+var sent chan Sent
+
+type Gotten struct { // want "struct of size 24 could be 16; hot: used in sync.Pool"
+	a bool
+	b int64
+	c bool
+}
+
+func get(p *sync.Pool) *Gotten {
+	return p.Get().(*Gotten)
+}
+
+type Cold struct {
+	a bool
+	b int64
+	c bool
+}
+
+var cold = &Cold{}
+
+type ColdPointers struct {
+	a bool
+	b int64
+	c bool
+}
+
+var coldPointers chan *ColdPointers
@@ -0,0 +1,25 @@
+package impact
+
+type Hot struct { // want "4 bytes saved: struct of size 12 could be 8; 4 bytes/element × 1024-element array = 4KiB; 4 allocation sites, impact score 16"
+	a byte
+	b uint32
+	c byte
+}
+
+type Cold struct { // want "4 bytes saved: struct of size 12 could be 8; 0 allocation sites, impact score 4"
+	a byte
+	b uint32
+	c byte
+}
+
+type Holder struct {
+	cold *Cold
+	hot  Hot
+}
+
+func alloc() {
+	_ = Hot{}
+	_ = new(Hot)
+	_ = make([]Hot, 1024)
+	_ = make([]*Cold, 1024)
+}
@@ -0,0 +1,14 @@
+package layout
+
+type Good struct {
+	y int32
+	x byte
+	z byte
+}
+
+type Mixed struct {
+	Good
+	name  string
+	flags byte
+	next  *Mixed
+}
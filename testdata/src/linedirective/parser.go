@@ -0,0 +1,8 @@
+package linedirective
+
+//line parser.y:40
+type yySymType struct {
+	yys  bool
+	val  int64
+	done bool
+}
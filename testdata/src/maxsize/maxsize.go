@@ -0,0 +1,16 @@
+package maxsize
+
+type Small struct {
+	a [8]int64
+}
+
+type Large struct { // want "struct Large of size 72 exceeds maximum size 64"
+	a [8]int64
+	b int64
+}
+
+type Padded struct { // want "struct Padded of size 80 exceeds maximum size 64" "struct of size 80 could be 72"
+	a bool
+	b [8]int64
+	c bool
+}
@@ -0,0 +1,52 @@
+package pinned
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unsafe"
+)
+
+type Header struct { // want "struct of size 24 could be 20; not reordered: serialized with binary.Write at binary.go:30"
+	Magic   byte
+	Length  uint32
+	Version byte
+	Body    Body
+}
+
+type Body struct { // want "struct of size 12 could be 8; not reordered: serialized with binary.Write at binary.go:30"
+	Kind  byte
+	Value int32
+	Flags byte
+}
+
+type Record struct { // want "struct of size 12 could be 8; 4 bytes/element × 4-element array = 16B; not reordered: serialized with binary.Read at binary.go:31"
+	A byte
+	B uint32
+	C byte
+}
+
+func encode(h Header) {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, &h)
+	_ = binary.Read(&buf, binary.LittleEndian, make([]Record, 4))
+}
+
+type Frame struct { // want "struct of size 24 could be 20; not reordered: field offset taken by unsafe.Offsetof at binary.go:48"
+	Tag     byte
+	Size    uint32
+	Trailer byte
+	Payload Payload
+}
+
+type Payload struct { // want "struct of size 12 could be 8; not reordered: serialized with binary.Write at binary.go:51"
+	Kind  byte
+	Value int32
+	Flags byte
+}
+
+func encodeFrame(f Frame) {
+	_ = unsafe.Offsetof(f.Size)
+
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, f)
+}
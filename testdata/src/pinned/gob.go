@@ -0,0 +1,26 @@
+package pinned
+
+import (
+	"encoding/gob"
+	"io"
+)
+
+type Persisted struct { // want "struct of size 12 could be 8; not reordered: encoded with gob.Encoder.Encode at gob.go:21"
+	a byte
+	b uint32
+	c byte
+}
+
+type Registered struct { // want "struct of size 12 could be 8; not reordered: encoded with gob.Register at gob.go:25"
+	a byte
+	b uint32
+	c byte
+}
+
+func persist(w io.Writer, p Persisted) error {
+	return gob.NewEncoder(w).Encode(&p)
+}
+
+func init() {
+	gob.Register(Registered{})
+}
@@ -0,0 +1,48 @@
+package pinned
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+type ByValueField struct { // want "struct of size 12 could be 8; not reordered: field accessed by index via reflect Field at reflect.go:33"
+	x byte
+	y int32
+	z byte
+}
+
+type ByTypeField struct { // want "struct of size 12 could be 8; not reordered: field accessed by index via reflect Field at reflect.go:38"
+	x byte
+	y int32
+	z byte
+}
+
+type ByOffset struct { // want "struct of size 12 could be 8; not reordered: field offset taken by unsafe.Offsetof at reflect.go:43"
+	x byte
+	y int32
+	z byte
+}
+
+type ByVariableIndex struct { // want "struct of size 12 could be 8"
+	x byte
+	y int32
+	z byte
+}
+
+func useValue() {
+	_ = reflect.ValueOf(&ByValueField{}).Elem().Field(1)
+}
+
+func useType() {
+	t := reflect.TypeOf(ByTypeField{})
+	_ = t.Field(0)
+}
+
+func useOffset() {
+	var o ByOffset
+	_ = unsafe.Offsetof(o.z)
+}
+
+func useVariable(i int) {
+	_ = reflect.ValueOf(ByVariableIndex{}).Field(i)
+}
@@ -0,0 +1,23 @@
+package pinned
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+type Termios struct { // want "struct of size 12 could be 8; not reordered: passed to syscall.Syscall at syscall.go:21"
+	iflag byte
+	oflag uint32
+	cflag byte
+}
+
+type Winsize struct { // want "struct of size 12 could be 8; not reordered: passed to syscall.RawSyscall at syscall.go:22"
+	row byte
+	col uint32
+	x   byte
+}
+
+func ioctl(fd uintptr, t *Termios, w Winsize) {
+	syscall.Syscall(syscall.SYS_IOCTL, fd, 0, uintptr(unsafe.Pointer(t)))
+	syscall.RawSyscall(syscall.SYS_IOCTL, fd, 0, uintptr(unsafe.Pointer(&w)))
+}
@@ -0,0 +1,26 @@
+package pinned
+
+import "unsafe"
+
+type Raw struct { // want "struct of size 12 could be 8; not reordered: converted to unsafe.Pointer at unsafe.go:24"
+	a byte
+	b uint32
+	c byte
+}
+
+type Mirror struct { // want "struct of size 12 could be 8; not reordered: converted from unsafe.Pointer at unsafe.go:25"
+	a byte
+	b uint32
+	c byte
+}
+
+type Other struct { // want "struct of size 12 could be 8"
+	a byte
+	b uint32
+	c byte
+}
+
+func cast(r *Raw) *Mirror {
+	p := unsafe.Pointer(r)
+	return (*Mirror)(p)
+}
@@ -0,0 +1,7 @@
+package deep
+
+type Deep struct {
+	a bool
+	b int64
+	c bool
+}
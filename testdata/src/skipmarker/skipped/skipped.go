@@ -0,0 +1,7 @@
+package skipped
+
+type Skipped struct {
+	a bool
+	b int64
+	c bool
+}
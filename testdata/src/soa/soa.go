@@ -0,0 +1,26 @@
+package soa
+
+type Particle struct { // want "struct Particle in 4096-element arrays: struct of arrays layout would take 164.1KiB instead of 192KiB and GC would scan 32KiB instead of 192KiB"
+	name  *string
+	x     float64
+	y     float64
+	z     float64
+	mass  float64
+	alive bool
+}
+
+type Point struct {
+	x float64
+	y float64
+}
+
+type Few struct {
+	name *string
+	x    float64
+}
+
+var (
+	particles = make([]Particle, 4096)
+	points    = make([]Point, 4096)
+	few       = make([]Few, 16)
+)
@@ -0,0 +1,40 @@
+package split
+
+type Conn struct { // want "struct Conn of size 560: consider moving rarely used fields peer \\(16 bytes, 0 uses\\), scratch \\(512 bytes, 1 use\\) behind a pointer to save up to 520 bytes"
+	peer    string
+	id      int64
+	state   int64
+	seq     int64
+	flags   int64
+	scratch [512]byte
+}
+
+func (c *Conn) step() {
+	c.state++
+	c.seq++
+	c.flags = c.state
+	c.state = c.seq + c.id + c.state
+}
+
+func (c *Conn) reset() {
+	c.scratch = [512]byte{}
+}
+
+type Busy struct {
+	buf [512]byte
+	n   int64
+}
+
+func (b *Busy) fill() {
+	b.buf[b.n] = 1
+	b.n++
+}
+
+type Small struct {
+	b string
+	a int64
+}
+
+func (s *Small) get() int64 {
+	return s.a
+}
@@ -0,0 +1,7 @@
+package table
+
+type Bad struct { // want `struct of size 12 could be 8\ncurrent layout: field\s+offset size padding\n\s+x byte\s+0\s+1\s+3\n\s+y int32\s+4\s+4\s+0\n\s+z byte\s+8\s+1\s+3\noptimal layout: field\s+offset size padding\n\s+y int32\s+0\s+4\s+0\n\s+x byte\s+4\s+1\s+0\n\s+z byte\s+5\s+1\s+2$`
+	x byte
+	y int32
+	z byte
+}
@@ -0,0 +1,21 @@
+package typeerrors
+
+var x int = "x"
+
+type Good struct { // want "struct of size 24 could be 16"
+	a bool
+	b int64
+	c bool
+}
+
+type Undefined struct {
+	a bool
+	b Missing
+	c bool
+}
+
+type Nested struct {
+	a bool
+	b [2]struct{ m Missing }
+	c bool
+}
@@ -0,0 +1,31 @@
+package vector
+
+import "unsafe"
+
+//go:noescape
+func add4(dst, src *[4]float32)
+
+//go:noescape
+func sum(p unsafe.Pointer, n int) float32
+
+type Vectors struct { // want "struct of size 48 could be 32"
+	n    int32
+	data [4]float32 // want "field data of struct Vectors at offset 4 is passed to assembly function add4"
+	flag bool
+}
+
+type Aligned struct {
+	data [4]float32
+	n    int32
+}
+
+type Converted struct {
+	n    int64
+	data [8]float32 // want "field data of struct Converted at offset 8 is passed to assembly function sum"
+}
+
+func use(v *Vectors, a *Aligned, c *Converted) float32 {
+	add4(&v.data, &a.data)
+
+	return sum(unsafe.Pointer(&c.data[0]), len(c.data))
+}
@@ -0,0 +1,16 @@
+package verify
+
+type MultiName struct { // want "struct of size 24 could be 16"
+	a, b bool
+	c    int64
+	d, e bool
+}
+
+type Embedded struct { // want "struct with 16 pointer bytes could be 8"
+	n int
+	Inner
+}
+
+type Inner struct {
+	p *int
+}
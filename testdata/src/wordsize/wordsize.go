@@ -0,0 +1,13 @@
+package wordsize
+
+type Word struct { // want "struct of size 12 could be 8"
+	a bool
+	p *int
+	c bool
+}
+
+type Aligned struct { // want "struct of size 16 could be 12"
+	a bool
+	b int64
+	c bool
+}
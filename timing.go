@@ -0,0 +1,21 @@
+package betteralign
+
+import "time"
+
+// Timing is the time spent analyzing a package, by phase: inspecting its structs, decorating its files into DST,
+// and printing and writing files rewritten by apply. Rewritten files are printed and written concurrently, so Print
+// and Write are the sums of per file durations.
+type Timing struct {
+	Inspect  time.Duration `json:"inspect_ns"`
+	Decorate time.Duration `json:"decorate_ns"`
+	Print    time.Duration `json:"print_ns"`
+	Write    time.Duration `json:"write_ns"`
+}
+
+// Add accumulates timing t2 into t.
+func (t *Timing) Add(t2 Timing) {
+	t.Inspect += t2.Inspect
+	t.Decorate += t2.Decorate
+	t.Print += t2.Print
+	t.Write += t2.Write
+}
@@ -0,0 +1,45 @@
+package betteralign
+
+import "go/types"
+
+// unresolvedField returns the first field of struct typ whose layout depends on a type which failed to type-check,
+// such as an undefined type or a type of a package which couldn't be imported, or nil if all of them resolved.
+// Layouts of such structs are unknown, so they are skipped while the rest of the package is still analyzed.
+func unresolvedField(typ *types.Struct) *types.Var {
+	for i := 0; i < typ.NumFields(); i++ {
+		if f := typ.Field(i); unresolvedLayout(f.Type(), make(map[types.Type]bool)) {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// unresolvedLayout reports whether size or alignment of T depends on a type which failed to type-check. Pointers,
+// slices, maps, channels, functions and interfaces have known layouts regardless of their element types.
+func unresolvedLayout(T types.Type, visiting map[types.Type]bool) bool {
+	if visiting[T] {
+		return false
+	}
+
+	visiting[T] = true
+
+	switch t := T.(type) {
+	case *types.Basic:
+		return t.Kind() == types.Invalid
+	case *types.Named:
+		return unresolvedLayout(t.Underlying(), visiting)
+	case *types.Alias:
+		return unresolvedLayout(types.Unalias(t), visiting)
+	case *types.Array:
+		return unresolvedLayout(t.Elem(), visiting)
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if unresolvedLayout(t.Field(i).Type(), visiting) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
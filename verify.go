@@ -0,0 +1,61 @@
+package betteralign
+
+import (
+	"fmt"
+	"go/types"
+
+	"github.com/sirkon/dst"
+)
+
+// verifyOrder checks that reordering fields of struct node by indexes, as apply would rewrite them, results in the
+// optimal size and pointer bytes of typ, and that sizing the rewritten struct again would produce no further
+// diagnostic. It protects against mismatches between the optimizer and the rewritten source.
+func verifyOrder(node *dst.StructType, typ *types.Struct, indexes []int, groups [][]int, s *gcSizes,
+	optsz, optptrs int64,
+) error {
+	flat := flattenFields(node)
+	if len(flat) != typ.NumFields() {
+		return fmt.Errorf("%w: %d fields in source, %d in type", ErrFieldOrder, len(flat), typ.NumFields())
+	}
+
+	// multi-named fields are moved as a whole, together with all of their names
+	var fields []*types.Var
+
+	moved := make(map[int]int, len(indexes))
+
+	for _, index := range indexes {
+		f := flat[index]
+		if f == nil {
+			continue
+		}
+
+		for i := 0; i < max(len(f.Names), 1); i++ {
+			moved[index+i] = len(fields)
+			fields = append(fields, typ.Field(index+i))
+		}
+	}
+
+	rewritten := s.alignLike(types.NewStruct(fields, nil), typ)
+	sz, ptrs := s.Sizeof(rewritten), s.ptrdata(rewritten)
+
+	if sz != optsz || ptrs != optptrs {
+		return fmt.Errorf("rewritten struct has size %d and %d pointer bytes, expected %d and %d", sz, ptrs, optsz,
+			optptrs)
+	}
+
+	// mutex groups of the rewritten struct are the same fields at their new indexes
+	regroups := make([][]int, len(groups))
+	for g, group := range groups {
+		for _, i := range group {
+			regroups[g] = append(regroups[g], moved[i])
+		}
+	}
+
+	optimal, _ := optimalGroupedOrder(rewritten, s, regroups)
+	if resz, reptrs := s.Sizeof(optimal), s.ptrdata(optimal); resz != sz || reptrs != ptrs {
+		return fmt.Errorf("rewritten struct of size %d and %d pointer bytes could still be %d and %d", sz, ptrs,
+			resz, reptrs)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package betteralign
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"os"
+)
+
+const (
+	vizDot = "dot"
+	vizSVG = "svg"
+
+	// svgCell is the width and height of a single byte cell in SVG output.
+	svgCell = 24
+	// svgMargin is the space around and between rendered layouts in SVG output.
+	svgMargin = 16
+)
+
+// vizPalette holds fill colors cycled through for struct fields; padding and pointer bytes are marked separately.
+var vizPalette = []string{"#8dd3c7", "#ffffb3", "#bebada", "#80b1d3", "#fdb462", "#b3de69", "#fccde5", "#d9d9d9"}
+
+// fieldColors assigns palette colors to fields by name, so the same field has the same color in both layouts.
+func fieldColors(fields []fieldLayout) map[string]string {
+	colors := make(map[string]string, len(fields))
+	for i, f := range fields {
+		colors[f.Name] = vizPalette[i%len(vizPalette)]
+	}
+
+	return colors
+}
+
+// writeViz renders current and optimal layouts of a struct into dir as <pkg>.<Type>.svg or <pkg>.<Type>.dot.
+func writeViz(dir, format, pkgPath, name string, wordSize int64, current, optimal []fieldLayout) error {
+	var buf []byte
+
+	switch format {
+	case vizDot:
+		buf = renderDot(name, current, optimal)
+	case vizSVG:
+		buf = renderSVG(name, wordSize, current, optimal)
+	default:
+		return fmt.Errorf("%v: unknown format %q", ErrWriteLayout, format)
+	}
+
+	if err := os.WriteFile(layoutBaseName(dir, pkgPath, name)+"."+format, buf, 0o644); err != nil {
+		return fmt.Errorf("%v: %w", ErrWriteLayout, err)
+	}
+
+	return nil
+}
+
+// renderDot renders layouts as Graphviz HTML-like tables, one row per field or padding hole.
+func renderDot(name string, current, optimal []fieldLayout) []byte {
+	var buf bytes.Buffer
+
+	colors := fieldColors(current)
+
+	fmt.Fprintf(&buf, "digraph %q {\n\tnode [shape=plaintext fontname=monospace];\n\trankdir=LR;\n", name)
+
+	for _, l := range []struct {
+		title  string
+		fields []fieldLayout
+	}{{"current", current}, {"optimal", optimal}} {
+		fmt.Fprintf(&buf, "\t%s [label=<<table border=\"0\" cellborder=\"1\" cellspacing=\"0\">\n", l.title)
+		fmt.Fprintf(&buf, "\t\t<tr><td colspan=\"3\"><b>%s %s</b></td></tr>\n", html.EscapeString(name), l.title)
+		fmt.Fprintf(&buf, "\t\t<tr><td>offset</td><td>field</td><td>size</td></tr>\n")
+
+		for _, f := range l.fields {
+			color := colors[f.Name]
+			if f.PtrData > 0 {
+				color = "#fb8072"
+			}
+
+			fmt.Fprintf(&buf, "\t\t<tr><td>%d</td><td bgcolor=\"%s\">%s %s</td><td>%d</td></tr>\n",
+				f.Offset, color, html.EscapeString(f.Name), html.EscapeString(f.Type), f.Size)
+
+			if f.Padding > 0 {
+				fmt.Fprintf(&buf, "\t\t<tr><td>%d</td><td bgcolor=\"#ffffff\"><i>padding</i></td><td>%d</td></tr>\n",
+					f.Offset+f.Size, f.Padding)
+			}
+		}
+
+		fmt.Fprintf(&buf, "\t</table>>];\n")
+	}
+
+	fmt.Fprintf(&buf, "\tcurrent -> optimal;\n}\n")
+
+	return buf.Bytes()
+}
+
+// renderSVG renders layouts side by side as grids of bytes, one machine word per row. Fields are colored, pointer
+// bytes are outlined in red and padding bytes are left blank.
+func renderSVG(name string, wordSize int64, current, optimal []fieldLayout) []byte {
+	rows := func(fields []fieldLayout) int64 {
+		if len(fields) == 0 {
+			return 1
+		}
+
+		last := fields[len(fields)-1]
+
+		return (last.Offset + last.Size + last.Padding + wordSize - 1) / wordSize
+	}
+
+	height := max(rows(current), rows(optimal))*svgCell + 3*svgMargin
+	width := 2*wordSize*svgCell + 3*svgMargin
+
+	colors := fieldColors(current)
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"monospace\" "+
+		"font-size=\"10\">\n", width, height)
+	fmt.Fprintf(&buf, "<title>%s</title>\n", html.EscapeString(name))
+
+	for col, l := range []struct {
+		title  string
+		fields []fieldLayout
+	}{{"current", current}, {"optimal", optimal}} {
+		x0 := int64(svgMargin) + int64(col)*(wordSize*svgCell+svgMargin)
+		y0 := int64(2 * svgMargin)
+
+		fmt.Fprintf(&buf, "<text x=\"%d\" y=\"%d\">%s %s</text>\n", x0, svgMargin, html.EscapeString(name), l.title)
+
+		for _, f := range l.fields {
+			for b := f.Offset; b < f.Offset+f.Size+f.Padding; b++ {
+				fill, stroke := colors[f.Name], "#000000"
+				if b >= f.Offset+f.Size {
+					fill = "#ffffff"
+				} else if b-f.Offset < f.PtrData {
+					stroke = "#e41a1c"
+				}
+
+				fmt.Fprintf(&buf, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%s\" stroke=\"%s\"/>\n",
+					x0+(b%wordSize)*svgCell, y0+(b/wordSize)*svgCell, svgCell, svgCell, fill, stroke)
+			}
+
+			fmt.Fprintf(&buf, "<text x=\"%d\" y=\"%d\">%s</text>\n",
+				x0+(f.Offset%wordSize)*svgCell+2, y0+(f.Offset/wordSize)*svgCell+svgCell/2+4, html.EscapeString(f.Name))
+		}
+	}
+
+	fmt.Fprintf(&buf, "</svg>\n")
+
+	return buf.Bytes()
+}